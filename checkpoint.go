@@ -0,0 +1,246 @@
+package netscrape
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+)
+
+// CheckpointEntry is the checkpointed state of plan resource.
+type CheckpointEntry struct {
+	State ResourceState `json:"state"`
+	Time  time.Time     `json:"time"`
+	Error string        `json:"error,omitempty"`
+}
+
+// checkpointRecord is a record of checkpoint file.
+type checkpointRecord struct {
+	Key string `json:"key"`
+	CheckpointEntry
+}
+
+// Checkpoint is scrape checkpoint stored in a local file.
+// Every recorded state is appended to the file as a JSON record,
+// the file is compacted when the checkpoint is loaded.
+// Plan resources are keyed by their UID. Plan resources
+// scraped by federated sources are keyed by the source
+// name and their UID separated by slash, e.g. k8s/UID.
+type Checkpoint struct {
+	path string
+	mu   sync.RWMutex
+	// source is the name of the federated source of the checkpoint.
+	source string
+	// root is the checkpoint the source checkpoint is stored in.
+	root *Checkpoint
+	// Resources are checkpointed plan resources.
+	Resources map[string]CheckpointEntry
+}
+
+// LoadCheckpoint loads checkpoint from the file at path and returns it.
+// The file is compacted so it holds only the last state of every resource.
+// If the file does not exist an empty checkpoint is returned.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:      path,
+		Resources: make(map[string]CheckpointEntry),
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var rec checkpointRecord
+		if err := dec.Decode(&rec); err != nil {
+			// NOTE: the last record is left half written
+			// if the scrape was killed while recording it
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		c.Resources[rec.Key] = rec.CheckpointEntry
+	}
+
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Source returns checkpoint of the federated source with the given name.
+// Source checkpoint is stored in c under the keys prefixed with the source name.
+func (c *Checkpoint) Source(name string) *Checkpoint {
+	if c == nil {
+		return nil
+	}
+
+	return &Checkpoint{
+		source: name,
+		root:   c.store(),
+	}
+}
+
+// store returns the checkpoint which stores the resources of c.
+func (c *Checkpoint) store() *Checkpoint {
+	if c.root != nil {
+		return c.root
+	}
+	return c
+}
+
+// key returns the checkpoint key of resource with the given uid.
+func (c *Checkpoint) key(uid uuid.UID) string {
+	if c.source != "" {
+		return c.source + "/" + uid.String()
+	}
+	return uid.String()
+}
+
+// Done returns true if resource with the given uid has been scraped successfully.
+func (c *Checkpoint) Done(uid uuid.UID) bool {
+	if c == nil || uid == nil {
+		return false
+	}
+
+	s := c.store()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.Resources[c.key(uid)].State == Finished
+}
+
+// Record records the state of resource with the given uid and appends it to the checkpoint file.
+func (c *Checkpoint) Record(uid uuid.UID, state ResourceState, err error) error {
+	if c == nil || uid == nil {
+		return nil
+	}
+
+	s := c.store()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := CheckpointEntry{State: state, Time: time.Now()}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	key := c.key(uid)
+	s.Resources[key] = entry
+
+	return s.append(checkpointRecord{Key: key, CheckpointEntry: entry})
+}
+
+// append appends rec to the checkpoint file.
+// NOTE: this must be called with the checkpoint lock held.
+func (c *Checkpoint) append(rec checkpointRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// compact rewrites the checkpoint file with a single record of every resource.
+// The file is replaced atomically so it's never left half written.
+func (c *Checkpoint) compact() error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for key, entry := range c.Resources {
+		if err := enc.Encode(checkpointRecord{Key: key, CheckpointEntry: entry}); err != nil {
+			return err
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path)
+}
+
+// Remove removes the checkpoint file.
+// Removing source checkpoint removes the checkpoint it's stored in.
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+
+	s := c.store()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Resources = make(map[string]CheckpointEntry)
+
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// resumePlan is plan which skips checkpointed resources.
+type resumePlan struct {
+	plan.Plan
+	checkpoint *Checkpoint
+}
+
+// GetAll returns all plan resources which have not been scraped successfully.
+func (p *resumePlan) GetAll(ctx context.Context, opts ...plan.Option) ([]plan.Resource, error) {
+	rx, err := p.Plan.GetAll(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]plan.Resource, 0, len(rx))
+	for _, r := range rx {
+		if !p.checkpoint.Done(r.UID()) {
+			pending = append(pending, r)
+		}
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,275 @@
+package netscrape
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+)
+
+func MustTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "netscrape")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+func TestCheckpoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	path := filepath.Join(MustTempDir(t), "checkpoint.json")
+	p := MustPlan(t, "foo", "bar", "baz")
+
+	r, err := NewRunner(WithCheckpoint(path))
+	if err != nil {
+		t.Fatalf("failed creating runner: %v", err)
+	}
+
+	if _, err := r.Run(context.Background(), p, &testScraper{fail: "bar"}); err != nil {
+		t.Fatalf("failed running scrape: %v", err)
+	}
+
+	c, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("failed loading checkpoint: %v", err)
+	}
+
+	rx, err := p.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get plan resources: %v", err)
+	}
+
+	for _, res := range rx {
+		state := Finished
+		if res.Kind() == "bar" {
+			state = Failed
+		}
+
+		if s := c.Resources[res.UID().String()].State; s != state {
+			t.Errorf("expected %s state: %s, got: %s", res.Kind(), state, s)
+		}
+	}
+
+	s := &testScraper{}
+	if _, err := r.Run(context.Background(), p, s); err != nil {
+		t.Fatalf("failed resuming scrape: %v", err)
+	}
+
+	if exp := []string{"bar"}; !reflect.DeepEqual(s.scraped, exp) {
+		t.Errorf("expected scraped: %v, got: %v", exp, s.scraped)
+	}
+
+	history := r.History()
+	totals := Totals{Resources: 3, Finished: 1, Skipped: 2, Entities: 1}
+	if got := history[len(history)-1].Totals; got != totals {
+		t.Errorf("expected totals: %v, got: %v", totals, got)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected checkpoint removed, got: %v", err)
+	}
+
+	s = &testScraper{}
+	if _, err := r.Run(context.Background(), p, s); err != nil {
+		t.Fatalf("failed running scrape: %v", err)
+	}
+
+	if len(s.scraped) != len(rx) {
+		t.Errorf("expected scraped: %d, got: %d", len(rx), len(s.scraped))
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("Incomplete", func(t *testing.T) {
+		path := filepath.Join(MustTempDir(t), "checkpoint.json")
+		p := MustPlan(t, "foo", "bar")
+
+		r, err := NewRunner(WithCheckpoint(path))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), p, &testScraper{fail: "bar"}); err != nil {
+			t.Fatalf("failed running scrape: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), p, &storeScraper{}); err != nil {
+			t.Fatalf("failed resuming scrape: %v", err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected checkpoint kept, got: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), p, &testScraper{}, WithSelector(plan.GVK("", "", "foo"))); err != nil {
+			t.Fatalf("failed resuming scrape: %v", err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected checkpoint kept, got: %v", err)
+		}
+	})
+
+	t.Run("Federation", func(t *testing.T) {
+		path := filepath.Join(MustTempDir(t), "checkpoint.json")
+		p := MustPlan(t, "foo", "bar")
+
+		r, err := NewRunner(WithCheckpoint(path), WithStore(newMapStore()))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		f, err := NewFederation([]Source{
+			{Name: "k8s", Scraper: &testScraper{}},
+			{Name: "cloud", Scraper: &testScraper{fail: "bar"}},
+		})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), p, f); err != nil {
+			t.Fatalf("failed running federation: %v", err)
+		}
+
+		k8s, cloud := &testScraper{}, &testScraper{}
+
+		f, err = NewFederation([]Source{
+			{Name: "k8s", Scraper: k8s},
+			{Name: "cloud", Scraper: cloud},
+		})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		res, err := r.Run(context.Background(), p, f)
+		if err != nil {
+			t.Fatalf("failed resuming federation: %v", err)
+		}
+
+		if len(k8s.scraped) != 0 {
+			t.Errorf("expected k8s scraped: %v, got: %v", []string{}, k8s.scraped)
+		}
+
+		if exp := []string{"bar"}; !reflect.DeepEqual(cloud.scraped, exp) {
+			t.Errorf("expected cloud scraped: %v, got: %v", exp, cloud.scraped)
+		}
+
+		totals := Totals{Resources: 2, Finished: 1, Skipped: 1, Entities: 1}
+		if res.Totals != totals {
+			t.Errorf("expected totals: %v, got: %v", totals, res.Totals)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected checkpoint removed, got: %v", err)
+		}
+	})
+}
+
+func MustLines(t *testing.T, path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read checkpoint: %v", err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestCheckpointFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("AppendCompact", func(t *testing.T) {
+		path := filepath.Join(MustTempDir(t), "checkpoint.json")
+
+		c, err := LoadCheckpoint(path)
+		if err != nil {
+			t.Fatalf("failed loading checkpoint: %v", err)
+		}
+
+		foo, bar := memuid.New(), memuid.New()
+		errFoo := errors.New("foo error")
+
+		records := []struct {
+			uid   uuid.UID
+			state ResourceState
+			err   error
+		}{
+			{foo, Failed, errFoo},
+			{bar, Finished, nil},
+			{foo, Finished, nil},
+		}
+
+		for i, r := range records {
+			if err := c.Record(r.uid, r.state, r.err); err != nil {
+				t.Fatalf("failed recording state: %v", err)
+			}
+
+			if n := MustLines(t, path); n != i+1 {
+				t.Errorf("expected records: %d, got: %d", i+1, n)
+			}
+		}
+
+		c, err = LoadCheckpoint(path)
+		if err != nil {
+			t.Fatalf("failed loading checkpoint: %v", err)
+		}
+
+		if n := MustLines(t, path); n != 2 {
+			t.Errorf("expected compacted records: %d, got: %d", 2, n)
+		}
+
+		if !c.Done(foo) || !c.Done(bar) {
+			t.Errorf("expected resources done: %v", c.Resources)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		path := filepath.Join(MustTempDir(t), "checkpoint.json")
+
+		c, err := LoadCheckpoint(path)
+		if err != nil {
+			t.Fatalf("failed loading checkpoint: %v", err)
+		}
+
+		uid := memuid.New()
+		if err := c.Record(uid, Finished, nil); err != nil {
+			t.Fatalf("failed recording state: %v", err)
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatalf("failed to open checkpoint: %v", err)
+		}
+		if _, err := f.WriteString(`{"key":"foo","sta`); err != nil {
+			t.Fatalf("failed to write checkpoint: %v", err)
+		}
+		f.Close()
+
+		c, err = LoadCheckpoint(path)
+		if err != nil {
+			t.Fatalf("failed loading checkpoint: %v", err)
+		}
+
+		if !c.Done(uid) || len(c.Resources) != 1 {
+			t.Errorf("expected single resource done, got: %v", c.Resources)
+		}
+	})
+}
@@ -7,4 +7,24 @@ var (
 	ErrNotImplemented = errors.New("ErrNotImplemented")
 	// ErrMissingPlan is returned when no plan has been provided for netscraping.
 	ErrMissingPlan = errors.New("ErrMissingPlan")
+	// ErrMissingStore is returned when no store has been provided for applying changes.
+	ErrMissingStore = errors.New("ErrMissingStore")
+	// ErrInvalidChange is returned when applying change which has neither entity nor link.
+	ErrInvalidChange = errors.New("ErrInvalidChange")
+	// ErrInvalidSchedule is returned when creating schedule from invalid interval or cron expression.
+	ErrInvalidSchedule = errors.New("ErrInvalidSchedule")
+	// ErrRunInProgress is returned when scheduled run is skipped because another run is in progress.
+	ErrRunInProgress = errors.New("ErrRunInProgress")
+	// ErrInvalidSource is returned when federating sources with missing or duplicate names.
+	ErrInvalidSource = errors.New("ErrInvalidSource")
+	// ErrScraperNotFound is returned when creating scraper which has not been registered.
+	ErrScraperNotFound = errors.New("ErrScraperNotFound")
+	// ErrDuplicateScraper is returned when registering scraper with already registered name.
+	ErrDuplicateScraper = errors.New("ErrDuplicateScraper")
+	// ErrInvalidRegistration is returned when registering scraper with invalid registration.
+	ErrInvalidRegistration = errors.New("ErrInvalidRegistration")
+	// ErrInvalidConfig is returned when scraper config is invalid.
+	ErrInvalidConfig = errors.New("ErrInvalidConfig")
+	// ErrInvalidEvent is returned when decoding scrape event from message of different type.
+	ErrInvalidEvent = errors.New("ErrInvalidEvent")
 )
@@ -0,0 +1,404 @@
+package netscrape
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/trace"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+)
+
+// DefaultControlTopic is the default topic of scrape lifecycle events.
+const DefaultControlTopic = "netscrape.control"
+
+// EventType is scrape lifecycle event type.
+type EventType string
+
+const (
+	// ScrapeStarted is published when scrape starts.
+	ScrapeStarted EventType = "scrape.started"
+	// ResourceStarted is published when scraping of plan resource starts.
+	ResourceStarted EventType = "resource.started"
+	// ResourceFinished is published when plan resource has been scraped.
+	ResourceFinished EventType = "resource.finished"
+	// ResourceFailed is published when scraping of plan resource fails.
+	ResourceFailed EventType = "resource.failed"
+	// ScrapeCompleted is published when scrape completes.
+	ScrapeCompleted EventType = "scrape.completed"
+)
+
+// EventResource is plan resource reported in scrape events.
+type EventResource struct {
+	UID     string `json:"uid"`
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// Totals are scrape totals.
+type Totals struct {
+	// Resources is the number of plan resources.
+	Resources int `json:"resources"`
+	// Finished is the number of scraped plan resources.
+	Finished int `json:"finished"`
+	// Failed is the number of plan resources which failed to be scraped.
+	Failed int `json:"failed"`
+	// Skipped is the number of plan resources skipped
+	// because they were scraped by a previous run.
+	Skipped int `json:"skipped"`
+	// Entities is the number of scraped entities.
+	Entities int `json:"entities"`
+	// Links is the number of scraped links.
+	Links int `json:"links"`
+}
+
+// Event is scrape lifecycle event.
+type Event struct {
+	Type EventType `json:"type"`
+	// ScrapeID identifies the scrape the event belongs to.
+	ScrapeID string    `json:"scrape_id"`
+	Time     time.Time `json:"time"`
+	// Resource is set for plan resource events.
+	Resource *EventResource `json:"resource,omitempty"`
+	// Totals is set for ScrapeCompleted events.
+	Totals *Totals `json:"totals,omitempty"`
+	// Error is set for failed resources and scrapes.
+	Error string `json:"error,omitempty"`
+}
+
+// DecodeEvent decodes scrape event from broker message.
+func DecodeEvent(msg broker.Message) (Event, error) {
+	var e Event
+	if msg.Type != broker.Event {
+		return e, ErrInvalidEvent
+	}
+
+	if err := json.Unmarshal(msg.Data, &e); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Events records and publishes lifecycle events of a single scrape.
+// Events are published only if Events has been created with broker.
+// Events of a scrape are correlated by the scrape ID and share
+// partition key so partitioned topics deliver them in order.
+// Methods of nil Events do nothing, so scrapers can call them
+// regardless of whether events are enabled.
+type Events struct {
+	id    string
+	b     broker.Broker
+	topic string
+	// checkpoint records state of plan resources.
+	checkpoint *Checkpoint
+	// failed is called when plan resource fails.
+	failed func(*ResourceError)
+	// fed reports events of federated source.
+	fed     *fedSource
+	mu      sync.Mutex
+	totals  Totals
+	start   time.Time
+	results map[string]*ResourceResult
+	order   []string
+}
+
+// NewEvents creates a new Events which publishes events
+// on the given broker topic and returns it.
+// If b is nil, events are recorded but not published.
+func NewEvents(b broker.Broker, topic string) *Events {
+	if topic == "" {
+		topic = DefaultControlTopic
+	}
+
+	return &Events{
+		id:      memuid.New().String(),
+		b:       b,
+		topic:   topic,
+		start:   time.Now(),
+		results: make(map[string]*ResourceResult),
+	}
+}
+
+// result returns the result of plan resource r.
+// NOTE: this must be called with the events lock held.
+func (e *Events) result(r plan.Resource) *ResourceResult {
+	k := resourceKey(r)
+	res, ok := e.results[k]
+	if !ok {
+		res = &ResourceResult{Resource: r, State: Pending}
+		e.results[k] = res
+		e.order = append(e.order, k)
+	}
+	return res
+}
+
+// Result returns scrape result recorded so far.
+func (e *Events) Result() *Result {
+	if e == nil {
+		return &Result{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := &Result{
+		ScrapeID:  e.id,
+		Start:     e.start,
+		Duration:  time.Since(e.start),
+		Totals:    e.totals,
+		Resources: make([]ResourceResult, len(e.order)),
+	}
+
+	for i, k := range e.order {
+		res.Resources[i] = *e.results[k]
+	}
+
+	return res
+}
+
+// ScrapeID returns scrape ID.
+func (e *Events) ScrapeID() string {
+	if e == nil {
+		return ""
+	}
+	return e.id
+}
+
+// Totals returns scrape totals recorded so far.
+func (e *Events) Totals() Totals {
+	if e == nil {
+		return Totals{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.totals
+}
+
+// publish publishes event of the given type.
+func (e *Events) publish(ctx context.Context, ev Event) error {
+	if e.b == nil {
+		return nil
+	}
+
+	ev.ScrapeID = e.id
+	ev.Time = time.Now()
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	msg := broker.Message{
+		UID:  memuid.New().String(),
+		Type: broker.Event,
+		Data: data,
+		Attrs: map[string]string{
+			broker.PartitionKeyAttr: e.id,
+			trace.CorrelationIDAttr: e.id,
+		},
+	}
+
+	return e.b.Pub(ctx, e.topic, msg)
+}
+
+// resource returns event resource of r.
+func resource(r plan.Resource) *EventResource {
+	er := &EventResource{
+		Group:   r.Group(),
+		Version: r.Version(),
+		Kind:    r.Kind(),
+	}
+
+	if uid := r.UID(); uid != nil {
+		er.UID = uid.String()
+	}
+
+	return er
+}
+
+// Started publishes ScrapeStarted event for scrape of plan resources rx.
+func (e *Events) Started(ctx context.Context, rx []plan.Resource) error {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	e.totals.Resources = len(rx)
+	for _, r := range rx {
+		e.result(r)
+	}
+	e.mu.Unlock()
+
+	return e.publish(ctx, Event{Type: ScrapeStarted})
+}
+
+// skip records plan resource r skipped by the scrape.
+func (e *Events) skip(r plan.Resource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.transition(e.result(r), Skipped)
+}
+
+// transition moves plan resource result res to state and updates totals.
+// NOTE: this must be called with the events lock held.
+func (e *Events) transition(res *ResourceResult, state ResourceState) {
+	e.count(res.State, -1)
+	e.count(state, 1)
+	res.State = state
+}
+
+// count adds n to the totals of plan resources in state.
+// NOTE: this must be called with the events lock held.
+func (e *Events) count(state ResourceState, n int) {
+	switch state {
+	case Finished:
+		e.totals.Finished += n
+	case Failed:
+		e.totals.Failed += n
+	case Skipped:
+		e.totals.Skipped += n
+	}
+}
+
+// ResourceStarted publishes ResourceStarted event for r.
+func (e *Events) ResourceStarted(ctx context.Context, r plan.Resource) error {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	e.result(r).start = time.Now()
+	e.mu.Unlock()
+
+	if e.fed != nil {
+		return e.fed.resourceStarted(ctx, r)
+	}
+
+	return e.publish(ctx, Event{Type: ResourceStarted, Resource: resource(r)})
+}
+
+// ResourceFinished publishes ResourceFinished event for r.
+// Resource which failed before, e.g. when its scrape is retried,
+// is no longer reported as failed: the latest outcome wins.
+func (e *Events) ResourceFinished(ctx context.Context, r plan.Resource) error {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	res := e.result(r)
+	e.transition(res, Finished)
+	res.Err = nil
+	if !res.start.IsZero() {
+		res.Duration = time.Since(res.start)
+	}
+	e.mu.Unlock()
+
+	if err := e.checkpoint.Record(r.UID(), Finished, nil); err != nil {
+		return err
+	}
+
+	if e.fed != nil {
+		return e.fed.resourceDone(ctx, r, Finished, nil)
+	}
+
+	return e.publish(ctx, Event{Type: ResourceFinished, Resource: resource(r)})
+}
+
+// ResourceFailed publishes ResourceFailed event for r which failed with err.
+// Resource which finished before is reported as failed.
+func (e *Events) ResourceFailed(ctx context.Context, r plan.Resource, err error) error {
+	if e == nil {
+		return nil
+	}
+
+	rerr := &ResourceError{Resource: r, Err: err}
+
+	e.mu.Lock()
+	res := e.result(r)
+	e.transition(res, Failed)
+	res.Err = rerr
+	if !res.start.IsZero() {
+		res.Duration = time.Since(res.start)
+	}
+	failed := e.failed
+	e.mu.Unlock()
+
+	if failed != nil {
+		defer failed(rerr)
+	}
+
+	if cerr := e.checkpoint.Record(r.UID(), Failed, err); cerr != nil {
+		return cerr
+	}
+
+	if e.fed != nil {
+		return e.fed.resourceDone(ctx, r, Failed, err)
+	}
+
+	ev := Event{Type: ResourceFailed, Resource: resource(r)}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	return e.publish(ctx, ev)
+}
+
+// Scraped records n scraped entities and m scraped links.
+func (e *Events) Scraped(n, m int) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	e.totals.Entities += n
+	e.totals.Links += m
+	e.mu.Unlock()
+
+	if e.fed != nil {
+		e.fed.events.Scraped(n, m)
+	}
+}
+
+// ResourceScraped records n entities and m links scraped from plan resource r.
+func (e *Events) ResourceScraped(r plan.Resource, n, m int) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	e.totals.Entities += n
+	e.totals.Links += m
+	res := e.result(r)
+	res.Entities += n
+	res.Links += m
+	e.mu.Unlock()
+
+	if e.fed != nil {
+		e.fed.events.ResourceScraped(r, n, m)
+	}
+}
+
+// Completed publishes ScrapeCompleted event with scrape totals.
+// If err is not nil the scrape is reported as failed.
+func (e *Events) Completed(ctx context.Context, err error) error {
+	if e == nil {
+		return nil
+	}
+
+	totals := e.Totals()
+	ev := Event{Type: ScrapeCompleted, Totals: &totals}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	return e.publish(ctx, ev)
+}
@@ -0,0 +1,630 @@
+package netscrape
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/milosgajdos/netscrape/pkg/attrs"
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/store"
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+
+	memattrs "github.com/milosgajdos/netscrape/pkg/attrs/memory"
+)
+
+const (
+	// SourceAttr is entity attribute which holds the name of its source.
+	// Merged entities hold comma separated names of all their sources.
+	SourceAttr = "source"
+	// IdentityAttr is link attribute which holds the names of attributes
+	// which identified the linked entities as the same entity.
+	IdentityAttr = "identity"
+)
+
+// Source is a named scraper.
+type Source struct {
+	Name    string
+	Scraper Scraper
+}
+
+// IdentityAction is an action applied to entities matched by identity rule.
+type IdentityAction int
+
+const (
+	// LinkIdentities links matching entities.
+	LinkIdentities IdentityAction = iota
+	// MergeIdentities merges matching entities into a single entity.
+	MergeIdentities
+)
+
+// IdentityRule matches entities from different sources
+// which have the same values of all of the rule attributes.
+type IdentityRule struct {
+	// Attrs are the names of matched attributes, e.g. ip or hostname.
+	Attrs []string
+	// Action is the action applied to matching entities.
+	Action IdentityAction
+}
+
+// Federation is a scraper which scrapes several sources concurrently into one store.
+type Federation struct {
+	sources []Source
+	rules   []IdentityRule
+}
+
+// NewFederation creates a new federation of the given sources and returns it.
+// Source names must be unique.
+func NewFederation(sources []Source, rules ...IdentityRule) (*Federation, error) {
+	names := make(map[string]bool, len(sources))
+	for _, s := range sources {
+		if s.Name == "" || s.Scraper == nil || names[s.Name] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSource, s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return &Federation{
+		sources: sources,
+		rules:   rules,
+	}, nil
+}
+
+// Scrape scrapes all federated sources concurrently following the given plan.
+// Every source is scraped with Source option set to its name, with a store
+// which tags the added entities with SourceAttr and with a broker which tags
+// the published messages with SourceAttr attribute. Once all sources are scraped,
+// identity rules are applied to the entities of different sources in the order
+// they are given. Merged entities are merged into the entity of the source which
+// comes first in federation. Identity rules apply only to entities added to store.
+// If Events option is set, every source reports progress to its own Events
+// and the outcomes of plan resources are merged: resource fails as soon as
+// any source fails it and finishes once all sources have finished it.
+// If Events record checkpoint, every source checkpoints plan resources under
+// its name and skips only the resources it has scraped successfully before.
+// Scrape returns the first source error, if any.
+func (f *Federation) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	sopts := Options{}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	if sopts.Store == nil && (sopts.Broker == nil || len(f.rules) > 0) {
+		return ErrMissingStore
+	}
+
+	var fs *fedStore
+	if sopts.Store != nil {
+		fs = &fedStore{
+			Store:    sopts.Store,
+			entities: make(map[string]*fedEntity),
+		}
+	}
+
+	var fe *fedEvents
+	if sopts.Events != nil {
+		var err error
+		fe, err = newFedEvents(ctx, sopts.Events, f.sources, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	errs := make([]error, len(f.sources))
+
+	var wg sync.WaitGroup
+	for i, s := range f.sources {
+		srcOpts := make([]Option, len(opts), len(opts)+4)
+		copy(srcOpts, opts)
+		srcOpts = append(srcOpts, WithSource(s.Name))
+		if fs != nil {
+			srcOpts = append(srcOpts, WithStore(&sourceStore{fedStore: fs, source: s.Name, rank: i}))
+		}
+		if b := sourceBroker(sopts.Broker, s.Name); b != nil {
+			srcOpts = append(srcOpts, WithBroker(b))
+		}
+		if fe != nil {
+			srcOpts = append(srcOpts, WithEvents(fe.source(s.Name)))
+		}
+
+		sp := p
+		if fe != nil && fe.events.checkpoint != nil {
+			sp = &resumePlan{Plan: p, checkpoint: fe.events.checkpoint.Source(s.Name)}
+		}
+
+		wg.Add(1)
+		go func(i int, s Source, p plan.Plan, opts []Option) {
+			defer wg.Done()
+			if err := s.Scraper.Scrape(ctx, p, opts...); err != nil {
+				errs[i] = fmt.Errorf("source %s: %w", s.Name, err)
+			}
+		}(i, s, sp, srcOpts)
+	}
+	wg.Wait()
+
+	if fs != nil {
+		for _, rule := range f.rules {
+			if err := fs.resolve(ctx, rule); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fedEvents merges outcomes of plan resources scraped by federated sources.
+type fedEvents struct {
+	events  *Events
+	sources []string
+	// mu serializes merged events.
+	mu sync.Mutex
+	// states are states of plan resources keyed by resource and source.
+	states map[string]map[string]ResourceState
+	// merged are merged states of plan resources.
+	merged  map[string]ResourceState
+	started map[string]bool
+}
+
+// newFedEvents creates fedEvents which report merged outcomes to e.
+// Resources of plan p which were checkpointed as scraped successfully
+// by a source are recorded as finished by that source.
+func newFedEvents(ctx context.Context, e *Events, sources []Source, p plan.Plan) (*fedEvents, error) {
+	f := &fedEvents{
+		events:  e,
+		sources: make([]string, len(sources)),
+		states:  make(map[string]map[string]ResourceState),
+		merged:  make(map[string]ResourceState),
+		started: make(map[string]bool),
+	}
+
+	for i, s := range sources {
+		f.sources[i] = s.Name
+	}
+
+	if e.checkpoint == nil {
+		return f, nil
+	}
+
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rx {
+		for _, name := range f.sources {
+			if e.checkpoint.Source(name).Done(r.UID()) {
+				k := resourceKey(r)
+				if f.states[k] == nil {
+					f.states[k] = make(map[string]ResourceState, len(f.sources))
+				}
+				f.states[k][name] = Finished
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// source returns Events of the given federated source.
+// Source Events record the state of plan resources in the source checkpoint.
+func (f *fedEvents) source(name string) *Events {
+	e := NewEvents(nil, "")
+	e.id = f.events.id
+	e.checkpoint = f.events.checkpoint.Source(name)
+	e.fed = &fedSource{fedEvents: f, name: name}
+
+	return e
+}
+
+// fedSource reports events of a single federated source.
+type fedSource struct {
+	*fedEvents
+	name string
+}
+
+// resourceStarted reports plan resource r started once the first source starts it.
+func (s *fedSource) resourceStarted(ctx context.Context, r plan.Resource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := resourceKey(r)
+	if s.started[k] {
+		return nil
+	}
+	s.started[k] = true
+
+	return s.events.ResourceStarted(ctx, r)
+}
+
+// resourceDone records state of plan resource r scraped by the source
+// and reports the merged outcome of r if it has changed.
+func (s *fedSource) resourceDone(ctx context.Context, r plan.Resource, state ResourceState, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := resourceKey(r)
+	states, ok := s.states[k]
+	if !ok {
+		states = make(map[string]ResourceState, len(s.sources))
+		s.states[k] = states
+	}
+	states[s.name] = state
+
+	merged, finished := Pending, 0
+	for _, name := range s.sources {
+		switch states[name] {
+		case Failed:
+			merged = Failed
+		case Finished:
+			finished++
+		}
+	}
+
+	if merged != Failed && finished == len(s.sources) {
+		merged = Finished
+	}
+
+	if merged == Pending || merged == s.merged[k] {
+		return nil
+	}
+	s.merged[k] = merged
+
+	if merged == Failed {
+		return s.events.ResourceFailed(ctx, r, fmt.Errorf("source %s: %w", s.name, err))
+	}
+
+	return s.events.ResourceFinished(ctx, r)
+}
+
+// sourceBroker returns broker which tags messages published on b
+// with SourceAttr attribute set to source. It returns nil if b is nil.
+func sourceBroker(b broker.Broker, source string) broker.Broker {
+	if b == nil {
+		return nil
+	}
+
+	sb := &srcBroker{Broker: b, source: source}
+	if bb, ok := b.(broker.BulkBroker); ok {
+		return &srcBulkBroker{srcBroker: sb, bulk: bb}
+	}
+
+	return sb
+}
+
+// srcBroker is broker of a single federated source.
+type srcBroker struct {
+	broker.Broker
+	source string
+}
+
+// tag returns copy of msg tagged with SourceAttr attribute.
+func (b *srcBroker) tag(msg broker.Message) broker.Message {
+	attrs := make(map[string]string, len(msg.Attrs)+1)
+	for k, v := range msg.Attrs {
+		attrs[k] = v
+	}
+	attrs[SourceAttr] = b.source
+	msg.Attrs = attrs
+
+	return msg
+}
+
+// Pub tags m with the source name and publishes it.
+func (b *srcBroker) Pub(ctx context.Context, topic string, m broker.Message, opts ...broker.Option) error {
+	return b.Broker.Pub(ctx, topic, b.tag(m), opts...)
+}
+
+// srcBulkBroker is bulk broker of a single federated source.
+type srcBulkBroker struct {
+	*srcBroker
+	bulk broker.BulkBroker
+}
+
+// BulkPub tags messages in mx with the source name and publishes them.
+func (b *srcBulkBroker) BulkPub(ctx context.Context, topic string, mx []broker.Message, opts ...broker.Option) error {
+	tagged := make([]broker.Message, len(mx))
+	for i, m := range mx {
+		tagged[i] = b.tag(m)
+	}
+
+	return b.bulk.BulkPub(ctx, topic, tagged, opts...)
+}
+
+// fedEntity is an entity added to federated store.
+type fedEntity struct {
+	entity store.Entity
+	source string
+	// rank is the position of the entity source in federation.
+	rank int
+	// seq is the order in which the entity was added.
+	seq int
+}
+
+// fedLink is a link added to federated store.
+type fedLink struct {
+	from, to uuid.UID
+	opts     []store.Option
+}
+
+// fedStore tracks entities and links added to store by federated sources.
+type fedStore struct {
+	store.Store
+	mu       sync.Mutex
+	seq      int
+	entities map[string]*fedEntity
+	links    []fedLink
+}
+
+// sourceStore is store of a single federated source.
+type sourceStore struct {
+	*fedStore
+	source string
+	rank   int
+}
+
+// srcEntity is entity tagged with the name of its source.
+type srcEntity struct {
+	store.Entity
+	attrs attrs.Attrs
+}
+
+// Attrs returns entity attributes.
+func (e *srcEntity) Attrs() attrs.Attrs {
+	return e.attrs
+}
+
+// Add stores a copy of e tagged with the source name.
+// Attributes of e are left intact.
+func (s *sourceStore) Add(ctx context.Context, e store.Entity, opts ...store.Option) error {
+	a, err := memattrs.NewCopyFrom(ctx, e.Attrs())
+	if err != nil {
+		return err
+	}
+
+	if err := a.Set(ctx, SourceAttr, s.source); err != nil {
+		return err
+	}
+
+	e = &srcEntity{Entity: e, attrs: a}
+
+	if err := s.Store.Add(ctx, e, opts...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	s.entities[e.UID().String()] = &fedEntity{entity: e, source: s.source, rank: s.rank, seq: s.seq}
+
+	return nil
+}
+
+// Delete deletes entity with the given uid from store.
+func (s *sourceStore) Delete(ctx context.Context, uid uuid.UID, opts ...store.Option) error {
+	if err := s.Store.Delete(ctx, uid, opts...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entities, uid.String())
+
+	return nil
+}
+
+// Link links two entities in store.
+func (s *sourceStore) Link(ctx context.Context, from, to uuid.UID, opts ...store.Option) error {
+	if err := s.Store.Link(ctx, from, to, opts...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.links = append(s.links, fedLink{from: from, to: to, opts: opts})
+
+	return nil
+}
+
+// Unlink unlinks two entities in store.
+func (s *sourceStore) Unlink(ctx context.Context, from, to uuid.UID, opts ...store.Option) error {
+	if err := s.Store.Unlink(ctx, from, to, opts...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, l := range s.links {
+		if l.from.String() == from.String() && l.to.String() == to.String() {
+			s.links = append(s.links[:i], s.links[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// identity returns identity key of e given by attribute names.
+// It returns false if e is missing any of the attributes.
+func identity(ctx context.Context, e store.Entity, names []string) (string, bool) {
+	vals := make([]string, len(names))
+	for i, name := range names {
+		v, err := e.Attrs().Get(ctx, name)
+		if err != nil || v == "" {
+			return "", false
+		}
+		vals[i] = v
+	}
+
+	return strings.Join(vals, "\x00"), true
+}
+
+// resolve applies identity rule to the entities of different sources.
+// NOTE: resolve runs once all sources have been scraped.
+func (fs *fedStore) resolve(ctx context.Context, rule IdentityRule) error {
+	if len(rule.Attrs) == 0 {
+		return nil
+	}
+
+	fx := make([]*fedEntity, 0, len(fs.entities))
+	for _, e := range fs.entities {
+		fx = append(fx, e)
+	}
+
+	sort.Slice(fx, func(i, j int) bool {
+		if fx[i].rank != fx[j].rank {
+			return fx[i].rank < fx[j].rank
+		}
+		return fx[i].seq < fx[j].seq
+	})
+
+	var keys []string
+	groups := make(map[string][]*fedEntity)
+	for _, e := range fx {
+		key, ok := identity(ctx, e.entity, rule.Attrs)
+		if !ok {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], e)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		c := group[0]
+
+		for _, e := range group[1:] {
+			if e.source == c.source {
+				continue
+			}
+
+			var err error
+			switch rule.Action {
+			case MergeIdentities:
+				err = fs.merge(ctx, c, e)
+			default:
+				a := memattrs.NewFromMap(map[string]string{
+					IdentityAttr: strings.Join(rule.Attrs, ","),
+				})
+				err = fs.Store.Link(ctx, c.entity.UID(), e.entity.UID(), store.WithAttrs(a))
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// merge merges entity e into entity c.
+// Attributes of e missing in c are copied to c, links of e are
+// relinked to c and e is deleted from store. Links between c and e
+// are dropped rather than relinked into self-loops of c.
+func (fs *fedStore) merge(ctx context.Context, c, e *fedEntity) error {
+	ca, ea := c.entity.Attrs(), e.entity.Attrs()
+
+	keys, err := ea.Keys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if k == SourceAttr {
+			continue
+		}
+
+		if v, err := ca.Get(ctx, k); err == nil && v != "" {
+			continue
+		}
+
+		v, err := ea.Get(ctx, k)
+		if err != nil {
+			return err
+		}
+
+		if err := ca.Set(ctx, k, v); err != nil {
+			return err
+		}
+	}
+
+	if err := mergeSource(ctx, ca, e.source); err != nil {
+		return err
+	}
+
+	if err := fs.Store.Add(ctx, c.entity, store.WithUpsert()); err != nil {
+		return err
+	}
+
+	uid, cuid := e.entity.UID().String(), c.entity.UID()
+	links := fs.links[:0]
+	for _, l := range fs.links {
+		from, to, moved := l.from, l.to, false
+		if from.String() == uid {
+			from, moved = cuid, true
+		}
+		if to.String() == uid {
+			to, moved = cuid, true
+		}
+		if !moved {
+			links = append(links, l)
+			continue
+		}
+
+		// NOTE: the link between c and e is removed
+		// from store once e is deleted below
+		if from.String() == to.String() {
+			continue
+		}
+
+		if err := fs.Store.Link(ctx, from, to, l.opts...); err != nil {
+			return err
+		}
+		links = append(links, fedLink{from: from, to: to, opts: l.opts})
+	}
+	fs.links = links
+
+	if err := fs.Store.Delete(ctx, e.entity.UID()); err != nil {
+		return err
+	}
+
+	delete(fs.entities, uid)
+
+	return nil
+}
+
+// mergeSource adds source to sources of entity with attributes a.
+func mergeSource(ctx context.Context, a attrs.Attrs, source string) error {
+	sources, err := a.Get(ctx, SourceAttr)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range strings.Split(sources, ",") {
+		if s == source {
+			return nil
+		}
+	}
+
+	if sources != "" {
+		source = sources + "," + source
+	}
+
+	return a.Set(ctx, SourceAttr, source)
+}
@@ -0,0 +1,379 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/graph"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/space"
+	"github.com/milosgajdos/netscrape/pkg/space/entity"
+	"github.com/milosgajdos/netscrape/pkg/store"
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+
+	memattrs "github.com/milosgajdos/netscrape/pkg/attrs/memory"
+)
+
+// mapStore stores entities and links in maps.
+type mapStore struct {
+	mu       sync.Mutex
+	entities map[string]store.Entity
+	links    map[[2]string]store.Options
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{
+		entities: make(map[string]store.Entity),
+		links:    make(map[[2]string]store.Options),
+	}
+}
+
+func (s *mapStore) Add(ctx context.Context, e store.Entity, opts ...store.Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entities[e.UID().String()] = e
+	return nil
+}
+
+func (s *mapStore) Get(ctx context.Context, uid uuid.UID, opts ...store.Option) (store.Entity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entities[uid.String()]
+	if !ok {
+		return nil, store.ErrEntityNotFound
+	}
+	return e, nil
+}
+
+func (s *mapStore) Delete(ctx context.Context, uid uuid.UID, opts ...store.Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entities, uid.String())
+	for l := range s.links {
+		if l[0] == uid.String() || l[1] == uid.String() {
+			delete(s.links, l)
+		}
+	}
+	return nil
+}
+
+func (s *mapStore) Link(ctx context.Context, from, to uuid.UID, opts ...store.Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lopts := store.Options{}
+	for _, apply := range opts {
+		apply(&lopts)
+	}
+	s.links[[2]string{from.String(), to.String()}] = lopts
+	return nil
+}
+
+func (s *mapStore) Unlink(ctx context.Context, from, to uuid.UID, opts ...store.Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.links, [2]string{from.String(), to.String()})
+	return nil
+}
+
+func (s *mapStore) Graph(ctx context.Context, opts ...store.Option) (graph.Graph, error) {
+	return nil, ErrNotImplemented
+}
+
+// storeScraper adds entities to store and links them in order.
+// Links are linked once all entities have been added.
+type storeScraper struct {
+	entities []space.Entity
+	links    [][2]uuid.UID
+	err      error
+}
+
+func (s *storeScraper) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	sopts := Options{}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	for i, e := range s.entities {
+		if err := sopts.Store.Add(ctx, e); err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if err := sopts.Store.Link(ctx, s.entities[i-1].UID(), e.UID()); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, l := range s.links {
+		if err := sopts.Store.Link(ctx, l[0], l[1]); err != nil {
+			return err
+		}
+	}
+
+	return s.err
+}
+
+// pubScraper publishes a message on topic.
+type pubScraper struct {
+	topic string
+}
+
+func (s *pubScraper) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	sopts := Options{}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	return sopts.Broker.Pub(ctx, s.topic, broker.Message{UID: "foo", Type: broker.Entity})
+}
+
+func MustEntity(t *testing.T, kv map[string]string) space.Entity {
+	e, err := entity.New("entType", entity.WithAttrs(memattrs.NewFromMap(kv)))
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	return e
+}
+
+func MustAttr(t *testing.T, e store.Entity, key string) string {
+	v, err := e.Attrs().Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("failed to get attribute %s: %v", key, err)
+	}
+	return v
+}
+
+func TestFederation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("InvalidSource", func(t *testing.T) {
+		sources := []Source{{Name: "foo", Scraper: &storeScraper{}}, {Name: "foo", Scraper: &storeScraper{}}}
+		if _, err := NewFederation(sources); !errors.Is(err, ErrInvalidSource) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidSource, err)
+		}
+
+		if _, err := NewFederation([]Source{{Scraper: &storeScraper{}}}); !errors.Is(err, ErrInvalidSource) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidSource, err)
+		}
+	})
+
+	t.Run("Link", func(t *testing.T) {
+		k8s := MustEntity(t, map[string]string{"ip": "10.0.0.1"})
+		cloud := MustEntity(t, map[string]string{"ip": "10.0.0.1", "region": "eu"})
+		other := MustEntity(t, map[string]string{"ip": "10.0.0.2"})
+
+		f, err := NewFederation([]Source{
+			{Name: "k8s", Scraper: &storeScraper{entities: []space.Entity{k8s}}},
+			{Name: "cloud", Scraper: &storeScraper{entities: []space.Entity{cloud, other}}},
+		}, IdentityRule{Attrs: []string{"ip"}})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		s := newMapStore()
+		r, err := NewRunner(WithStore(s))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), MustPlan(t, "foo"), f); err != nil {
+			t.Fatalf("failed running federation: %v", err)
+		}
+
+		if len(s.entities) != 3 {
+			t.Errorf("expected entities: %d, got: %d", 3, len(s.entities))
+		}
+
+		if src := MustAttr(t, s.entities[k8s.UID().String()], SourceAttr); src != "k8s" {
+			t.Errorf("expected source: %s, got: %s", "k8s", src)
+		}
+
+		if src := MustAttr(t, s.entities[other.UID().String()], SourceAttr); src != "cloud" {
+			t.Errorf("expected source: %s, got: %s", "cloud", src)
+		}
+
+		if src := MustAttr(t, k8s, SourceAttr); src != "" {
+			t.Errorf("expected scraped entity attributes intact, got source: %s", src)
+		}
+
+		lopts, ok := s.links[[2]string{k8s.UID().String(), cloud.UID().String()}]
+		if !ok {
+			t.Fatalf("expected identity link between sources")
+		}
+
+		if id, _ := lopts.Attrs.Get(context.Background(), IdentityAttr); id != "ip" {
+			t.Errorf("expected identity: %s, got: %s", "ip", id)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		k8s := MustEntity(t, map[string]string{"ip": "10.0.0.1", "host": "foo"})
+		cloud := MustEntity(t, map[string]string{"ip": "10.0.0.1", "host": "foo", "region": "eu"})
+		other := MustEntity(t, map[string]string{"ip": "10.0.0.2"})
+
+		errSource := errors.New("source error")
+
+		f, err := NewFederation([]Source{
+			{Name: "k8s", Scraper: &storeScraper{entities: []space.Entity{k8s}}},
+			{Name: "cloud", Scraper: &storeScraper{entities: []space.Entity{other, cloud}, err: errSource}},
+		}, IdentityRule{Attrs: []string{"ip", "host"}, Action: MergeIdentities})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		s := newMapStore()
+		r, err := NewRunner(WithStore(s))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), MustPlan(t, "foo"), f); !errors.Is(err, errSource) {
+			t.Fatalf("expected error: %v, got: %v", errSource, err)
+		}
+
+		if len(s.entities) != 2 {
+			t.Fatalf("expected entities: %d, got: %d", 2, len(s.entities))
+		}
+
+		merged, ok := s.entities[k8s.UID().String()]
+		if !ok {
+			t.Fatalf("expected merged entity %s", k8s.UID())
+		}
+
+		if src := MustAttr(t, merged, SourceAttr); src != "k8s,cloud" {
+			t.Errorf("expected sources: %s, got: %s", "k8s,cloud", src)
+		}
+
+		if region := MustAttr(t, merged, "region"); region != "eu" {
+			t.Errorf("expected region: %s, got: %s", "eu", region)
+		}
+
+		if _, ok := s.links[[2]string{other.UID().String(), k8s.UID().String()}]; !ok || len(s.links) != 1 {
+			t.Errorf("expected link relinked to merged entity, got: %v", s.links)
+		}
+	})
+
+	t.Run("MergeLinked", func(t *testing.T) {
+		k8s := MustEntity(t, map[string]string{"ip": "10.0.0.1"})
+		cloud := MustEntity(t, map[string]string{"ip": "10.0.0.1"})
+
+		f, err := NewFederation([]Source{
+			{Name: "k8s", Scraper: &storeScraper{entities: []space.Entity{k8s}}},
+			{Name: "cloud", Scraper: &storeScraper{
+				entities: []space.Entity{cloud},
+				links:    [][2]uuid.UID{{cloud.UID(), k8s.UID()}},
+			}},
+		}, IdentityRule{Attrs: []string{"ip"}, Action: MergeIdentities})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		s := newMapStore()
+		r, err := NewRunner(WithStore(s))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), MustPlan(t, "foo"), f); err != nil {
+			t.Fatalf("failed running federation: %v", err)
+		}
+
+		if len(s.entities) != 1 {
+			t.Errorf("expected entities: %d, got: %d", 1, len(s.entities))
+		}
+
+		if len(s.links) != 0 {
+			t.Errorf("expected no self-loop links, got: %v", s.links)
+		}
+	})
+	t.Run("Events", func(t *testing.T) {
+		f, err := NewFederation([]Source{
+			{Name: "k8s", Scraper: &testScraper{fail: "bar"}},
+			{Name: "cloud", Scraper: &testScraper{}},
+		})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		r, err := NewRunner(WithStore(newMapStore()))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		res, err := r.Run(context.Background(), MustPlan(t, "foo", "bar"), f)
+		if err != nil {
+			t.Fatalf("failed running federation: %v", err)
+		}
+
+		totals := Totals{Resources: 2, Finished: 1, Failed: 1, Entities: 3}
+		if res.Totals != totals {
+			t.Errorf("expected totals: %v, got: %v", totals, res.Totals)
+		}
+
+		states := map[string]ResourceState{"foo": Finished, "bar": Failed}
+		for _, rr := range res.Resources {
+			if rr.State != states[rr.Resource.Kind()] {
+				t.Errorf("expected %s state: %s, got: %s", rr.Resource.Kind(), states[rr.Resource.Kind()], rr.State)
+			}
+		}
+	})
+
+	t.Run("Broker", func(t *testing.T) {
+		b := MustBroker(t)
+
+		sub, err := b.Sub(context.Background(), "foo")
+		if err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+
+		f, err := NewFederation([]Source{
+			{Name: "k8s", Scraper: &pubScraper{topic: "foo"}},
+			{Name: "cloud", Scraper: &pubScraper{topic: "foo"}},
+		})
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		r, err := NewRunner(WithBroker(b))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), MustPlan(t, "foo"), f); err != nil {
+			t.Fatalf("failed running federation: %v", err)
+		}
+
+		sources := make(map[string]bool)
+		h := func(ctx context.Context, m broker.Message) error {
+			sources[m.Attrs[SourceAttr]] = true
+			return nil
+		}
+
+		for len(sources) < 2 {
+			if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(time.Second)); err != nil {
+				t.Fatalf("failed receiving message: %v", err)
+			}
+		}
+
+		if !sources["k8s"] || !sources["cloud"] {
+			t.Errorf("expected sources: %v, got: %v", []string{"k8s", "cloud"}, sources)
+		}
+
+		rules := []IdentityRule{{Attrs: []string{"ip"}}}
+		f, err = NewFederation([]Source{{Name: "k8s", Scraper: &pubScraper{topic: "foo"}}}, rules...)
+		if err != nil {
+			t.Fatalf("failed creating federation: %v", err)
+		}
+
+		if _, err := r.Run(context.Background(), MustPlan(t, "foo"), f); !errors.Is(err, ErrMissingStore) {
+			t.Errorf("expected error: %v, got: %v", ErrMissingStore, err)
+		}
+	})
+}
@@ -3,8 +3,12 @@ module github.com/milosgajdos/netscrape
 go 1.14
 
 require (
+	github.com/alicebob/miniredis/v2 v2.15.1
 	github.com/ghodss/yaml v1.0.0
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/google/uuid v1.1.2
+	github.com/nats-io/nats-server/v2 v2.2.6
+	github.com/nats-io/nats.go v1.11.0
+	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1
 	gonum.org/v1/gonum v0.9.1
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
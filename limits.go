@@ -0,0 +1,195 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRetryBackoff is the default base delay between request retries.
+	DefaultRetryBackoff = 100 * time.Millisecond
+	// DefaultMaxRetryBackoff is the default max delay between request retries.
+	DefaultMaxRetryBackoff = 10 * time.Second
+)
+
+// Limits configure scrape rate limits and concurrency.
+// Zero values mean no limit.
+type Limits struct {
+	// Rate is the max number of requests per second across all plan resources.
+	Rate float64
+	// ResourceRate is the max number of requests per second per plan resource.
+	ResourceRate float64
+	// Burst is the max number of requests sent at once.
+	// It defaults to 1 if either of the rates is set.
+	Burst int
+	// MaxInFlight is the max number of plan resources scraped concurrently.
+	MaxInFlight int
+	// Retries is the max number of retries of failed requests.
+	Retries int
+	// Backoff returns the delay before retrying a request
+	// which failed the given number of times.
+	// It defaults to exponential backoff starting at DefaultRetryBackoff.
+	Backoff broker.Backoff
+	// Retryable returns true if the request which failed
+	// with the given error should be retried.
+	// All errors but context errors are retried by default.
+	Retryable func(error) bool
+}
+
+// Limiter enforces scrape limits.
+// Scrapers get Limiter via Limiter option or from context via
+// LimiterFromContext. Methods of nil Limiter apply no limits.
+type Limiter struct {
+	limits   Limits
+	global   *rate.Limiter
+	inflight chan struct{}
+	// mu synchronizes access to resources.
+	mu        sync.Mutex
+	resources map[string]*rate.Limiter
+}
+
+// NewLimiter creates a new Limiter which enforces the given limits and returns it.
+func NewLimiter(limits Limits) *Limiter {
+	if limits.Burst <= 0 {
+		limits.Burst = 1
+	}
+
+	if limits.Backoff == nil {
+		limits.Backoff = broker.ExponentialBackoff(DefaultRetryBackoff, DefaultMaxRetryBackoff)
+	}
+
+	l := &Limiter{
+		limits:    limits,
+		resources: make(map[string]*rate.Limiter),
+	}
+
+	if limits.Rate > 0 {
+		l.global = rate.NewLimiter(rate.Limit(limits.Rate), limits.Burst)
+	}
+
+	if limits.MaxInFlight > 0 {
+		l.inflight = make(chan struct{}, limits.MaxInFlight)
+	}
+
+	return l
+}
+
+type limiterKey struct{}
+
+// ContextWithLimiter returns a copy of ctx which carries l.
+func ContextWithLimiter(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// LimiterFromContext returns Limiter carried by ctx or nil.
+func LimiterFromContext(ctx context.Context) *Limiter {
+	l, _ := ctx.Value(limiterKey{}).(*Limiter)
+	return l
+}
+
+// resourceKey returns limiter key of plan resource r.
+func resourceKey(r plan.Resource) string {
+	if uid := r.UID(); uid != nil {
+		return uid.String()
+	}
+	return r.Group() + "/" + r.Version() + "/" + r.Kind()
+}
+
+// resource returns rate limiter of plan resource r.
+func (l *Limiter) resource(r plan.Resource) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := resourceKey(r)
+	rl, ok := l.resources[k]
+	if !ok {
+		rl = rate.NewLimiter(rate.Limit(l.limits.ResourceRate), l.limits.Burst)
+		l.resources[k] = rl
+	}
+
+	return rl
+}
+
+// Acquire waits until plan resource r can be scraped without exceeding
+// MaxInFlight limit. The returned function releases r and must be called
+// once r has been scraped.
+func (l *Limiter) Acquire(ctx context.Context, r plan.Resource) (func(), error) {
+	if l == nil || l.inflight == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case l.inflight <- struct{}{}:
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.inflight })
+	}, nil
+}
+
+// Wait waits until a request for plan resource r
+// can be sent without exceeding rate limits.
+func (l *Limiter) Wait(ctx context.Context, r plan.Resource) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.global != nil {
+		if err := l.global.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if l.limits.ResourceRate > 0 {
+		if err := l.resource(r).Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retryable returns true if request which failed with err should be retried.
+func (l *Limiter) retryable(err error) bool {
+	if l.limits.Retryable != nil {
+		return l.limits.Retryable(err)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Do sends request f for plan resource r respecting rate limits.
+// Failed requests are retried with backoff up to Retries times.
+// It returns the error of the last attempt.
+func (l *Limiter) Do(ctx context.Context, r plan.Resource, f func(context.Context) error) error {
+	if l == nil {
+		return f(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := l.Wait(ctx, r); err != nil {
+			return err
+		}
+
+		err := f(ctx)
+		if err == nil || attempt > l.limits.Retries || !l.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(l.limits.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
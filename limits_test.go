@@ -0,0 +1,208 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/space/entity"
+)
+
+func MustResource(t *testing.T, kind string) plan.Resource {
+	r, err := entity.NewResource("resType", "resName", "resGroup", "v1", kind, false)
+	if err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+	return r
+}
+
+// limitedScraper scrapes every plan resource concurrently via limiter.
+type limitedScraper struct {
+	active, peak int32
+	requests     int32
+}
+
+func (s *limitedScraper) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	sopts := Options{}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	l := LimiterFromContext(ctx)
+	if l != sopts.Limiter {
+		return errors.New("expected the same limiter in context and options")
+	}
+
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(rx))
+
+	var wg sync.WaitGroup
+	for _, r := range rx {
+		wg.Add(1)
+		go func(r plan.Resource) {
+			defer wg.Done()
+
+			release, err := l.Acquire(ctx, r)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer release()
+
+			n := atomic.AddInt32(&s.active, 1)
+			defer atomic.AddInt32(&s.active, -1)
+			for {
+				p := atomic.LoadInt32(&s.peak)
+				if n <= p || atomic.CompareAndSwapInt32(&s.peak, p, n) {
+					break
+				}
+			}
+
+			errs <- l.Do(ctx, r, func(context.Context) error {
+				atomic.AddInt32(&s.requests, 1)
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			})
+		}(r)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestLimiter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("MaxInFlight", func(t *testing.T) {
+		r, err := NewRunner(WithLimits(Limits{MaxInFlight: 2}))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		s := &limitedScraper{}
+		if _, err := r.Run(context.Background(), MustPlan(t, "a", "b", "c", "d", "e"), s); err != nil {
+			t.Fatalf("failed running scrape: %v", err)
+		}
+
+		if peak := atomic.LoadInt32(&s.peak); peak > 2 {
+			t.Errorf("expected max in-flight: %d, got: %d", 2, peak)
+		}
+
+		if n := atomic.LoadInt32(&s.requests); n != 5 {
+			t.Errorf("expected requests: %d, got: %d", 5, n)
+		}
+	})
+
+	t.Run("Rate", func(t *testing.T) {
+		l := NewLimiter(Limits{Rate: 100})
+		r := MustResource(t, "foo")
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			if err := l.Wait(context.Background(), r); err != nil {
+				t.Fatalf("failed waiting: %v", err)
+			}
+		}
+
+		if d := time.Since(start); d < 35*time.Millisecond {
+			t.Errorf("expected rate limited requests, took: %s", d)
+		}
+	})
+
+	t.Run("ResourceRate", func(t *testing.T) {
+		l := NewLimiter(Limits{ResourceRate: 10})
+		foo, bar := MustResource(t, "foo"), MustResource(t, "bar")
+
+		start := time.Now()
+		for _, r := range []plan.Resource{foo, bar} {
+			if err := l.Wait(context.Background(), r); err != nil {
+				t.Fatalf("failed waiting: %v", err)
+			}
+		}
+
+		if d := time.Since(start); d > 50*time.Millisecond {
+			t.Errorf("expected independent resource rates, took: %s", d)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := l.Wait(ctx, foo); err == nil {
+			t.Errorf("expected resource rate limited")
+		}
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		errRequest := errors.New("request error")
+
+		l := NewLimiter(Limits{Retries: 2, Backoff: broker.ConstantBackoff(time.Millisecond)})
+		r := MustResource(t, "foo")
+
+		attempts := 0
+		err := l.Do(context.Background(), r, func(context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errRequest
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed request: %v", err)
+		}
+
+		attempts = 0
+		err = l.Do(context.Background(), r, func(context.Context) error {
+			attempts++
+			return errRequest
+		})
+		if !errors.Is(err, errRequest) || attempts != 3 {
+			t.Errorf("expected %d attempts with error: %v, got: %d, %v", 3, errRequest, attempts, err)
+		}
+
+		attempts = 0
+		err = l.Do(context.Background(), r, func(context.Context) error {
+			attempts++
+			return context.Canceled
+		})
+		if !errors.Is(err, context.Canceled) || attempts != 1 {
+			t.Errorf("expected no retries of context error, got: %d attempts", attempts)
+		}
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var l *Limiter
+		r := MustResource(t, "foo")
+
+		release, err := l.Acquire(context.Background(), r)
+		if err != nil {
+			t.Fatalf("failed acquiring: %v", err)
+		}
+		release()
+
+		if err := l.Do(context.Background(), r, func(context.Context) error { return nil }); err != nil {
+			t.Errorf("failed request: %v", err)
+		}
+
+		if l := LimiterFromContext(context.Background()); l != nil {
+			t.Errorf("expected no limiter, got: %v", l)
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package netscrape
 
 import (
+	"time"
+
 	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/plan"
 	"github.com/milosgajdos/netscrape/pkg/store"
 )
 
@@ -10,6 +13,32 @@ type Options struct {
 	Store     store.Store
 	Broker    broker.Broker
 	Marshaler broker.Marshaler
+	// ControlTopic is the topic of scrape lifecycle events.
+	ControlTopic string
+	// Events publishes scrape lifecycle events.
+	Events *Events
+	// Resync is the interval of full scrapes in watch mode.
+	Resync time.Duration
+	// Jitter is the max random delay added to scheduled runs.
+	Jitter time.Duration
+	// Timeout is the max duration of a single run.
+	Timeout time.Duration
+	// History is the max number of runs kept in run history.
+	History int
+	// Source is the name of the federated source being scraped.
+	Source string
+	// Limits configure scrape rate limits and concurrency.
+	Limits Limits
+	// Limiter enforces scrape limits.
+	Limiter *Limiter
+	// Checkpoint is the path of scrape checkpoint file.
+	Checkpoint string
+	// Selector restricts scraped plan resources.
+	Selector plan.Selector
+	// FailFast cancels the run once any plan resource fails.
+	FailFast bool
+	// Registry is scraper registry.
+	Registry *Registry
 }
 
 // Option is functional netscrape option.
@@ -35,3 +64,94 @@ func WithMarshaler(m broker.Marshaler) Option {
 		o.Marshaler = m
 	}
 }
+
+// WithControlTopic sets ControlTopic option.
+func WithControlTopic(t string) Option {
+	return func(o *Options) {
+		o.ControlTopic = t
+	}
+}
+
+// WithEvents sets Events option.
+func WithEvents(e *Events) Option {
+	return func(o *Options) {
+		o.Events = e
+	}
+}
+
+// WithResync sets Resync option.
+func WithResync(d time.Duration) Option {
+	return func(o *Options) {
+		o.Resync = d
+	}
+}
+
+// WithJitter sets Jitter option.
+func WithJitter(d time.Duration) Option {
+	return func(o *Options) {
+		o.Jitter = d
+	}
+}
+
+// WithTimeout sets Timeout option.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// WithHistory sets History option.
+func WithHistory(n int) Option {
+	return func(o *Options) {
+		o.History = n
+	}
+}
+
+// WithSource sets Source option.
+func WithSource(name string) Option {
+	return func(o *Options) {
+		o.Source = name
+	}
+}
+
+// WithLimits sets Limits option.
+func WithLimits(l Limits) Option {
+	return func(o *Options) {
+		o.Limits = l
+	}
+}
+
+// WithLimiter sets Limiter option.
+func WithLimiter(l *Limiter) Option {
+	return func(o *Options) {
+		o.Limiter = l
+	}
+}
+
+// WithCheckpoint sets Checkpoint option.
+func WithCheckpoint(path string) Option {
+	return func(o *Options) {
+		o.Checkpoint = path
+	}
+}
+
+// WithSelector sets Selector option.
+func WithSelector(s plan.Selector) Option {
+	return func(o *Options) {
+		o.Selector = s
+	}
+}
+
+// WithFailFast sets FailFast option.
+func WithFailFast() Option {
+	return func(o *Options) {
+		o.FailFast = true
+	}
+}
+
+// WithRegistry sets Registry option.
+func WithRegistry(r *Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
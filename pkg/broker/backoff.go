@@ -0,0 +1,32 @@
+package broker
+
+import "time"
+
+// Backoff returns the delay before redelivering a message
+// which has been delivered the given number of times.
+type Backoff func(attempt int) time.Duration
+
+// ConstantBackoff returns Backoff which always returns d.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff returns Backoff which doubles base delay
+// with every delivery attempt, never exceeding max.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt; i++ {
+			d *= 2
+			if d >= max || d <= 0 {
+				return max
+			}
+		}
+		if d > max {
+			return max
+		}
+		return d
+	}
+}
@@ -7,6 +7,7 @@ type Broker interface {
 	// Pub publishes messages to the given topic.
 	Pub(ctx context.Context, topic string, m Message, opts ...Option) error
 	// Sub creates a new subscriber to the given topic.
+	// Topic can be a pattern which matches topics as defined by MatchTopic.
 	Sub(ctx context.Context, topic string, opts ...Option) (Subscriber, error)
 }
 
@@ -30,6 +31,10 @@ type Subscriber interface {
 	Unsubscribe(context.Context, ...Option) error
 	// Receive processes received messages with handler.
 	Receive(context.Context, Handler, ...Option) error
+	// Ack acknowledges the message has been processed.
+	Ack(context.Context, Message, ...Option) error
+	// Nack rejects the message so it can be redelivered.
+	Nack(context.Context, Message, ...Option) error
 }
 
 // Message is broker message.
@@ -42,4 +47,7 @@ type Message struct {
 	Data []byte
 	// Attrs are message attributes.
 	Attrs map[string]string
+	// Attempt is the delivery attempt number.
+	// It is set by broker when the message is received.
+	Attempt int
 }
@@ -0,0 +1,8 @@
+package digester
+
+import "errors"
+
+var (
+	// ErrNoDeadLetter is returned when dead-letter policy is configured without dead-letter topic or broker.
+	ErrNoDeadLetter = errors.New("ErrNoDeadLetter")
+)
@@ -1,11 +1,27 @@
 package digester
 
-import "github.com/milosgajdos/netscrape/pkg/broker"
+import (
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/handlers"
+	"github.com/milosgajdos/netscrape/pkg/trace"
+)
 
 // Options configure digester.
 type Options struct {
 	Handler     broker.Handler
 	Unmarshaler broker.Unmarshaler
+	// Tracer configures tracer.
+	Tracer trace.Tracer
+	// Middleware configures handler middleware.
+	Middleware []handlers.Middleware
+	// Workers configures number of concurrent workers.
+	Workers int
+	// OnError configures handler error policy.
+	OnError ErrorPolicy
+	// DeadLetter configures dead-letter topic.
+	DeadLetter string
+	// Broker configures broker used to publish dead-letter messages.
+	Broker broker.Broker
 }
 
 // Option is functional digester option.
@@ -24,3 +40,41 @@ func WithMarshaler(m broker.Unmarshaler) Option {
 		o.Unmarshaler = m
 	}
 }
+
+// WithTracer sets Tracer option.
+func WithTracer(t trace.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = t
+	}
+}
+
+// WithMiddleware appends mw to Middleware option.
+func WithMiddleware(mw ...handlers.Middleware) Option {
+	return func(o *Options) {
+		o.Middleware = append(o.Middleware, mw...)
+	}
+}
+
+// WithWorkers sets Workers option.
+func WithWorkers(n int) Option {
+	return func(o *Options) {
+		o.Workers = n
+	}
+}
+
+// WithOnError sets OnError option.
+func WithOnError(p ErrorPolicy) Option {
+	return func(o *Options) {
+		o.OnError = p
+	}
+}
+
+// WithDeadLetter sets OnError option to DeadLetterOnError
+// and configures dead-letter topic and broker.
+func WithDeadLetter(b broker.Broker, topic string) Option {
+	return func(o *Options) {
+		o.OnError = DeadLetterOnError
+		o.Broker = b
+		o.DeadLetter = topic
+	}
+}
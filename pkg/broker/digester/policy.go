@@ -0,0 +1,29 @@
+package digester
+
+// ErrorPolicy is the policy applied when handler fails.
+type ErrorPolicy int
+
+const (
+	// StopOnError stops digesting messages.
+	StopOnError ErrorPolicy = iota
+	// SkipOnError skips the failed message.
+	SkipOnError
+	// DeadLetterOnError publishes the failed message on dead-letter topic.
+	DeadLetterOnError
+)
+
+// ErrorAttr is message attribute which stores the error
+// of messages published on dead-letter topic.
+const ErrorAttr = "digest-error"
+
+// Stats are digester statistics.
+type Stats struct {
+	// Processed is the number of successfully handled messages.
+	Processed uint64
+	// Failed is the number of messages handler failed to handle.
+	Failed uint64
+	// Skipped is the number of failed messages which were skipped.
+	Skipped uint64
+	// DeadLettered is the number of failed messages published on dead-letter topic.
+	DeadLettered uint64
+}
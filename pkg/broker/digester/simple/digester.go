@@ -2,15 +2,29 @@ package simple
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 
 	"github.com/milosgajdos/netscrape/pkg/broker"
 	"github.com/milosgajdos/netscrape/pkg/broker/digester"
 	"github.com/milosgajdos/netscrape/pkg/broker/handlers"
+	"github.com/milosgajdos/netscrape/pkg/trace"
 )
 
 // Digester digests data from broker.
 type Digester struct {
 	opts digester.Options
+	// stop is closed when digester is stopped.
+	stop chan struct{}
+	once sync.Once
+	// wg tracks running workers.
+	wg sync.WaitGroup
+	// counters
+	processed    uint64
+	failed       uint64
+	skipped      uint64
+	deadLettered uint64
 }
 
 // NewDigester creates a new digester and returns it
@@ -22,13 +36,95 @@ func NewDigester(opts ...digester.Option) (*Digester, error) {
 
 	return &Digester{
 		opts: ropts,
+		stop: make(chan struct{}),
 	}, nil
 }
 
-// handle processes rmessages received by sub with handler h.
-func (d *Digester) handle(ctx context.Context, sub broker.Subscriber, h broker.Handler) error {
+// Stats returns digester statistics.
+func (d *Digester) Stats() digester.Stats {
+	return digester.Stats{
+		Processed:    atomic.LoadUint64(&d.processed),
+		Failed:       atomic.LoadUint64(&d.failed),
+		Skipped:      atomic.LoadUint64(&d.skipped),
+		DeadLettered: atomic.LoadUint64(&d.deadLettered),
+	}
+}
+
+// Stop stops digesting messages.
+// Workers finish handling the messages they have received
+// and Stop waits for them to exit or until ctx is done.
+func (d *Digester) Stop(ctx context.Context) error {
+	d.once.Do(func() { close(d.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// policy wraps h with handler which applies error policy given by opts.
+// Handler errors are returned only if the policy is to stop on error.
+func (d *Digester) policy(h broker.Handler, opts digester.Options) broker.Handler {
+	return func(ctx context.Context, m broker.Message) error {
+		err := h(ctx, m)
+		if err == nil {
+			atomic.AddUint64(&d.processed, 1)
+			return nil
+		}
+
+		atomic.AddUint64(&d.failed, 1)
+
+		switch opts.OnError {
+		case digester.SkipOnError:
+			atomic.AddUint64(&d.skipped, 1)
+			return nil
+		case digester.DeadLetterOnError:
+			dlq := m
+			dlq.Attempt = 0
+			dlq.Attrs = make(map[string]string, len(m.Attrs)+1)
+			for k, v := range m.Attrs {
+				dlq.Attrs[k] = v
+			}
+			dlq.Attrs[digester.ErrorAttr] = err.Error()
+
+			if perr := opts.Broker.Pub(ctx, opts.DeadLetter, dlq); perr != nil {
+				return perr
+			}
+			atomic.AddUint64(&d.deadLettered, 1)
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// handle processes messages received by sub with handler h until
+// ctx is done, digester is stopped, h fails with an error or until
+// sub stops receiving messages, e.g. when the broker is closed.
+// Receive timeouts on idle subscriptions are ignored.
+func (d *Digester) handle(ctx, rctx context.Context, sub broker.Subscriber, h broker.Handler) error {
+	// NOTE: messages are handled with ctx so that stopping
+	// the digester doesn't cancel messages being handled
+	hctx := func(_ context.Context, m broker.Message) error {
+		return h(ctx, m)
+	}
+
 	for {
-		if err := sub.Receive(ctx, h); err != nil {
+		select {
+		case <-rctx.Done():
+			return nil
+		default:
+		}
+
+		if err := sub.Receive(rctx, hctx); err != nil && !errors.Is(err, broker.ErrTimeout) {
 			return err
 		}
 	}
@@ -36,16 +132,84 @@ func (d *Digester) handle(ctx context.Context, sub broker.Subscriber, h broker.H
 
 // Digest reads data from broker via sub and handles it via an optional handler.
 // If no handler has been given, the message payload is copied to stdout.
+// The handler is wrapped with Middleware option; messages are handled
+// in a "digest" span which continues the message trace
+// and the handler context carries the message correlation ID.
+// Messages are handled by Workers concurrent workers, or by a single one
+// if Workers option is not set. Handler errors follow OnError policy.
+// Digest blocks until ctx is done, digester is stopped, or until
+// any of the workers fails, in which case it returns the error.
+// Digest fails with broker.ErrNotConnected once the broker is closed
+// and with broker.ErrSubscriptionInactive once sub unsubscribes.
 func (d *Digester) Digest(ctx context.Context, sub broker.Subscriber, opts ...digester.Option) error {
-	dopts := digester.Options{}
+	dopts := d.opts
+	dopts.Middleware = append([]handlers.Middleware{}, d.opts.Middleware...)
 	for _, apply := range opts {
 		apply(&dopts)
 	}
 
+	if dopts.OnError == digester.DeadLetterOnError && (dopts.Broker == nil || dopts.DeadLetter == "") {
+		return digester.ErrNoDeadLetter
+	}
+
+	select {
+	case <-d.stop:
+		return nil
+	default:
+	}
+
 	h := dopts.Handler
 	if h == nil {
 		h = handlers.DumpData
 	}
 
-	return d.handle(ctx, sub, h)
+	tr := dopts.Tracer
+	if tr == nil {
+		tr = trace.Noop{}
+	}
+
+	h = handlers.Chain(h, dopts.Middleware...)
+	h = d.policy(trace.Handler(tr, "digest", h), dopts)
+
+	workers := dopts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// rctx is canceled when digester is stopped or any of the workers fails.
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-d.stop:
+			cancel()
+		case <-rctx.Done():
+		}
+	}()
+
+	var (
+		once sync.Once
+		err  error
+		wg   sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer wg.Done()
+			if werr := d.handle(ctx, rctx, sub, h); werr != nil {
+				once.Do(func() {
+					err = werr
+					cancel()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return err
 }
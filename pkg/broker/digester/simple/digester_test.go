@@ -0,0 +1,262 @@
+package simple
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/digester"
+	"github.com/milosgajdos/netscrape/pkg/broker/memory"
+)
+
+const count = 10
+
+func MustBroker(t *testing.T) *memory.Memory {
+	b, err := memory.New(broker.WithCap(count))
+	if err != nil {
+		t.Fatalf("failed creating broker: %v", err)
+	}
+
+	if err := b.Open(context.Background()); err != nil {
+		t.Fatalf("failed to open broker session: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = b.Close(ctx)
+	})
+
+	return b
+}
+
+func MustSub(t *testing.T, b *memory.Memory, topic string, opts ...broker.Option) broker.Subscriber {
+	sub, err := b.Sub(context.Background(), topic, opts...)
+	if err != nil {
+		t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+	}
+
+	return sub
+}
+
+func MustPub(t *testing.T, b *memory.Memory, topic string) {
+	for i := 0; i < count; i++ {
+		msg := broker.Message{UID: fmt.Sprintf("%d", i)}
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+	}
+}
+
+// MustStop stops d once it handled n messages.
+func MustStop(t *testing.T, d *Digester, n uint64) {
+	go func() {
+		for {
+			s := d.Stats()
+			if s.Processed+s.Failed >= n {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := d.Stop(context.Background()); err != nil {
+			t.Errorf("failed to stop digester: %v", err)
+		}
+	}()
+}
+
+func TestDigest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	errHandler := errors.New("handler error")
+
+	// odd fails on messages with odd UID.
+	odd := func(ctx context.Context, m broker.Message) error {
+		var i int
+		if _, err := fmt.Sscanf(m.UID, "%d", &i); err != nil {
+			return err
+		}
+		if i%2 == 1 {
+			return errHandler
+		}
+		return nil
+	}
+
+	t.Run("Workers", func(t *testing.T) {
+		b := MustBroker(t)
+		topic := "foo"
+		sub := MustSub(t, b, topic)
+		MustPub(t, b, topic)
+
+		var active, peak int32
+		h := func(ctx context.Context, m broker.Message) error {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}
+
+		d, err := NewDigester(digester.WithHandler(h), digester.WithWorkers(4))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		MustStop(t, d, count)
+
+		if err := d.Digest(context.Background(), sub); err != nil {
+			t.Fatalf("failed digesting messages: %v", err)
+		}
+
+		if p := d.Stats().Processed; p != count {
+			t.Errorf("expected processed: %d, got: %d", count, p)
+		}
+
+		if p := atomic.LoadInt32(&peak); p < 2 {
+			t.Errorf("expected concurrent workers, got peak: %d", p)
+		}
+	})
+
+	t.Run("IdleTimeout", func(t *testing.T) {
+		b := MustBroker(t)
+		sub := MustSub(t, b, "foo")
+
+		d, err := NewDigester(digester.WithHandler(odd))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if err := d.Digest(ctx, sub, digester.WithMiddleware()); err != nil {
+			t.Fatalf("failed digesting messages: %v", err)
+		}
+	})
+
+	t.Run("BrokerClosed", func(t *testing.T) {
+		b := MustBroker(t)
+		sub := MustSub(t, b, "foo")
+
+		d, err := NewDigester(digester.WithHandler(odd), digester.WithWorkers(2))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- d.Digest(context.Background(), sub) }()
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Fatalf("failed to close broker session: %v", err)
+		}
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, broker.ErrNotConnected) {
+				t.Errorf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected digest to return once broker is closed")
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		b := MustBroker(t)
+		topic := "foo"
+		sub := MustSub(t, b, topic)
+		MustPub(t, b, topic)
+
+		d, err := NewDigester(digester.WithHandler(odd))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		if err := d.Digest(context.Background(), sub); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		if s := d.Stats(); s.Processed != 1 || s.Failed != 1 {
+			t.Errorf("expected processed: 1, failed: 1, got: %d, %d", s.Processed, s.Failed)
+		}
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		b := MustBroker(t)
+		topic := "foo"
+		sub := MustSub(t, b, topic)
+		MustPub(t, b, topic)
+
+		d, err := NewDigester(digester.WithHandler(odd), digester.WithOnError(digester.SkipOnError))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		MustStop(t, d, count)
+
+		if err := d.Digest(context.Background(), sub); err != nil {
+			t.Fatalf("failed digesting messages: %v", err)
+		}
+
+		if s := d.Stats(); s.Processed != count/2 || s.Skipped != count/2 {
+			t.Errorf("expected processed: %d, skipped: %d, got: %d, %d", count/2, count/2, s.Processed, s.Skipped)
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		b := MustBroker(t)
+		topic, dlq := "foo", "foo.dlq"
+		sub := MustSub(t, b, topic)
+		dlqSub := MustSub(t, b, dlq)
+		MustPub(t, b, topic)
+
+		d, err := NewDigester(digester.WithHandler(odd), digester.WithDeadLetter(b, dlq))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		MustStop(t, d, count)
+
+		if err := d.Digest(context.Background(), sub); err != nil {
+			t.Fatalf("failed digesting messages: %v", err)
+		}
+
+		if s := d.Stats(); s.DeadLettered != count/2 {
+			t.Errorf("expected dead-lettered: %d, got: %d", count/2, s.DeadLettered)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			if m.Attrs[digester.ErrorAttr] != errHandler.Error() {
+				return fmt.Errorf("expected error attribute: %s, got: %s", errHandler, m.Attrs[digester.ErrorAttr])
+			}
+			return nil
+		}
+
+		if err := dlqSub.Receive(context.Background(), h); err != nil {
+			t.Errorf("failed receiving dead-letter message: %v", err)
+		}
+	})
+
+	t.Run("NoDeadLetter", func(t *testing.T) {
+		b := MustBroker(t)
+		sub := MustSub(t, b, "foo")
+
+		d, err := NewDigester(digester.WithOnError(digester.DeadLetterOnError))
+		if err != nil {
+			t.Fatalf("failed creating digester: %v", err)
+		}
+
+		if err := d.Digest(context.Background(), sub); !errors.Is(err, digester.ErrNoDeadLetter) {
+			t.Errorf("expected error: %v, got: %v", digester.ErrNoDeadLetter, err)
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package broker
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrNotImplemented is returned when requesting unimplemented functionality.
@@ -13,4 +16,52 @@ var (
 	ErrTopicNotExist = errors.New("ErrTopicNotExist")
 	// ErrTimeout is returned when publish or subscribe operations timed out
 	ErrTimeout = errors.New("ErrTimeout")
+	// ErrInvalidTopic is returned when publishing or subscribing to malformed topic
+	ErrInvalidTopic = errors.New("ErrInvalidTopic")
+	// ErrNotInFlight is returned when acknowledging message which is not awaiting acknowledgement
+	ErrNotInFlight = errors.New("ErrNotInFlight")
+	// ErrQueueFull is returned when publishing to full topic queue with Reject overflow policy
+	ErrQueueFull = errors.New("ErrQueueFull")
+	// ErrSinkConflict is returned when sink option conflicts with the sink of existing topic
+	ErrSinkConflict = errors.New("ErrSinkConflict")
+	// ErrUndelivered is returned when broker is closed before delivering all messages
+	ErrUndelivered = errors.New("ErrUndelivered")
 )
+
+// BulkPubError is returned when BulkPub fails to publish all messages.
+// Messages are published in order, so the first Published messages
+// were accepted by broker before Err stopped the bulk publish.
+type BulkPubError struct {
+	// Published is the number of published messages.
+	Published int
+	// Err is the error which stopped the bulk publish.
+	Err error
+}
+
+// Error implements error interface.
+func (e *BulkPubError) Error() string {
+	return fmt.Sprintf("published %d messages: %v", e.Published, e.Err)
+}
+
+// Unwrap returns the error which stopped the bulk publish.
+func (e *BulkPubError) Unwrap() error {
+	return e.Err
+}
+
+// DrainError is returned when broker is closed before all messages were delivered.
+type DrainError struct {
+	// Undelivered is the number of undelivered messages.
+	Undelivered int
+	// Err is the error which stopped draining the broker.
+	Err error
+}
+
+// Error implements error interface.
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("%d messages undelivered: %v", e.Undelivered, e.Err)
+}
+
+// Unwrap returns the error which stopped draining the broker.
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,10 @@
+package file
+
+import "errors"
+
+var (
+	// ErrCorruptLog is returned when topic log contains corrupt records.
+	ErrCorruptLog = errors.New("ErrCorruptLog")
+	// ErrOffsetOutOfRange is returned when seeking to offset beyond the end of topic log.
+	ErrOffsetOutOfRange = errors.New("ErrOffsetOutOfRange")
+)
@@ -0,0 +1,319 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+)
+
+const (
+	// DefaultSegmentSize is the default max size of topic log segments.
+	DefaultSegmentSize = 16 * 1024 * 1024
+	// DefaultTimeout is default receive timeout.
+	DefaultTimeout = 5 * time.Second
+	// DefaultAckTimeout is default timeout for manual message acks.
+	DefaultAckTimeout = 30 * time.Second
+	// DefaultMaxAttempts is default max number of delivery attempts.
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is default base redelivery backoff.
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultGroup is the consumer group of FanIn subscribers with no group.
+	DefaultGroup = "default"
+)
+
+// File is a durable broker which stores topic messages in segmented logs on disk.
+// Every topic is stored in its own directory; consumer group offsets are stored
+// alongside the topic log so consumers can resume where they stopped after restart.
+// File broker must not be shared by multiple processes.
+type File struct {
+	sync.RWMutex
+	dir       string
+	opts      Options
+	sink      broker.Sink
+	connected bool
+	topics    map[string]*topicLog
+	groups    map[string]map[string]*group
+	exit      chan struct{}
+}
+
+// New creates a new file broker storing data in dir and returns it.
+func New(dir string, opts ...Option) (*File, error) {
+	fopts := Options{
+		SegmentSize: DefaultSegmentSize,
+	}
+	for _, apply := range opts {
+		apply(&fopts)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &File{
+		dir:    dir,
+		opts:   fopts,
+		topics: make(map[string]*topicLog),
+		groups: make(map[string]map[string]*group),
+	}, nil
+}
+
+// Open opens a new broker session.
+func (f *File) Open(ctx context.Context, opts ...broker.Option) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.connected {
+		return nil
+	}
+
+	bopts := broker.Options{}
+	for _, apply := range opts {
+		apply(&bopts)
+	}
+
+	f.sink = bopts.Sink
+	f.exit = make(chan struct{})
+	f.connected = true
+
+	return nil
+}
+
+// topicDir returns topic log directory.
+func (f *File) topicDir(topic string) string {
+	return filepath.Join(f.dir, topic)
+}
+
+// topic returns topic log, opening it if necessary.
+func (f *File) topic(name string) (*topicLog, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return nil, broker.ErrInvalidTopic
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.connected {
+		return nil, broker.ErrNotConnected
+	}
+
+	l, ok := f.topics[name]
+	if !ok {
+		var err error
+		l, err = openLog(f.topicDir(name), f.opts.SegmentSize, f.opts.Sync)
+		if err != nil {
+			return nil, err
+		}
+		f.topics[name] = l
+	}
+
+	return l, nil
+}
+
+// Pub appends msg to the given topic log.
+// If the topic does not exist, it is automatically created.
+// Messages published without UID are assigned a new one.
+func (f *File) Pub(ctx context.Context, topic string, msg broker.Message, opts ...broker.Option) error {
+	return f.BulkPub(ctx, topic, []broker.Message{msg}, opts...)
+}
+
+// BulkPub appends messages in mx to the given topic log.
+// If not all messages could be published BulkPub returns *broker.BulkPubError
+// which reports how many messages were published before the failure.
+func (f *File) BulkPub(ctx context.Context, topic string, mx []broker.Message, opts ...broker.Option) error {
+	if err := broker.ValidTopic(topic); err != nil {
+		return err
+	}
+
+	l, err := f.topic(topic)
+	if err != nil {
+		return err
+	}
+
+	msgs := make([]broker.Message, len(mx))
+	for i, msg := range mx {
+		if msg.UID == "" {
+			msg.UID = memuid.New().String()
+		}
+		msgs[i] = msg
+	}
+
+	n, err := l.append(msgs...)
+	if err != nil {
+		if len(mx) == 1 {
+			return err
+		}
+		return &broker.BulkPubError{Published: n, Err: err}
+	}
+
+	return nil
+}
+
+// group returns topic consumer group with the given name, creating it if necessary.
+// Groups with empty name are ephemeral: they are owned by the subscriber with the
+// given id and their offsets are not stored.
+func (f *File) group(topic, name, id string, l *topicLog) (*group, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if _, ok := f.groups[topic]; !ok {
+		f.groups[topic] = make(map[string]*group)
+	}
+
+	key, path := id, ""
+	if name != "" {
+		key, path = name, filepath.Join(f.topicDir(topic), offsetsDir, name)
+	}
+
+	if g, ok := f.groups[topic][key]; ok {
+		return g, nil
+	}
+
+	g, err := newGroup(name, path, l, f)
+	if err != nil {
+		return nil, err
+	}
+	f.groups[topic][key] = g
+
+	return g, nil
+}
+
+// removeGroup closes and removes ephemeral group owned by subscriber with the given id.
+func (f *File) removeGroup(topic, id string) error {
+	f.Lock()
+	g, ok := f.groups[topic][id]
+	delete(f.groups[topic], id)
+	f.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return g.close()
+}
+
+// Sub subscribes to the given topic.
+// If the topic does not exist, it is automatically created.
+// Subscribers in the same consumer group share topic offset, so every
+// message is delivered to exactly one of them. FanIn subscribers without
+// group join DefaultGroup; FanOut subscribers without group read the whole
+// topic log from the beginning and don't store their offsets.
+// Messages are delivered in order: a group delivers the next message only once
+// the previous one has been acked, or rejected max attempts times.
+// Wildcard subscriptions are not supported.
+func (f *File) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
+	f.RLock()
+	sink := f.sink
+	f.RUnlock()
+
+	sopts := broker.Options{
+		Sink: sink,
+	}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	if err := broker.ValidPattern(topic); err != nil {
+		return nil, err
+	}
+
+	if broker.IsPattern(topic) {
+		return nil, broker.ErrNotImplemented
+	}
+
+	if sopts.AckTimeout == 0 {
+		sopts.AckTimeout = DefaultAckTimeout
+	}
+
+	if sopts.MaxAttempts == 0 {
+		sopts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if sopts.Backoff == nil {
+		sopts.Backoff = broker.ExponentialBackoff(DefaultBackoff, DefaultTimeout)
+	}
+
+	if sopts.Group == "" && sopts.Sink == broker.FanIn {
+		sopts.Group = DefaultGroup
+	}
+
+	l, err := f.topic(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	id := memuid.New().String()
+
+	g, err := f.group(topic, sopts.Group, id, l)
+	if err != nil {
+		return nil, err
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+
+	return &Subscriber{
+		id:     id,
+		topic:  topic,
+		active: true,
+		opts:   sopts,
+		group:  g,
+		log:    l,
+		broker: f,
+		done:   f.exit,
+		exit:   make(chan struct{}),
+	}, nil
+}
+
+// Close closes broker session.
+// Messages are appended to topic logs synchronously so there
+// is nothing to drain and Close returns without waiting for ctx.
+func (f *File) Close(ctx context.Context) error {
+	f.Lock()
+
+	if !f.connected {
+		f.Unlock()
+		return nil
+	}
+
+	close(f.exit)
+
+	var groups []*group
+	for topic, gx := range f.groups {
+		for _, g := range gx {
+			groups = append(groups, g)
+		}
+		delete(f.groups, topic)
+	}
+
+	var logs []*topicLog
+	for topic, l := range f.topics {
+		logs = append(logs, l)
+		delete(f.topics, topic)
+	}
+
+	f.connected = false
+	f.Unlock()
+
+	// NOTE: groups must be closed without holding broker lock
+	// as they might be publishing on dead-letter topics.
+	var err error
+	for _, g := range groups {
+		if gerr := g.close(); gerr != nil && err == nil {
+			err = gerr
+		}
+	}
+
+	for _, l := range logs {
+		if lerr := l.close(); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+
+	return err
+}
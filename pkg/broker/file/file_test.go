@@ -0,0 +1,248 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+func MustDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "netscrape-broker")
+	if err != nil {
+		t.Fatalf("failed creating broker dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+func MustBroker(t *testing.T, dir string, opts ...Option) *File {
+	b, err := New(dir, opts...)
+	if err != nil {
+		t.Fatalf("failed creating broker: %v", err)
+	}
+
+	if err := b.Open(context.Background()); err != nil {
+		t.Fatalf("failed to open broker session: %v", err)
+	}
+
+	return b
+}
+
+func MustSub(t *testing.T, b *File, topic string, opts ...broker.Option) *Subscriber {
+	sub, err := b.Sub(context.Background(), topic, opts...)
+	if err != nil {
+		t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+	}
+
+	return sub.(*Subscriber)
+}
+
+func MustMessages(t *testing.T, b *File, topic string, count int) []broker.Message {
+	mx := make([]broker.Message, count)
+	for i := range mx {
+		mx[i] = broker.Message{
+			UID:  fmt.Sprintf("msg%d", i),
+			Data: []byte(fmt.Sprintf("data%d", i)),
+		}
+	}
+
+	if err := b.BulkPub(context.Background(), topic, mx); err != nil {
+		t.Fatalf("failed to publish messages: %v", err)
+	}
+
+	return mx
+}
+
+func MustReceive(t *testing.T, sub broker.Subscriber, exp broker.Message) {
+	h := func(ctx context.Context, m broker.Message) error {
+		if m.UID != exp.UID {
+			return fmt.Errorf("expected msg ID: %s, got: %s", exp.UID, m.UID)
+		}
+		return nil
+	}
+
+	if err := sub.Receive(context.Background(), h); err != nil {
+		t.Fatalf("failed receiving message: %v", err)
+	}
+}
+
+func TestPub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+	msg := broker.Message{
+		UID:  "fooID",
+		Data: []byte(`foo data`),
+	}
+
+	t.Run("Publish", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("InvalidTopic", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+
+		for _, topic := range []string{"foo.*", "foo/bar", "../foo"} {
+			if err := b.Pub(context.Background(), topic, msg); !errors.Is(err, broker.ErrInvalidTopic) {
+				t.Errorf("topic %q: expected error: %v, got: %v", topic, broker.ErrInvalidTopic, err)
+			}
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("PublishNotConnected", func(t *testing.T) {
+		b, err := New(MustDir(t))
+		if err != nil {
+			t.Fatalf("failed creating broker: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); !errors.Is(err, broker.ErrNotConnected) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+}
+
+func TestSegments(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir := MustDir(t)
+	topic := "foo"
+
+	b := MustBroker(t, dir, WithSegmentSize(64))
+	mx := MustMessages(t, b, topic, 10)
+
+	segments, err := filepath.Glob(filepath.Join(dir, topic, "*"+segmentExt))
+	if err != nil {
+		t.Fatalf("failed listing segments: %v", err)
+	}
+
+	if len(segments) < 2 {
+		t.Errorf("expected multiple segments, got: %d", len(segments))
+	}
+
+	sub := MustSub(t, b, topic)
+	for _, msg := range mx {
+		MustReceive(t, sub, msg)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("failed to close broker session: %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir := MustDir(t)
+	topic, group := "foo", "digester"
+
+	b := MustBroker(t, dir, WithSegmentSize(64))
+	mx := MustMessages(t, b, topic, 5)
+
+	sub := MustSub(t, b, topic, broker.WithGroup(group))
+	MustReceive(t, sub, mx[0])
+	MustReceive(t, sub, mx[1])
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close broker session: %v", err)
+	}
+
+	b = MustBroker(t, dir, WithSegmentSize(64))
+	sub = MustSub(t, b, topic, broker.WithGroup(group))
+
+	offset, err := sub.Offset(context.Background())
+	if err != nil {
+		t.Fatalf("failed to read offset: %v", err)
+	}
+
+	if exp := int64(2); offset != exp {
+		t.Errorf("expected offset: %d, got: %d", exp, offset)
+	}
+
+	for _, msg := range mx[2:] {
+		MustReceive(t, sub, msg)
+	}
+
+	t.Run("Seek", func(t *testing.T) {
+		if err := sub.Seek(context.Background(), 1); err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+
+		MustReceive(t, sub, mx[1])
+
+		if err := sub.Seek(context.Background(), int64(len(mx)+1)); !errors.Is(err, ErrOffsetOutOfRange) {
+			t.Errorf("expected error: %v, got: %v", ErrOffsetOutOfRange, err)
+		}
+	})
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("failed to close broker session: %v", err)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir := MustDir(t)
+	topic := "foo"
+
+	b := MustBroker(t, dir)
+	mx := MustMessages(t, b, topic, 2)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close broker session: %v", err)
+	}
+
+	// NOTE: simulate a record torn by crash
+	f, err := os.OpenFile(segmentPath(filepath.Join(dir, topic), 0), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed opening segment: %v", err)
+	}
+
+	if _, err := f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0}); err != nil {
+		t.Fatalf("failed writing segment: %v", err)
+	}
+	f.Close()
+
+	b = MustBroker(t, dir)
+
+	msg := broker.Message{UID: "fooID"}
+	if err := b.Pub(context.Background(), topic, msg); err != nil {
+		t.Fatalf("failed to publish message: %v", err)
+	}
+
+	sub := MustSub(t, b, topic)
+	for _, msg := range append(mx, msg) {
+		MustReceive(t, sub, msg)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("failed to close broker session: %v", err)
+	}
+}
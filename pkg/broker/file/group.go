@@ -0,0 +1,278 @@
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+const (
+	// offsetsDir is the name of topic directory storing group offsets.
+	offsetsDir = "offsets"
+)
+
+// group is a consumer group reading topic log.
+// Group delivers topic messages one at a time: the next message
+// is delivered only when the current one has been acked or dropped.
+type group struct {
+	sync.Mutex
+	name   string
+	path   string
+	reader *reader
+	broker *File
+	// committed is the offset of the current message.
+	committed int64
+	// current is the message at committed offset.
+	current *broker.Message
+	// attempt is the delivery attempt of the current message.
+	attempt int
+	// inflight is true if the current message awaits ack.
+	inflight bool
+	// owner is the ID of subscriber the inflight message was delivered to.
+	owner string
+	// deadline is the ack deadline of the inflight message.
+	deadline time.Time
+	// retryAt is the earliest time the current message can be redelivered.
+	retryAt time.Time
+	// notify is closed whenever group state changes.
+	notify chan struct{}
+}
+
+// newGroup creates a new consumer group of log l and returns it.
+// If path is not empty, group offset is read from and committed to path.
+func newGroup(name, path string, l *topicLog, f *File) (*group, error) {
+	offset := int64(0)
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			offset, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				return nil, ErrCorruptLog
+			}
+		}
+		// NOTE: log tail might have been truncated on recovery
+		if next := l.next(); offset > next {
+			offset = next
+		}
+	}
+
+	r, err := newReader(l, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group{
+		name:      name,
+		path:      path,
+		reader:    r,
+		broker:    f,
+		committed: offset,
+		notify:    make(chan struct{}),
+	}, nil
+}
+
+// changes returns a channel which is closed when group state changes.
+func (g *group) changes() <-chan struct{} {
+	g.Lock()
+	defer g.Unlock()
+
+	return g.notify
+}
+
+// changed notifies waiting subscribers about group state change.
+// NOTE: this must be called with the group lock held.
+func (g *group) changed() {
+	close(g.notify)
+	g.notify = make(chan struct{})
+}
+
+// commit commits group offset.
+// NOTE: this must be called with the group lock held.
+func (g *group) commit(offset int64) error {
+	g.committed = offset
+
+	if g.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := g.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, g.path)
+}
+
+// advance moves group past the current message.
+// NOTE: this must be called with the group lock held.
+func (g *group) advance() error {
+	g.current = nil
+	g.attempt = 0
+	g.retryAt = time.Time{}
+
+	return g.commit(g.committed + 1)
+}
+
+// reject rejects the inflight message. The message is either scheduled
+// for redelivery or, if it's been delivered max attempts times, published
+// on the dead-letter topic and skipped.
+// NOTE: this must be called with the group lock held.
+func (g *group) reject(ctx context.Context, opts broker.Options) error {
+	g.inflight = false
+	g.owner = ""
+	defer g.changed()
+
+	if opts.MaxAttempts > 0 && g.attempt >= opts.MaxAttempts {
+		if opts.DeadLetter != "" {
+			if err := g.broker.Pub(ctx, opts.DeadLetter, *g.current); err != nil {
+				return err
+			}
+		}
+		return g.advance()
+	}
+
+	g.retryAt = time.Now().Add(opts.Backoff(g.attempt))
+
+	return nil
+}
+
+// next returns the next message to deliver to subscriber with the given id.
+// If no message can be delivered, it returns nil message and either the time
+// to wait before trying again, or zero if there are no messages to deliver.
+func (g *group) next(ctx context.Context, id string, opts broker.Options) (*broker.Message, time.Duration, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	now := time.Now()
+
+	if g.inflight {
+		if now.Before(g.deadline) {
+			return nil, g.deadline.Sub(now), nil
+		}
+		if err := g.reject(ctx, opts); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if now.Before(g.retryAt) {
+		return nil, g.retryAt.Sub(now), nil
+	}
+
+	if g.current == nil {
+		rec, err := g.reader.next()
+		if err != nil {
+			if err == errEndOfLog {
+				return nil, 0, nil
+			}
+			return nil, 0, err
+		}
+		g.current = &rec.msg
+	}
+
+	g.attempt++
+	g.inflight = true
+	g.owner = id
+	g.deadline = now.Add(opts.AckTimeout)
+
+	msg := *g.current
+	msg.Attempt = g.attempt
+
+	return &msg, 0, nil
+}
+
+// isInflight returns true if msg is the inflight message.
+// NOTE: this must be called with the group lock held.
+func (g *group) isInflight(msg broker.Message) bool {
+	return g.inflight && g.current.UID == msg.UID && g.attempt == msg.Attempt
+}
+
+// ack acknowledges msg and commits the group offset.
+func (g *group) ack(msg broker.Message) error {
+	g.Lock()
+	defer g.Unlock()
+
+	if !g.isInflight(msg) {
+		return broker.ErrNotInFlight
+	}
+
+	g.inflight = false
+	g.owner = ""
+	defer g.changed()
+
+	return g.advance()
+}
+
+// nack rejects msg.
+func (g *group) nack(ctx context.Context, msg broker.Message, opts broker.Options) error {
+	g.Lock()
+	defer g.Unlock()
+
+	if !g.isInflight(msg) {
+		return broker.ErrNotInFlight
+	}
+
+	return g.reject(ctx, opts)
+}
+
+// release makes the message inflight to subscriber with the given id
+// available for immediate redelivery to other group subscribers.
+func (g *group) release(id string) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.inflight && g.owner == id {
+		g.inflight = false
+		g.owner = ""
+		g.changed()
+	}
+}
+
+// seek moves group to the given offset and commits it.
+func (g *group) seek(offset int64) error {
+	g.Lock()
+	defer g.Unlock()
+
+	if err := g.reader.seek(offset); err != nil {
+		return err
+	}
+
+	g.current = nil
+	g.attempt = 0
+	g.inflight = false
+	g.owner = ""
+	g.retryAt = time.Time{}
+	defer g.changed()
+
+	return g.commit(offset)
+}
+
+// offset returns the committed group offset.
+func (g *group) offset() int64 {
+	g.Lock()
+	defer g.Unlock()
+
+	return g.committed
+}
+
+// close closes group.
+func (g *group) close() error {
+	g.Lock()
+	defer g.Unlock()
+
+	return g.reader.close()
+}
@@ -0,0 +1,478 @@
+package file
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+const (
+	// headerSize is the size of record header:
+	// 8 bytes offset, 4 bytes payload length, 4 bytes payload checksum.
+	headerSize = 16
+	// segmentExt is log segment file extension.
+	segmentExt = ".log"
+)
+
+// errEndOfLog is returned when reading past the last log record.
+var errEndOfLog = errors.New("end of log")
+
+// segment is a topic log segment.
+type segment struct {
+	// base is the offset of the first segment record.
+	base int64
+	// next is the offset of the next segment record.
+	next int64
+	// size is the segment size in bytes.
+	size int64
+	// path is the segment file path.
+	path string
+}
+
+// segmentPath returns the path of segment with the given base offset.
+func segmentPath(dir string, base int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+// record is an encoded log record.
+type record struct {
+	offset int64
+	msg    broker.Message
+}
+
+// encode encodes msg stored at the given offset into log record.
+func encode(offset int64, msg broker.Message) ([]byte, error) {
+	msg.Attempt = 0
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint64(buf[0:8], uint64(offset))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(payload))
+	copy(buf[headerSize:], payload)
+
+	return buf, nil
+}
+
+// decode reads the next log record from r.
+// It returns io.EOF if there are no more records in r and
+// ErrCorruptLog if the record is either incomplete or damaged.
+func decode(r io.Reader) (*record, int64, error) {
+	header := make([]byte, headerSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, ErrCorruptLog
+	}
+
+	offset := int64(binary.BigEndian.Uint64(header[0:8]))
+	size := binary.BigEndian.Uint32(header[8:12])
+	sum := binary.BigEndian.Uint32(header[12:16])
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, ErrCorruptLog
+	}
+
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, 0, ErrCorruptLog
+	}
+
+	var msg broker.Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, 0, ErrCorruptLog
+	}
+
+	return &record{offset: offset, msg: msg}, int64(headerSize) + int64(size), nil
+}
+
+// scan scans all records in segment s and updates its next offset and size.
+// If truncate is true, incomplete or damaged records at the end of the segment
+// are truncated, otherwise ErrCorruptLog is returned when they're found.
+func (s *segment) scan(truncate bool) error {
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := &countReader{r: f}
+	next, size := s.base, int64(0)
+
+	for {
+		rec, n, err := decode(r)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && rec.offset != next {
+			err = ErrCorruptLog
+		}
+		if err != nil {
+			if !truncate {
+				return err
+			}
+			if err := f.Truncate(size); err != nil {
+				return err
+			}
+			break
+		}
+		next, size = next+1, size+n
+	}
+
+	s.next, s.size = next, size
+
+	return nil
+}
+
+// countReader counts bytes read from the underlying reader.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// segmentFile is the file of active log segment.
+type segmentFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// topicLog is an append-only log of topic messages split into segments.
+type topicLog struct {
+	sync.RWMutex
+	dir      string
+	segSize  int64
+	sync     bool
+	segments []*segment
+	active   segmentFile
+	// notify is closed whenever new records are appended.
+	notify chan struct{}
+}
+
+// openLog opens topic log stored in dir and returns it.
+// If dir contains no log segments a new empty log is created.
+// Incomplete records at the end of log segments left behind by crashes
+// or failed writes are truncated.
+func openLog(dir string, segSize int64, sync bool) (*topicLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []*segment
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentExt) {
+			continue
+		}
+		var base int64
+		if _, err := fmt.Sscanf(f.Name(), "%020d"+segmentExt, &base); err != nil {
+			continue
+		}
+		segments = append(segments, &segment{base: base, path: filepath.Join(dir, f.Name())})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].base < segments[j].base
+	})
+
+	if len(segments) == 0 {
+		segments = append(segments, &segment{base: 0, path: segmentPath(dir, 0)})
+		f, err := os.OpenFile(segments[0].path, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+	}
+
+	for i, s := range segments {
+		if err := s.scan(true); err != nil {
+			return nil, err
+		}
+		if i < len(segments)-1 && s.next != segments[i+1].base {
+			return nil, ErrCorruptLog
+		}
+	}
+
+	active, err := os.OpenFile(segments[len(segments)-1].path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &topicLog{
+		dir:      dir,
+		segSize:  segSize,
+		sync:     sync,
+		segments: segments,
+		active:   active,
+		notify:   make(chan struct{}),
+	}, nil
+}
+
+// next returns the offset of the next log record.
+func (l *topicLog) next() int64 {
+	l.RLock()
+	defer l.RUnlock()
+
+	return l.segments[len(l.segments)-1].next
+}
+
+// changed returns a channel which is closed when new records are appended.
+func (l *topicLog) changed() <-chan struct{} {
+	l.RLock()
+	defer l.RUnlock()
+
+	return l.notify
+}
+
+// roll starts a new active log segment.
+// NOTE: this must be called with the log lock held.
+func (l *topicLog) roll() error {
+	last := l.segments[len(l.segments)-1]
+
+	s := &segment{
+		base: last.next,
+		next: last.next,
+		path: segmentPath(l.dir, last.next),
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := l.active.Close(); err != nil {
+		f.Close()
+		return err
+	}
+
+	l.active = f
+	l.segments = append(l.segments, s)
+
+	return nil
+}
+
+// append appends messages in mx to the log.
+// It returns the number of appended messages.
+func (l *topicLog) append(mx ...broker.Message) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.active == nil {
+		return 0, broker.ErrNotConnected
+	}
+
+	n := 0
+	defer func() {
+		if n > 0 {
+			close(l.notify)
+			l.notify = make(chan struct{})
+		}
+	}()
+
+	for _, msg := range mx {
+		s := l.segments[len(l.segments)-1]
+
+		if l.segSize > 0 && s.size >= l.segSize {
+			if err := l.roll(); err != nil {
+				return n, err
+			}
+			s = l.segments[len(l.segments)-1]
+		}
+
+		buf, err := encode(s.next, msg)
+		if err != nil {
+			return n, err
+		}
+
+		if _, err := l.active.Write(buf); err != nil {
+			return n, l.discard(s, err)
+		}
+
+		s.next++
+		s.size += int64(len(buf))
+		n++
+	}
+
+	if l.sync {
+		if err := l.active.Sync(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// discard discards the record partially written to the active segment s
+// when writing it failed with err and returns err. The segment is truncated
+// back to its size; if it can't be truncated the log is rolled to a new
+// segment so no records are ever appended after the partial record.
+// If the log can't be rolled either it's closed.
+// NOTE: this must be called with the log lock held.
+func (l *topicLog) discard(s *segment, err error) error {
+	if terr := l.active.Truncate(s.size); terr == nil {
+		return err
+	}
+
+	if rerr := l.roll(); rerr != nil {
+		l.active.Close()
+		l.active = nil
+		return fmt.Errorf("%w: failed to roll segment: %v", err, rerr)
+	}
+
+	return err
+}
+
+// segment returns segment which contains record with the given offset.
+func (l *topicLog) segment(offset int64) *segment {
+	l.RLock()
+	defer l.RUnlock()
+
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].next > offset
+	})
+	if i == len(l.segments) {
+		i--
+	}
+
+	s := *l.segments[i]
+	return &s
+}
+
+// close closes the log.
+func (l *topicLog) close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.active == nil {
+		return nil
+	}
+
+	err := l.active.Close()
+	l.active = nil
+
+	return err
+}
+
+// reader reads log records sequentially.
+type reader struct {
+	log *topicLog
+	seg *segment
+	f   *os.File
+	// offset is the offset of the next record.
+	offset int64
+}
+
+// newReader creates a new log reader positioned at offset and returns it.
+func newReader(l *topicLog, offset int64) (*reader, error) {
+	r := &reader{log: l}
+	if err := r.seek(offset); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// seek positions reader at record with the given offset.
+func (r *reader) seek(offset int64) error {
+	if offset < 0 || offset > r.log.next() {
+		return ErrOffsetOutOfRange
+	}
+
+	if err := r.close(); err != nil {
+		return err
+	}
+
+	s := r.log.segment(offset)
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+
+	r.seg, r.f, r.offset = s, f, s.base
+
+	for r.offset < offset {
+		if _, err := r.next(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// next reads the next log record.
+// It returns errEndOfLog if there are no more records in the log.
+func (r *reader) next() (*record, error) {
+	if r.offset >= r.log.next() {
+		return nil, errEndOfLog
+	}
+
+	for r.offset >= r.seg.next {
+		s := r.log.segment(r.offset)
+		if s.base != r.offset {
+			// NOTE: active segment is still being written to
+			if s.base == r.seg.base {
+				r.seg = s
+				break
+			}
+			return nil, ErrCorruptLog
+		}
+		f, err := os.Open(s.path)
+		if err != nil {
+			return nil, err
+		}
+		r.f.Close()
+		r.seg, r.f = s, f
+	}
+
+	rec, _, err := decode(r.f)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrCorruptLog
+		}
+		return nil, err
+	}
+
+	if rec.offset != r.offset {
+		return nil, ErrCorruptLog
+	}
+	r.offset++
+
+	return rec, nil
+}
+
+// close closes reader.
+func (r *reader) close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
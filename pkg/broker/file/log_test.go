@@ -0,0 +1,121 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+var errWrite = errors.New("write error")
+
+// failingFile writes half of the first write and fails it.
+// It fails to truncate if truncate is false.
+type failingFile struct {
+	segmentFile
+	failed   bool
+	truncate bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.failed {
+		return f.segmentFile.Write(p)
+	}
+	f.failed = true
+
+	n, err := f.segmentFile.Write(p[:len(p)/2])
+	if err != nil {
+		return n, err
+	}
+	return n, errWrite
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if !f.truncate {
+		return errWrite
+	}
+	return f.segmentFile.Truncate(size)
+}
+
+func MustLog(t *testing.T, dir string) *topicLog {
+	l, err := openLog(dir, 0, false)
+	if err != nil {
+		t.Fatalf("failed opening log: %v", err)
+	}
+
+	return l
+}
+
+func MustRecords(t *testing.T, l *topicLog, count int) {
+	r, err := newReader(l, 0)
+	if err != nil {
+		t.Fatalf("failed creating reader: %v", err)
+	}
+	defer r.close()
+
+	for i := 0; i < count; i++ {
+		rec, err := r.next()
+		if err != nil {
+			t.Fatalf("failed reading record %d: %v", i, err)
+		}
+
+		if uid := fmt.Sprintf("msg%d", i); rec.msg.UID != uid {
+			t.Errorf("expected msg ID: %s, got: %s", uid, rec.msg.UID)
+		}
+	}
+
+	if _, err := r.next(); !errors.Is(err, errEndOfLog) {
+		t.Errorf("expected error: %v, got: %v", errEndOfLog, err)
+	}
+}
+
+func TestAppendWriteError(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	for _, truncate := range []bool{true, false} {
+		truncate := truncate
+
+		t.Run(fmt.Sprintf("Truncate=%t", truncate), func(t *testing.T) {
+			dir := filepath.Join(MustDir(t), "foo")
+			l := MustLog(t, dir)
+
+			if _, err := l.append(broker.Message{UID: "msg0"}); err != nil {
+				t.Fatalf("failed appending message: %v", err)
+			}
+
+			l.active = &failingFile{segmentFile: l.active, truncate: truncate}
+
+			if n, err := l.append(broker.Message{UID: "fooID"}); n != 0 || !errors.Is(err, errWrite) {
+				t.Fatalf("expected error: %v, got: %d, %v", errWrite, n, err)
+			}
+
+			if _, err := l.append(broker.Message{UID: "msg1"}); err != nil {
+				t.Fatalf("failed appending message: %v", err)
+			}
+
+			MustRecords(t, l, 2)
+
+			segments := 1
+			if !truncate {
+				segments = 2
+			}
+
+			if len(l.segments) != segments {
+				t.Errorf("expected segments: %d, got: %d", segments, len(l.segments))
+			}
+
+			if err := l.close(); err != nil {
+				t.Fatalf("failed closing log: %v", err)
+			}
+
+			l = MustLog(t, dir)
+			defer l.close()
+
+			MustRecords(t, l, 2)
+		})
+	}
+}
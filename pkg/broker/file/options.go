@@ -0,0 +1,26 @@
+package file
+
+// Options configure file broker.
+type Options struct {
+	// SegmentSize configures max size of topic log segments in bytes.
+	SegmentSize int64
+	// Sync configures syncing topic logs to disk after every publish.
+	Sync bool
+}
+
+// Option is functional file broker option.
+type Option func(*Options)
+
+// WithSegmentSize sets SegmentSize option.
+func WithSegmentSize(s int64) Option {
+	return func(o *Options) {
+		o.SegmentSize = s
+	}
+}
+
+// WithSync sets Sync option.
+func WithSync() Option {
+	return func(o *Options) {
+		o.Sync = true
+	}
+}
@@ -0,0 +1,166 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+// Subscriber is file broker subscriber.
+type Subscriber struct {
+	sync.RWMutex
+	id     string
+	topic  string
+	active bool
+	opts   broker.Options
+	group  *group
+	log    *topicLog
+	broker *File
+	done   <-chan struct{}
+	exit   chan struct{}
+}
+
+// ID returns subscriber ID
+func (s *Subscriber) ID(ctx context.Context) (string, error) {
+	return s.id, nil
+}
+
+// Topic returns subscription topic.
+func (s *Subscriber) Topic(ctx context.Context, opts ...broker.Option) (string, error) {
+	return s.topic, nil
+}
+
+// Offset returns the committed offset of subscriber consumer group.
+func (s *Subscriber) Offset(ctx context.Context) (int64, error) {
+	return s.group.offset(), nil
+}
+
+// Seek moves subscriber consumer group to the given offset.
+// Messages are delivered starting from the message at offset.
+func (s *Subscriber) Seek(ctx context.Context, offset int64) error {
+	return s.group.seek(offset)
+}
+
+// Unsubscribe unsubscribes from the topic.
+// The message inflight to the subscriber is redelivered to other group subscribers.
+func (s *Subscriber) Unsubscribe(ctx context.Context, opts ...broker.Option) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	close(s.exit)
+	s.active = false
+
+	s.group.release(s.id)
+
+	if s.opts.Group == "" {
+		return s.broker.removeGroup(s.topic, s.id)
+	}
+
+	return nil
+}
+
+// Ack acknowledges the message has been processed.
+func (s *Subscriber) Ack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	return s.group.ack(msg)
+}
+
+// Nack rejects the message so it is redelivered after backoff.
+// Once the message has been delivered max attempts times it is published
+// on the dead-letter topic, or dropped if no dead-letter topic is configured.
+func (s *Subscriber) Nack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	return s.group.nack(ctx, msg, s.opts)
+}
+
+// Receive processes received messages with handler.
+// Messages are acked when h succeeds and nacked when it fails,
+// unless manual ack is enabled, in which case h is responsible
+// for acking the message before ack timeout expires.
+// Receive returns broker.ErrNotConnected once the broker is closed
+// and broker.ErrSubscriptionInactive once the subscriber unsubscribes.
+// NOTE: Receive is a blocking call!
+func (s *Subscriber) Receive(ctx context.Context, h broker.Handler, opts ...broker.Option) error {
+	ropts := broker.Options{}
+	for _, apply := range opts {
+		apply(&ropts)
+	}
+
+	recvTimeout := ropts.RecvTimeout
+	if recvTimeout == 0 {
+		recvTimeout = DefaultTimeout
+	}
+
+	s.RLock()
+	if !s.active {
+		s.RUnlock()
+		return broker.ErrSubscriptionInactive
+	}
+	s.RUnlock()
+
+	timeout := time.NewTimer(recvTimeout)
+	defer timeout.Stop()
+
+	for {
+		// NOTE: we must grab the change notifications
+		// before checking for new messages to avoid missing them
+		groupChanged, logChanged := s.group.changes(), s.log.changed()
+
+		select {
+		case <-s.done:
+			return broker.ErrNotConnected
+		default:
+		}
+
+		msg, wait, err := s.group.next(ctx, s.id, s.opts)
+		if err != nil {
+			return err
+		}
+
+		if msg != nil {
+			return s.handle(ctx, h, *msg)
+		}
+
+		var retry <-chan time.Time
+		if wait > 0 {
+			retry = time.After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeout.C:
+			return broker.ErrTimeout
+		case <-s.done:
+			return broker.ErrNotConnected
+		case <-s.exit:
+			return broker.ErrSubscriptionInactive
+		case <-groupChanged:
+		case <-logChanged:
+		case <-retry:
+		}
+	}
+}
+
+// handle handles msg with h.
+func (s *Subscriber) handle(ctx context.Context, h broker.Handler, msg broker.Message) error {
+	if err := h(ctx, msg); err != nil {
+		if nerr := s.Nack(ctx, msg); nerr != nil && !errors.Is(nerr, broker.ErrNotInFlight) {
+			return nerr
+		}
+		return err
+	}
+
+	if !s.opts.ManualAck {
+		if err := s.Ack(ctx, msg); err != nil && !errors.Is(err, broker.ErrNotInFlight) {
+			return err
+		}
+	}
+
+	return nil
+}
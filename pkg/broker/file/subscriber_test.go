@@ -0,0 +1,201 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+func TestReceive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+
+	t.Run("FanOut", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		mx := MustMessages(t, b, topic, 2)
+
+		subs := []*Subscriber{
+			MustSub(t, b, topic, broker.WithSink(broker.FanOut)),
+			MustSub(t, b, topic, broker.WithSink(broker.FanOut)),
+		}
+
+		for _, sub := range subs {
+			for _, msg := range mx {
+				MustReceive(t, sub, msg)
+			}
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("FanIn", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		mx := MustMessages(t, b, topic, 2)
+
+		subs := []*Subscriber{
+			MustSub(t, b, topic),
+			MustSub(t, b, topic),
+		}
+
+		for i, sub := range subs {
+			MustReceive(t, sub, mx[i])
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		sub := MustSub(t, b, topic)
+
+		h := func(ctx context.Context, m broker.Message) error {
+			return nil
+		}
+
+		rt := 10 * time.Millisecond
+
+		if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(rt)); !errors.Is(err, broker.ErrTimeout) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("Inactive", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		sub := MustSub(t, b, topic)
+
+		if err := sub.Unsubscribe(context.Background()); err != nil {
+			t.Errorf("failed to unsubscribe: %v", err)
+		}
+
+		if err := sub.Receive(context.Background(), nil); !errors.Is(err, broker.ErrSubscriptionInactive) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrSubscriptionInactive, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+}
+
+func TestAck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic, dlq := "foo", "fooDLQ"
+
+	errHandler := errors.New("handler error")
+
+	failing := func(ctx context.Context, m broker.Message) error {
+		return errHandler
+	}
+
+	t.Run("RedeliverOnError", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		mx := MustMessages(t, b, topic, 1)
+
+		sub := MustSub(t, b, topic, broker.WithBackoff(broker.ConstantBackoff(0)))
+
+		if err := sub.Receive(context.Background(), failing); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		attempt := 0
+		h := func(ctx context.Context, m broker.Message) error {
+			if m.UID != mx[0].UID {
+				t.Errorf("expected msg ID: %s, got: %s", mx[0].UID, m.UID)
+			}
+			attempt = m.Attempt
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiving message: %v", err)
+		}
+
+		if exp := 2; attempt != exp {
+			t.Errorf("expected attempt: %d, got: %d", exp, attempt)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("ManualAck", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		mx := MustMessages(t, b, topic, 2)
+
+		sub := MustSub(t, b, topic, broker.WithManualAck())
+
+		var received broker.Message
+		h := func(ctx context.Context, m broker.Message) error {
+			received = m
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiving message: %v", err)
+		}
+
+		rt := 10 * time.Millisecond
+
+		// NOTE: the first message has not been acked yet
+		if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(rt)); !errors.Is(err, broker.ErrTimeout) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		if err := sub.Ack(context.Background(), received); err != nil {
+			t.Fatalf("failed to ack message: %v", err)
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiving message: %v", err)
+		}
+
+		if received.UID != mx[1].UID {
+			t.Errorf("expected msg ID: %s, got: %s", mx[1].UID, received.UID)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		b := MustBroker(t, MustDir(t))
+		mx := MustMessages(t, b, topic, 2)
+
+		sub := MustSub(t, b, topic,
+			broker.WithMaxAttempts(2),
+			broker.WithBackoff(broker.ConstantBackoff(0)),
+			broker.WithDeadLetter(dlq))
+
+		for i := 0; i < 2; i++ {
+			if err := sub.Receive(context.Background(), failing); !errors.Is(err, errHandler) {
+				t.Fatalf("expected error: %v, got: %v", errHandler, err)
+			}
+		}
+
+		MustReceive(t, sub, mx[1])
+		MustReceive(t, MustSub(t, b, dlq), mx[0])
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+// DefaultDedupSize is the default number of remembered message UIDs.
+const DefaultDedupSize = 1024
+
+// seen is a bounded set of message UIDs.
+// When the set is full the oldest UID is evicted.
+type seen struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	uids  map[string]*list.Element
+}
+
+// claim adds uid to the set.
+// It returns false if uid is already in the set.
+func (s *seen) claim(uid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.uids[uid]; ok {
+		return false
+	}
+
+	if s.order.Len() >= s.size {
+		oldest := s.order.Front()
+		s.order.Remove(oldest)
+		delete(s.uids, oldest.Value.(string))
+	}
+
+	s.uids[uid] = s.order.PushBack(uid)
+
+	return true
+}
+
+// remove removes uid from the set.
+func (s *seen) remove(uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.uids[uid]; ok {
+		s.order.Remove(e)
+		delete(s.uids, uid)
+	}
+}
+
+// Dedup returns middleware which skips messages whose UID has already
+// been handled successfully. It remembers up to size most recent UIDs,
+// or DefaultDedupSize if size is not positive.
+// Messages are remembered as soon as they're being handled so concurrent
+// deliveries of the same message are handled only once. Failed messages
+// are forgotten so they can be redelivered.
+func Dedup(size int) Middleware {
+	if size <= 0 {
+		size = DefaultDedupSize
+	}
+
+	s := &seen{
+		size:  size,
+		order: list.New(),
+		uids:  make(map[string]*list.Element),
+	}
+
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) error {
+			if !s.claim(m.UID) {
+				return nil
+			}
+
+			if err := h(ctx, m); err != nil {
+				s.remove(m.UID)
+				return err
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package handlers
+
+import "errors"
+
+var (
+	// ErrPanic is returned when handler panics.
+	ErrPanic = errors.New("ErrPanic")
+)
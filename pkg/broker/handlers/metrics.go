@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+// Recorder records handler metrics.
+type Recorder interface {
+	// Record records message handled in d with err.
+	Record(m broker.Message, d time.Duration, err error)
+}
+
+// Metrics returns middleware which records handler metrics with r.
+func Metrics(r Recorder) Middleware {
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) error {
+			start := time.Now()
+			err := h(ctx, m)
+			r.Record(m, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Counters are handler metrics counters.
+// Counters implement Recorder.
+type Counters struct {
+	mu       sync.Mutex
+	handled  uint64
+	failed   uint64
+	duration time.Duration
+}
+
+// Record records message handled in d with err.
+func (c *Counters) Record(m broker.Message, d time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handled++
+	if err != nil {
+		c.failed++
+	}
+	c.duration += d
+}
+
+// Handled returns the number of handled messages.
+func (c *Counters) Handled() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.handled
+}
+
+// Failed returns the number of messages which failed to be handled.
+func (c *Counters) Failed() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.failed
+}
+
+// Duration returns the total time spent handling messages.
+func (c *Counters) Duration() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.duration
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+// Middleware wraps broker handler.
+type Middleware func(broker.Handler) broker.Handler
+
+// Chain wraps h with middleware mw.
+// The first middleware is the outermost one,
+// i.e. it's the first to handle messages.
+func Chain(h broker.Handler, mw ...Middleware) broker.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Recover returns middleware which recovers from handler panics.
+// Panics are returned as errors which wrap ErrPanic.
+func Recover() Middleware {
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v", ErrPanic, r)
+				}
+			}()
+			return h(ctx, m)
+		}
+	}
+}
+
+// Retry returns middleware which retries failed handler up to
+// the given number of attempts waiting for backoff between them.
+// It returns the error of the last attempt.
+func Retry(attempts int, backoff broker.Backoff) Middleware {
+	if backoff == nil {
+		backoff = broker.ConstantBackoff(0)
+	}
+
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) error {
+			var err error
+			for i := 1; ; i++ {
+				if err = h(ctx, m); err == nil || i >= attempts {
+					return err
+				}
+
+				timer := time.NewTimer(backoff(i))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// Timeout returns middleware which fails handler with broker.ErrTimeout
+// if it does not handle message within the given timeout.
+// Handlers receive context which is canceled when timeout expires.
+// Handlers run in their own goroutine so their panics are recovered
+// and returned as errors which wrap ErrPanic.
+// NOTE: handlers which ignore context keep running in the background.
+func Timeout(d time.Duration) Middleware {
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			errc := make(chan error, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						errc <- fmt.Errorf("%w: %v", ErrPanic, r)
+					}
+				}()
+				errc <- h(ctx, m)
+			}()
+
+			select {
+			case err := <-errc:
+				return err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return broker.ErrTimeout
+				}
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Logger logs handler events.
+// It's implemented by *log.Logger.
+type Logger interface {
+	// Printf logs formatted message.
+	Printf(format string, v ...interface{})
+}
+
+// Logging returns middleware which logs handled messages with l.
+func Logging(l Logger) Middleware {
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) error {
+			start := time.Now()
+			err := h(ctx, m)
+			if err != nil {
+				l.Printf("message %s type %s attempt %d failed after %s: %v", m.UID, m.Type, m.Attempt, time.Since(start), err)
+				return err
+			}
+			l.Printf("message %s type %s attempt %d handled in %s", m.UID, m.Type, m.Attempt, time.Since(start))
+			return nil
+		}
+	}
+}
+
+// FilterType returns middleware which handles only messages of the given types.
+// Messages of other types are skipped without error.
+func FilterType(types ...broker.Type) Middleware {
+	allowed := make(map[broker.Type]bool, len(types))
+	for _, t := range types {
+		allowed[t] = true
+	}
+
+	return func(h broker.Handler) broker.Handler {
+		return func(ctx context.Context, m broker.Message) error {
+			if !allowed[m.Type] {
+				return nil
+			}
+			return h(ctx, m)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+var errHandler = errors.New("handler error")
+
+func TestChain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	var order []string
+	mw := func(name string) Middleware {
+		return func(h broker.Handler) broker.Handler {
+			return func(ctx context.Context, m broker.Message) error {
+				order = append(order, name)
+				return h(ctx, m)
+			}
+		}
+	}
+
+	h := Chain(func(context.Context, broker.Message) error {
+		order = append(order, "handler")
+		return nil
+	}, mw("first"), mw("second"))
+
+	if err := h(context.Background(), broker.Message{}); err != nil {
+		t.Fatalf("failed handling message: %v", err)
+	}
+
+	if got, exp := strings.Join(order, ","), "first,second,handler"; got != exp {
+		t.Errorf("expected order: %s, got: %s", exp, got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	h := Recover()(func(context.Context, broker.Message) error {
+		panic("boom")
+	})
+
+	if err := h(context.Background(), broker.Message{}); !errors.Is(err, ErrPanic) {
+		t.Errorf("expected error: %v, got: %v", ErrPanic, err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("Succeed", func(t *testing.T) {
+		calls := 0
+		h := Retry(3, nil)(func(context.Context, broker.Message) error {
+			calls++
+			if calls < 3 {
+				return errHandler
+			}
+			return nil
+		})
+
+		if err := h(context.Background(), broker.Message{}); err != nil {
+			t.Errorf("failed handling message: %v", err)
+		}
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		calls := 0
+		h := Retry(2, broker.ConstantBackoff(time.Millisecond))(func(context.Context, broker.Message) error {
+			calls++
+			return errHandler
+		})
+
+		if err := h(context.Background(), broker.Message{}); !errors.Is(err, errHandler) {
+			t.Errorf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		if exp := 2; calls != exp {
+			t.Errorf("expected calls: %d, got: %d", exp, calls)
+		}
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	h := Timeout(10 * time.Millisecond)(func(ctx context.Context, m broker.Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := h(context.Background(), broker.Message{}); !errors.Is(err, broker.ErrTimeout) {
+		t.Errorf("expected error: %v, got: %v", broker.ErrTimeout, err)
+	}
+
+	t.Run("Panic", func(t *testing.T) {
+		h := Recover()(Timeout(time.Second)(func(context.Context, broker.Message) error {
+			panic("boom")
+		}))
+
+		if err := h(context.Background(), broker.Message{}); !errors.Is(err, ErrPanic) {
+			t.Errorf("expected error: %v, got: %v", ErrPanic, err)
+		}
+	})
+}
+
+func TestLogging(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	var buf bytes.Buffer
+	l := log.New(&buf, "", 0)
+
+	h := Logging(l)(func(context.Context, broker.Message) error {
+		return errHandler
+	})
+
+	if err := h(context.Background(), broker.Message{UID: "fooID"}); !errors.Is(err, errHandler) {
+		t.Errorf("expected error: %v, got: %v", errHandler, err)
+	}
+
+	if !strings.Contains(buf.String(), "fooID") {
+		t.Errorf("expected log to contain message UID, got: %s", buf.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	c := &Counters{}
+
+	h := Metrics(c)(func(ctx context.Context, m broker.Message) error {
+		if m.UID == "bad" {
+			return errHandler
+		}
+		return nil
+	})
+
+	for _, uid := range []string{"good", "bad", "good"} {
+		_ = h(context.Background(), broker.Message{UID: uid})
+	}
+
+	if c.Handled() != 3 || c.Failed() != 1 {
+		t.Errorf("expected handled: 3, failed: 1, got: %d, %d", c.Handled(), c.Failed())
+	}
+}
+
+func TestFilterType(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	var handled []broker.Type
+	h := FilterType(broker.Entity, broker.Link)(func(ctx context.Context, m broker.Message) error {
+		handled = append(handled, m.Type)
+		return nil
+	})
+
+	for _, typ := range []broker.Type{broker.Entity, broker.Object, broker.Link} {
+		if err := h(context.Background(), broker.Message{Type: typ}); err != nil {
+			t.Fatalf("failed handling message: %v", err)
+		}
+	}
+
+	if len(handled) != 2 || handled[0] != broker.Entity || handled[1] != broker.Link {
+		t.Errorf("expected handled types: [Entity Link], got: %v", handled)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	calls := make(map[string]int)
+	fail := true
+
+	h := Dedup(2)(func(ctx context.Context, m broker.Message) error {
+		calls[m.UID]++
+		if m.UID == "bad" && fail {
+			return errHandler
+		}
+		return nil
+	})
+
+	for _, uid := range []string{"foo", "foo", "bad", "bar", "baz", "foo"} {
+		_ = h(context.Background(), broker.Message{UID: uid})
+	}
+
+	fail = false
+	_ = h(context.Background(), broker.Message{UID: "bad"})
+
+	exp := map[string]int{"foo": 2, "bad": 2, "bar": 1, "baz": 1}
+	for uid, n := range exp {
+		if calls[uid] != n {
+			t.Errorf("message %s: expected calls: %d, got: %d", uid, n, calls[uid])
+		}
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+
+		h := Dedup(0)(func(ctx context.Context, m broker.Message) error {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return nil
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = h(context.Background(), broker.Message{UID: "foo"})
+			}()
+		}
+
+		close(release)
+		wg.Wait()
+
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("expected calls: %d, got: %d", 1, n)
+		}
+	})
+}
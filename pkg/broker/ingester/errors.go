@@ -0,0 +1,8 @@
+package ingester
+
+import "errors"
+
+var (
+	// ErrUnsupportedType is returned when ingesting data of unsupported type.
+	ErrUnsupportedType = errors.New("ErrUnsupportedType")
+)
@@ -11,3 +11,9 @@ type Ingester interface {
 	// Ingest ingests data to the broker on the given topic.
 	Ingest(ctx context.Context, b broker.Broker, topic string, msgType broker.Type, data interface{}, opts ...Option) error
 }
+
+// StreamIngester ingests streams of space entities and links to the broker.
+type StreamIngester interface {
+	// IngestStream ingests all items from the given iterator to the broker on the given topic.
+	IngestStream(ctx context.Context, b broker.Broker, topic string, it Iterator, opts ...Option) (*Report, error)
+}
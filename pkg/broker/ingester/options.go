@@ -1,10 +1,21 @@
 package ingester
 
-import "github.com/milosgajdos/netscrape/pkg/broker"
+import (
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/trace"
+)
 
 // Options configure ingester.
 type Options struct {
 	Marshaler broker.Marshaler
+	// BatchSize configures max number of messages published in bulk.
+	BatchSize int
+	// BatchWindow configures how long messages wait to be published in bulk.
+	BatchWindow time.Duration
+	// Tracer configures tracer.
+	Tracer trace.Tracer
 }
 
 // Option is functional ingester option.
@@ -16,3 +27,24 @@ func WithMarshaler(m broker.Marshaler) Option {
 		o.Marshaler = m
 	}
 }
+
+// WithBatchSize sets BatchSize option.
+func WithBatchSize(n int) Option {
+	return func(o *Options) {
+		o.BatchSize = n
+	}
+}
+
+// WithBatchWindow sets BatchWindow option.
+func WithBatchWindow(d time.Duration) Option {
+	return func(o *Options) {
+		o.BatchWindow = d
+	}
+}
+
+// WithTracer sets Tracer option.
+func WithTracer(t trace.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = t
+	}
+}
@@ -3,17 +3,41 @@ package simple
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/milosgajdos/netscrape/pkg/broker"
 	"github.com/milosgajdos/netscrape/pkg/broker/ingester"
+	spacejson "github.com/milosgajdos/netscrape/pkg/space/marshal/json"
+	"github.com/milosgajdos/netscrape/pkg/trace"
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
 )
 
+// batch is a batch of messages waiting to be published.
+type batch struct {
+	b     broker.Broker
+	msgs  []broker.Message
+	timer *time.Timer
+}
+
 // Ingester digests data from broker.
 type Ingester struct {
 	opts ingester.Options
+	// batches are message batches indexed by topic.
+	batches map[string]*batch
+	// err is the error of the first failed batch flush
+	// which has not been reported yet.
+	err error
+	// mu synchronizes access to batches.
+	mu *sync.Mutex
 }
 
-// NewIngester creates a new ingester and returns it
+// NewIngester creates a new ingester and returns it.
+// If either BatchSize or BatchWindow option is set, ingested messages
+// are batched per topic and published in bulk when the batch is full,
+// when the batch window expires, or when Flush is called.
 func NewIngester(opts ...ingester.Option) (*Ingester, error) {
 	ropts := ingester.Options{}
 	for _, apply := range opts {
@@ -21,36 +45,236 @@ func NewIngester(opts ...ingester.Option) (*Ingester, error) {
 	}
 
 	return &Ingester{
-		opts: ropts,
+		opts:    ropts,
+		batches: make(map[string]*batch),
+		mu:      &sync.Mutex{},
 	}, nil
 }
 
+// batching returns true if batching is enabled by opts.
+func batching(opts ingester.Options) bool {
+	return opts.BatchSize > 0 || opts.BatchWindow > 0
+}
+
 // Ingest ingests messages to the broker marshaled with the given marshaler.
-func (in *Ingester) Ingest(ctx context.Context, b broker.Broker, topic string, msgType broker.Type, data interface{}, opts ...ingester.Option) error {
-	ropts := ingester.Options{}
+// If no marshaler is given, space entities and links are marshaled with
+// space JSON marshaler and any other data with encoding/json.
+// If data has UID, e.g. it's a space.Entity, it's used as message partition key
+// so all updates of the same entity are delivered in order by partitioned topics.
+// Every message is ingested in an "ingest" span and stamped with trace and
+// correlation attributes; messages ingested with context which carries no
+// correlation ID are correlated by their UID.
+// If batching is enabled the message is added to the topic batch and the
+// errors of previously failed batch publishes are returned; such errors
+// don't mean the message was not ingested.
+func (in *Ingester) Ingest(ctx context.Context, b broker.Broker, topic string, msgType broker.Type, data interface{}, opts ...ingester.Option) (err error) {
+	ropts := in.options(opts...)
+
+	ctx, span := start(ctx, ropts.Tracer)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	msg, err := encode(ctx, span, topic, msgType, data, ropts.Marshaler)
+	if err != nil {
+		return err
+	}
+
+	if !batching(ropts) {
+		return b.Pub(ctx, topic, msg)
+	}
+
+	return in.add(ctx, b, topic, msg, ropts)
+}
+
+// options returns ingester options overridden by opts.
+func (in *Ingester) options(opts ...ingester.Option) ingester.Options {
+	ropts := ingester.Options{
+		Marshaler:   in.opts.Marshaler,
+		BatchSize:   in.opts.BatchSize,
+		BatchWindow: in.opts.BatchWindow,
+		Tracer:      in.opts.Tracer,
+	}
 	for _, apply := range opts {
 		apply(&ropts)
 	}
 
-	msg := &broker.Message{
+	return ropts
+}
+
+// start starts "ingest" span with tr.
+func start(ctx context.Context, tr trace.Tracer) (context.Context, trace.Span) {
+	if tr == nil {
+		tr = trace.Noop{}
+	}
+
+	return tr.Start(ctx, "ingest")
+}
+
+// encode encodes data to a new message of the given type.
+// The message is assigned a new UID and stamped with span attributes.
+func encode(ctx context.Context, span trace.Span, topic string, msgType broker.Type, data interface{}, m broker.Marshaler) (broker.Message, error) {
+	msg := broker.Message{
+		UID:  memuid.New().String(),
 		Type: msgType,
 	}
 
-	var err error
+	if trace.CorrelationID(ctx) == "" {
+		ctx = trace.ContextWithCorrelationID(ctx, msg.UID)
+	}
+
+	span.SetAttr("message.uid", msg.UID)
+	span.SetAttr("message.type", msgType.String())
+	span.SetAttr("topic", topic)
+
+	if e, ok := data.(interface{ UID() uuid.UID }); ok && e.UID() != nil {
+		msg.Attrs = map[string]string{
+			broker.PartitionKeyAttr: e.UID().String(),
+		}
+	}
 
-	m := ropts.Marshaler
-	if m == nil {
+	trace.Inject(ctx, &msg)
+
+	var err error
+	switch {
+	case m != nil:
+		msg.Data, err = m.Marshal(data)
+	case ingester.TypeOf(data) != broker.Unknown:
+		msg.Data, err = (&spacejson.Marshaler{}).Marshal(data)
+	default:
 		msg.Data, err = json.Marshal(data)
-		if err != nil {
+	}
+
+	if err != nil {
+		return broker.Message{}, err
+	}
+
+	return msg, nil
+}
+
+// take removes the batch for the given topic and returns it.
+// NOTE: this must be called with the ingester lock held.
+func (in *Ingester) take(topic string) *batch {
+	bt, ok := in.batches[topic]
+	if !ok {
+		return nil
+	}
+
+	if bt.timer != nil {
+		bt.timer.Stop()
+	}
+	delete(in.batches, topic)
+
+	return bt
+}
+
+// add adds msg to the topic batch and publishes the batch if it's full
+// following the batch options of opts. The batch window of a new batch
+// is set by the options it's created with.
+// msg is added even if a previous batch publish failed, in which case
+// the error of the failed publish is returned.
+func (in *Ingester) add(ctx context.Context, b broker.Broker, topic string, msg broker.Message, opts ingester.Options) error {
+	in.mu.Lock()
+
+	prev := in.err
+	in.err = nil
+
+	var ready []*batch
+
+	bt, ok := in.batches[topic]
+	if ok && bt.b != b {
+		ready = append(ready, in.take(topic))
+		ok = false
+	}
+
+	if !ok {
+		bt = &batch{b: b}
+		if opts.BatchWindow > 0 {
+			bt.timer = time.AfterFunc(opts.BatchWindow, func() {
+				in.expire(topic, bt)
+			})
+		}
+		in.batches[topic] = bt
+	}
+
+	bt.msgs = append(bt.msgs, msg)
+
+	if opts.BatchSize > 0 && len(bt.msgs) >= opts.BatchSize {
+		ready = append(ready, in.take(topic))
+	}
+
+	in.mu.Unlock()
+
+	for _, bt := range ready {
+		if err := publish(ctx, topic, bt); err != nil {
+			if prev != nil {
+				return fmt.Errorf("%w (previous batch publish failed: %v)", err, prev)
+			}
 			return err
 		}
-		return b.Pub(ctx, topic, *msg)
 	}
 
-	msg.Data, err = m.Marshal(data)
-	if err != nil {
-		return err
+	return prev
+}
+
+// expire publishes bt once its batch window expired.
+func (in *Ingester) expire(topic string, bt *batch) {
+	in.mu.Lock()
+	if in.batches[topic] != bt {
+		in.mu.Unlock()
+		return
+	}
+	in.take(topic)
+	in.mu.Unlock()
+
+	if err := publish(context.Background(), topic, bt); err != nil {
+		in.mu.Lock()
+		// NOTE: the first error is kept until it's reported
+		if in.err == nil {
+			in.err = err
+		}
+		in.mu.Unlock()
+	}
+}
+
+// Flush publishes all pending batches.
+// It returns the first error encountered, including
+// errors of previously failed batch publishes.
+func (in *Ingester) Flush(ctx context.Context) error {
+	in.mu.Lock()
+	err := in.err
+	in.err = nil
+
+	ready := make(map[string]*batch, len(in.batches))
+	for topic := range in.batches {
+		ready[topic] = in.take(topic)
+	}
+	in.mu.Unlock()
+
+	for topic, bt := range ready {
+		if perr := publish(ctx, topic, bt); perr != nil && err == nil {
+			err = perr
+		}
+	}
+
+	return err
+}
+
+// publish publishes messages in bt on the given topic.
+// It uses bulk publish if the batch broker supports it.
+func publish(ctx context.Context, topic string, bt *batch) error {
+	if bb, ok := bt.b.(broker.BulkBroker); ok {
+		return bb.BulkPub(ctx, topic, bt.msgs)
+	}
+
+	for i, msg := range bt.msgs {
+		if err := bt.b.Pub(ctx, topic, msg); err != nil {
+			return &broker.BulkPubError{Published: i, Err: err}
+		}
 	}
 
-	return b.Pub(ctx, topic, *msg)
+	return nil
 }
@@ -0,0 +1,144 @@
+package simple
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/ingester"
+)
+
+func TestIngestBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("PrevError", func(t *testing.T) {
+		in, err := NewIngester(ingester.WithBatchWindow(10 * time.Millisecond))
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		b := &bulkBroker{pubBroker: pubBroker{fail: 1}}
+
+		for _, data := range []string{"foo", "bar"} {
+			if err := in.Ingest(context.Background(), b, "foo", broker.Entity, data); err != nil {
+				t.Fatalf("failed ingesting %s: %v", data, err)
+			}
+		}
+
+		// NOTE: wait until the batch window expires and the batch publish fails
+		for {
+			in.mu.Lock()
+			failed := in.err != nil
+			in.mu.Unlock()
+			if failed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		b.fail = 0
+
+		if err := in.Ingest(context.Background(), b, "foo", broker.Entity, "baz"); !errors.Is(err, errPub) {
+			t.Fatalf("expected error: %v, got: %v", errPub, err)
+		}
+
+		if err := in.Flush(context.Background()); err != nil {
+			t.Fatalf("failed flushing batches: %v", err)
+		}
+
+		if len(b.msgs) != 2 {
+			t.Fatalf("expected messages: %d, got: %d", 2, len(b.msgs))
+		}
+
+		if data := string(b.msgs[1].Data); data != `"baz"` {
+			t.Errorf("expected data: %s, got: %s", `"baz"`, data)
+		}
+	})
+	t.Run("CallOptions", func(t *testing.T) {
+		in, err := NewIngester()
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		b := &bulkBroker{}
+
+		for _, data := range []string{"foo", "bar"} {
+			if err := in.Ingest(context.Background(), b, "foo", broker.Entity, data, ingester.WithBatchSize(2)); err != nil {
+				t.Fatalf("failed ingesting %s: %v", data, err)
+			}
+		}
+
+		if b.bulks != 1 || len(b.msgs) != 2 {
+			t.Fatalf("expected bulks: %d, messages: %d, got: %d, %d", 1, 2, b.bulks, len(b.msgs))
+		}
+
+		cb := &chanBroker{msgs: make(chan broker.Message, 1)}
+
+		if err := in.Ingest(context.Background(), cb, "foo", broker.Entity, "baz", ingester.WithBatchWindow(time.Millisecond)); err != nil {
+			t.Fatalf("failed ingesting %s: %v", "baz", err)
+		}
+
+		select {
+		case m := <-cb.msgs:
+			if data := string(m.Data); data != `"baz"` {
+				t.Errorf("expected data: %s, got: %s", `"baz"`, data)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("expected batch published once its window expires")
+		}
+	})
+
+	t.Run("FirstError", func(t *testing.T) {
+		in, err := NewIngester(ingester.WithBatchWindow(time.Hour))
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		errFirst := errors.New("first error")
+
+		for _, e := range []error{errFirst, errPub} {
+			bt := &batch{b: &errBroker{err: e}, msgs: []broker.Message{{UID: "foo"}}}
+
+			in.mu.Lock()
+			in.batches["foo"] = bt
+			in.mu.Unlock()
+
+			in.expire("foo", bt)
+		}
+
+		if err := in.Flush(context.Background()); !errors.Is(err, errFirst) {
+			t.Errorf("expected error: %v, got: %v", errFirst, err)
+		}
+	})
+}
+
+// errBroker fails to publish messages with err.
+type errBroker struct {
+	err error
+}
+
+func (b *errBroker) Pub(ctx context.Context, topic string, m broker.Message, opts ...broker.Option) error {
+	return b.err
+}
+
+func (b *errBroker) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
+	return nil, broker.ErrNotImplemented
+}
+
+// chanBroker sends published messages to msgs.
+type chanBroker struct {
+	msgs chan broker.Message
+}
+
+func (b *chanBroker) Pub(ctx context.Context, topic string, m broker.Message, opts ...broker.Option) error {
+	b.msgs <- m
+	return nil
+}
+
+func (b *chanBroker) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
+	return nil, broker.ErrNotImplemented
+}
@@ -0,0 +1,120 @@
+package simple
+
+import (
+	"context"
+	"errors"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/ingester"
+)
+
+// DefaultStreamBatchSize is the default number of stream messages published in bulk.
+const DefaultStreamBatchSize = 100
+
+// IngestStream ingests items from it to the broker on the given topic.
+// Message type of every item is inferred from its type; items which are
+// neither space entities nor links are reported as failed with
+// ingester.ErrUnsupportedType. Every message is assigned a new UID and
+// messages are published in batches of BatchSize, or DefaultStreamBatchSize
+// if BatchSize is not set, using bulk publish if the broker supports it.
+// Errors of individual items are returned in the report; IngestStream
+// returns error only if the iteration fails, e.g. when ctx is done,
+// in which case the report accounts for all items iterated before.
+func (in *Ingester) IngestStream(ctx context.Context, b broker.Broker, topic string, it ingester.Iterator, opts ...ingester.Option) (*ingester.Report, error) {
+	ropts := in.options(opts...)
+
+	size := ropts.BatchSize
+	if size <= 0 {
+		size = DefaultStreamBatchSize
+	}
+
+	report := &ingester.Report{}
+
+	var (
+		msgs []broker.Message
+		idx  []int
+	)
+
+	flush := func() {
+		if len(msgs) == 0 {
+			return
+		}
+		publishStream(ctx, b, topic, msgs, idx, report)
+		msgs, idx = nil, nil
+	}
+
+	for i := 0; ; i++ {
+		data, ok := it.Next(ctx)
+		if !ok {
+			break
+		}
+
+		msgType := ingester.TypeOf(data)
+		if msgType == broker.Unknown {
+			report.Errors = append(report.Errors, ingester.ItemError{Index: i, Err: ingester.ErrUnsupportedType})
+			continue
+		}
+
+		sctx, span := start(ctx, ropts.Tracer)
+		msg, err := encode(sctx, span, topic, msgType, data, ropts.Marshaler)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+
+		if err != nil {
+			report.Errors = append(report.Errors, ingester.ItemError{Index: i, Err: err})
+			continue
+		}
+
+		msgs = append(msgs, msg)
+		idx = append(idx, i)
+
+		if len(msgs) >= size {
+			flush()
+		}
+	}
+
+	// NOTE: messages encoded before the iteration failed are published
+	// so the report accounts for every item the iterator has returned
+	flush()
+
+	if err := it.Err(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// publishStream publishes msgs and records the result in report.
+// idx are stream indices of msgs.
+func publishStream(ctx context.Context, b broker.Broker, topic string, msgs []broker.Message, idx []int, report *ingester.Report) {
+	bb, ok := b.(broker.BulkBroker)
+	if !ok {
+		for i, msg := range msgs {
+			if err := b.Pub(ctx, topic, msg); err != nil {
+				report.Errors = append(report.Errors, ingester.ItemError{Index: idx[i], UID: msg.UID, Err: err})
+				continue
+			}
+			report.Ingested++
+		}
+		return
+	}
+
+	err := bb.BulkPub(ctx, topic, msgs)
+	if err == nil {
+		report.Ingested += len(msgs)
+		return
+	}
+
+	published := 0
+	var bulkErr *broker.BulkPubError
+	if errors.As(err, &bulkErr) {
+		published, err = bulkErr.Published, bulkErr.Err
+	}
+
+	report.Ingested += published
+	for i := published; i < len(msgs); i++ {
+		report.Errors = append(report.Errors, ingester.ItemError{Index: idx[i], UID: msgs[i].UID, Err: err})
+	}
+}
@@ -0,0 +1,256 @@
+package simple
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/ingester"
+	"github.com/milosgajdos/netscrape/pkg/internal"
+	"github.com/milosgajdos/netscrape/pkg/space"
+	spacejson "github.com/milosgajdos/netscrape/pkg/space/marshal/json"
+)
+
+var errPub = errors.New("pub error")
+
+// pubBroker records published messages and fails
+// to publish messages once fail messages were published.
+type pubBroker struct {
+	msgs []broker.Message
+	fail int
+}
+
+func (b *pubBroker) Pub(ctx context.Context, topic string, m broker.Message, opts ...broker.Option) error {
+	if b.fail > 0 && len(b.msgs) >= b.fail {
+		return errPub
+	}
+	b.msgs = append(b.msgs, m)
+	return nil
+}
+
+func (b *pubBroker) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
+	return nil, broker.ErrNotImplemented
+}
+
+// bulkBroker records published messages and counts bulk publishes.
+type bulkBroker struct {
+	pubBroker
+	bulks int
+}
+
+func (b *bulkBroker) BulkPub(ctx context.Context, topic string, mx []broker.Message, opts ...broker.Option) error {
+	b.bulks++
+	for i, m := range mx {
+		if err := b.Pub(ctx, topic, m); err != nil {
+			return &broker.BulkPubError{Published: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// failingIter iterates over items and fails with err once they're exhausted.
+type failingIter struct {
+	items []interface{}
+	err   error
+}
+
+func (it *failingIter) Next(ctx context.Context) (interface{}, bool) {
+	if len(it.items) == 0 {
+		return nil, false
+	}
+	x := it.items[0]
+	it.items = it.items[1:]
+	return x, true
+}
+
+func (it *failingIter) Err() error {
+	if len(it.items) == 0 {
+		return it.err
+	}
+	return nil
+}
+
+func MustEntities(t *testing.T) []space.Entity {
+	e, err := internal.NewTestEntity()
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+
+	r, err := internal.NewTestResource()
+	if err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+
+	o, err := internal.NewTestObject()
+	if err != nil {
+		t.Fatalf("failed to create object: %v", err)
+	}
+
+	return []space.Entity{e, r, o}
+}
+
+func MustLink(t *testing.T) space.Link {
+	l, err := internal.NewTestLink()
+	if err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+	return l
+}
+
+func TestIngestStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	ex := MustEntities(t)
+	l := MustLink(t)
+
+	t.Run("Types", func(t *testing.T) {
+		in, err := NewIngester(ingester.WithBatchSize(2))
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		b := &bulkBroker{}
+
+		report, err := in.IngestStream(context.Background(), b, "foo", ingester.Entities(ex...))
+		if err != nil {
+			t.Fatalf("failed ingesting stream: %v", err)
+		}
+
+		if report.Ingested != len(ex) || report.Err() != nil {
+			t.Fatalf("expected ingested: %d, got: %d, err: %v", len(ex), report.Ingested, report.Err())
+		}
+
+		if b.bulks != 2 {
+			t.Errorf("expected bulks: %d, got: %d", 2, b.bulks)
+		}
+
+		types := []broker.Type{broker.Entity, broker.Resource, broker.Object}
+		for i, m := range b.msgs {
+			if m.UID == "" {
+				t.Errorf("expected message UID")
+			}
+
+			if m.Type != types[i] {
+				t.Errorf("expected type: %s, got: %s", types[i], m.Type)
+			}
+		}
+
+		m, err := spacejson.NewMarshaler()
+		if err != nil {
+			t.Fatalf("failed creating marshaler: %v", err)
+		}
+
+		var r space.Resource
+		if err := m.Unmarshal(b.msgs[1].Data, &r); err != nil {
+			t.Fatalf("failed to unmarshal resource: %v", err)
+		}
+
+		if r.UID().String() != ex[1].UID().String() {
+			t.Errorf("expected resource UID: %s, got: %s", ex[1].UID(), r.UID())
+		}
+	})
+
+	t.Run("Chan", func(t *testing.T) {
+		in, err := NewIngester()
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		ch := make(chan interface{}, 3)
+		ch <- l
+		ch <- "foo"
+		ch <- ex[0]
+		close(ch)
+
+		b := &pubBroker{}
+
+		report, err := in.IngestStream(context.Background(), b, "foo", ingester.Chan(ch))
+		if err != nil {
+			t.Fatalf("failed ingesting stream: %v", err)
+		}
+
+		if report.Ingested != 2 {
+			t.Errorf("expected ingested: %d, got: %d", 2, report.Ingested)
+		}
+
+		if len(report.Errors) != 1 {
+			t.Fatalf("expected errors: %d, got: %d", 1, len(report.Errors))
+		}
+
+		if e := report.Errors[0]; e.Index != 1 || !errors.Is(e, ingester.ErrUnsupportedType) {
+			t.Errorf("expected item %d error: %v, got: %v", 1, ingester.ErrUnsupportedType, e)
+		}
+
+		if b.msgs[0].Type != broker.Link {
+			t.Errorf("expected type: %s, got: %s", broker.Link, b.msgs[0].Type)
+		}
+	})
+
+	t.Run("PubError", func(t *testing.T) {
+		in, err := NewIngester()
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		b := &bulkBroker{pubBroker: pubBroker{fail: 1}}
+
+		report, err := in.IngestStream(context.Background(), b, "foo", ingester.Entities(ex...))
+		if err != nil {
+			t.Fatalf("failed ingesting stream: %v", err)
+		}
+
+		if report.Ingested != 1 {
+			t.Errorf("expected ingested: %d, got: %d", 1, report.Ingested)
+		}
+
+		if len(report.Errors) != 2 {
+			t.Fatalf("expected errors: %d, got: %d", 2, len(report.Errors))
+		}
+
+		for i, e := range report.Errors {
+			if e.Index != i+1 || e.UID == "" || !errors.Is(e, errPub) {
+				t.Errorf("expected item %d error: %v, got: %v", i+1, errPub, e)
+			}
+		}
+	})
+
+	t.Run("IterError", func(t *testing.T) {
+		in, err := NewIngester(ingester.WithBatchSize(10))
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		errIter := errors.New("iterator error")
+		it := &failingIter{items: []interface{}{ex[0], ex[1]}, err: errIter}
+
+		b := &bulkBroker{}
+
+		report, err := in.IngestStream(context.Background(), b, "foo", it)
+		if !errors.Is(err, errIter) {
+			t.Fatalf("expected error: %v, got: %v", errIter, err)
+		}
+
+		if report.Ingested != 2 || len(b.msgs) != 2 {
+			t.Errorf("expected ingested: %d, got: %d, published: %d", 2, report.Ingested, len(b.msgs))
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		in, err := NewIngester()
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		ch := make(chan interface{})
+
+		if _, err := in.IngestStream(ctx, &pubBroker{}, "foo", ingester.Chan(ch)); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected error: %v, got: %v", context.Canceled, err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package ingester
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/space"
+)
+
+// Iterator iterates over ingested data.
+type Iterator interface {
+	// Next returns the next item.
+	// It returns false when there are no more items or ctx is done.
+	Next(ctx context.Context) (interface{}, bool)
+	// Err returns the error which stopped the iteration.
+	Err() error
+}
+
+// chanIter iterates over items received on a channel.
+type chanIter struct {
+	ch  <-chan interface{}
+	err error
+}
+
+// Chan returns Iterator which iterates over items received on ch until ch is closed.
+func Chan(ch <-chan interface{}) Iterator {
+	return &chanIter{ch: ch}
+}
+
+// Next implements Iterator.
+func (c *chanIter) Next(ctx context.Context) (interface{}, bool) {
+	select {
+	case <-ctx.Done():
+		c.err = ctx.Err()
+		return nil, false
+	case x, ok := <-c.ch:
+		return x, ok
+	}
+}
+
+// Err implements Iterator.
+func (c *chanIter) Err() error {
+	return c.err
+}
+
+// sliceIter iterates over items in a slice.
+type sliceIter struct {
+	items []interface{}
+	err   error
+}
+
+// Next implements Iterator.
+func (s *sliceIter) Next(ctx context.Context) (interface{}, bool) {
+	if err := ctx.Err(); err != nil {
+		s.err = err
+		return nil, false
+	}
+
+	if len(s.items) == 0 {
+		return nil, false
+	}
+
+	x := s.items[0]
+	s.items = s.items[1:]
+
+	return x, true
+}
+
+// Err implements Iterator.
+func (s *sliceIter) Err() error {
+	return s.err
+}
+
+// Entities returns Iterator which iterates over entities in ex.
+func Entities(ex ...space.Entity) Iterator {
+	items := make([]interface{}, len(ex))
+	for i, e := range ex {
+		items[i] = e
+	}
+	return &sliceIter{items: items}
+}
+
+// Links returns Iterator which iterates over links in lx.
+func Links(lx ...space.Link) Iterator {
+	items := make([]interface{}, len(lx))
+	for i, l := range lx {
+		items[i] = l
+	}
+	return &sliceIter{items: items}
+}
+
+// TypeOf returns broker message type of x.
+// It returns broker.Unknown if x is not a space entity or link.
+func TypeOf(x interface{}) broker.Type {
+	switch x.(type) {
+	case space.Resource:
+		return broker.Resource
+	case space.Object:
+		return broker.Object
+	case space.Entity:
+		return broker.Entity
+	case space.Link:
+		return broker.Link
+	default:
+		return broker.Unknown
+	}
+}
+
+// ItemError is an error of a single ingested item.
+type ItemError struct {
+	// Index is the position of the item in the stream.
+	Index int
+	// UID is the message UID assigned to the item.
+	// It's empty if the item failed before it was encoded.
+	UID string
+	// Err is the item error.
+	Err error
+}
+
+// Error implements error interface.
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the item error.
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Report reports the result of ingesting a stream.
+type Report struct {
+	// Ingested is the number of successfully ingested items.
+	Ingested int
+	// Errors are errors of items which failed to be ingested.
+	Errors []ItemError
+}
+
+// Err returns the first item error, or nil if all items were ingested.
+func (r *Report) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return r.Errors[0]
+}
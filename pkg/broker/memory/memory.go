@@ -2,7 +2,9 @@ package memory
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/milosgajdos/netscrape/pkg/broker"
@@ -14,30 +16,52 @@ const (
 	DefaultSize = 100
 	// Defaultimeout is default timeout for both publish and subscribe ops.
 	DefaultTimeout = 5 * time.Second
+	// DefaultAckTimeout is default timeout for manual message acks.
+	DefaultAckTimeout = 30 * time.Second
+	// DefaultMaxAttempts is default max number of delivery attempts.
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is default base redelivery backoff.
+	DefaultBackoff = 100 * time.Millisecond
 )
 
+// drainInterval is the interval in which Close checks if broker has been drained.
+const drainInterval = 10 * time.Millisecond
+
 // sub is subscription.
 type sub struct {
 	id    string
 	topic string
 }
 
-// queue is topic queue
-type queue struct {
-	msg  chan broker.Message
-	exit chan struct{}
-}
-
 // Memory is in-memory broker.
 type Memory struct {
 	sync.RWMutex
 	connected  bool
 	size       int
+	sink       broker.Sink
 	pubTimeout time.Duration
-	subs       map[string]map[string]*Subscriber
-	topics     map[string]queue
-	exit       chan struct{}
-	ctl        chan sub
+	overflow   broker.Overflow
+	partitions int
+	key        broker.PartitionKey
+	topics     map[string]*topic
+	wildcards  map[string]*Subscriber
+	// closing is true when broker is being closed.
+	closing bool
+	// closed is closed once the broker has been closed.
+	closed chan struct{}
+	// closeErr is the error of the last close.
+	closeErr error
+	// abortErr is the error of close of the broker
+	// which was aborted because its Open context was done.
+	abortErr error
+	// stop is closed when broker stops accepting messages.
+	stop chan struct{}
+	exit chan struct{}
+	ctl  chan sub
+	// wg tracks broker goroutines.
+	wg sync.WaitGroup
+	// lost counts messages lost when broker exited.
+	lost int64
 }
 
 // New crates a new in-memory broker and returns it.
@@ -60,31 +84,169 @@ func New(opts ...broker.Option) (*Memory, error) {
 	return &Memory{
 		connected:  false,
 		size:       size,
+		sink:       bopts.Sink,
 		pubTimeout: pubTimeout,
-		subs:       make(map[string]map[string]*Subscriber),
-		topics:     make(map[string]queue),
+		overflow:   bopts.Overflow,
+		partitions: bopts.Partitions,
+		key:        bopts.PartitionKey,
+		topics:     make(map[string]*topic),
+		wildcards:  make(map[string]*Subscriber),
 	}, nil
 }
 
 // run starts the broker.
+// When ctx is done the broker is closed without draining
+// and the error of the close is returned by the next Close.
 func (m *Memory) run(ctx context.Context) {
-	defer m.Close()
 	for {
 		select {
 		case <-ctx.Done():
+			// NOTE: Close waits for run to return
+			go m.shutdown(ctx, true) // nolint:errcheck
 			return
 		case <-m.exit:
 			return
 		case sub := <-m.ctl:
-			m.Lock()
-			if _, ok := m.subs[sub.topic]; ok {
-				delete(m.subs[sub.topic], sub.id)
+			m.unsubscribe(sub)
+		}
+	}
+}
+
+// spawn runs f in a new broker goroutine.
+// If f returns false, a message has been lost when broker exited.
+// It returns false if the broker has exited and f was not run.
+func (m *Memory) spawn(f func() bool) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.exit == nil {
+		return false
+	}
+
+	select {
+	case <-m.exit:
+		return false
+	default:
+	}
+
+	m.goroutine(f)
+
+	return true
+}
+
+// goroutine runs f in a new broker goroutine.
+// NOTE: this must be called with the broker lock held.
+func (m *Memory) goroutine(f func() bool) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if !f() {
+			m.lose(1)
+		}
+	}()
+}
+
+// lose records n lost messages.
+func (m *Memory) lose(n int) {
+	atomic.AddInt64(&m.lost, int64(n))
+}
+
+// unsubscribe removes subscription from all topics it's subscribed to.
+// Messages queued by FanIn topics to the subscription are returned
+// back to the queues of the topics they were published on.
+func (m *Memory) unsubscribe(s sub) {
+	m.Lock()
+	defer m.Unlock()
+
+	var removed *Subscriber
+
+	if broker.IsPattern(s.topic) {
+		removed = m.wildcards[s.id]
+		delete(m.wildcards, s.id)
+		for name, t := range m.topics {
+			if broker.MatchTopic(s.topic, name) {
+				t.removeSub(s.id)
+			}
+		}
+	} else if t, ok := m.topics[s.topic]; ok {
+		removed = t.removeSub(s.id)
+	}
+
+	if removed != nil {
+		exit := m.exit
+		m.goroutine(func() bool { return requeue(removed, exit) })
+	}
+}
+
+// requeue returns messages which were delivered to subscriber s by FanIn
+// topics but never received back to the topic queues. Messages delivered
+// by FanOut topics are dropped as every subscriber gets its own copy.
+// It returns false if the broker exited before a message was requeued.
+func requeue(s *Subscriber, exit <-chan struct{}) bool {
+	for {
+		select {
+		case env := <-s.queue:
+			if env.topic.sink != broker.FanIn {
+				continue
+			}
+			select {
+			case env.topic.queue(env.msg) <- env.msg:
+			case <-exit:
+				return false
 			}
-			m.Unlock()
+		default:
+			return true
 		}
 	}
 }
 
+// checkSink returns broker.ErrSinkConflict if opts set the sink
+// of existing topic with the given name to a different sink.
+// NOTE: this must be called with the broker lock held.
+func (m *Memory) checkSink(name string, opts ...broker.Option) error {
+	t, ok := m.topics[name]
+	if !ok {
+		return nil
+	}
+
+	o := broker.Options{Sink: t.sink}
+	for _, apply := range opts {
+		apply(&o)
+	}
+
+	if o.Sink != t.sink {
+		return fmt.Errorf("%w: topic %s", broker.ErrSinkConflict, name)
+	}
+
+	return nil
+}
+
+// topic returns the topic with the given name.
+// If the topic does not exist it is created with the sink and partitions
+// given by opts and subscribed to by all matching wildcard subscribers.
+// NOTE: this must be called with the broker lock held.
+func (m *Memory) topic(name string, opts broker.Options) *topic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = newTopic(name, opts.Sink, m.size, opts.Partitions, opts.PartitionKey)
+		for _, sub := range m.wildcards {
+			if broker.MatchTopic(sub.topic, name) {
+				t.addSub(sub)
+			}
+		}
+		m.topics[name] = t
+		exit := m.exit
+		reclaim := func(s *Subscriber) {
+			m.goroutine(func() bool { return requeue(s, exit) })
+		}
+		for p := range t.queues {
+			p := p
+			m.goroutine(func() bool { return t.dispatch(p, exit, reclaim) })
+		}
+	}
+	return t
+}
+
 // Open opens a new broker session.
 func (m *Memory) Open(ctx context.Context, opts ...broker.Option) error {
 	m.RLock()
@@ -98,124 +260,469 @@ func (m *Memory) Open(ctx context.Context, opts ...broker.Option) error {
 	defer m.Unlock()
 
 	m.connected = true
+	m.lost = 0
+	m.abortErr = nil
+	m.stop = make(chan struct{})
 	m.exit = make(chan struct{})
 	m.ctl = make(chan sub, DefaultSize)
 
-	// TODO: we should make sure Close() stops this goroutine
-	// Try adding it to a sync.WaitGroup
-	go m.run(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(ctx)
+	}()
 
 	return nil
 }
 
-func (m *Memory) publishMsg(ctx context.Context, q queue, msg broker.Message, timeout time.Duration) error {
-	select {
-	case <-ctx.Done():
-		return m.Close()
-	case <-m.exit:
-		return nil
-	case <-time.After(timeout):
-		return broker.ErrTimeout
-	case q.msg <- msg:
-		return nil
-	}
+// accepting returns true if broker accepts new messages and subscriptions.
+// NOTE: this must be called with the broker lock held.
+func (m *Memory) accepting() bool {
+	return m.connected && !m.closing
+}
+
+func (m *Memory) publishMsg(ctx context.Context, t *topic, msg broker.Message, p broker.Overflow, timeout time.Duration, stop <-chan struct{}) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	return t.publish(ctx, msg, p, timer.C, stop)
 }
 
 // Pub publishes m on the given topic.
 // If the topic does not exist, it is automatically created.
+// New topics use the broker sink and partitions unless overridden
+// by WithSink and WithPartitions options; WithSink option which conflicts
+// with the sink of existing topic fails with broker.ErrSinkConflict.
+// Messages published without UID are assigned a new one.
+// If the topic queue is full, msg is handled following the broker
+// overflow policy unless overridden by WithOverflow option.
 // NOTE: Pub is a blocking call!
 func (m *Memory) Pub(ctx context.Context, topic string, msg broker.Message, opts ...broker.Option) error {
 	m.RLock()
-	if !m.connected {
+	if !m.accepting() {
 		m.RUnlock()
 		return broker.ErrNotConnected
 	}
 	m.RUnlock()
 
-	popts := broker.Options{}
+	popts := broker.Options{
+		Sink:         m.sink,
+		Overflow:     m.overflow,
+		Partitions:   m.partitions,
+		PartitionKey: m.key,
+	}
 	for _, apply := range opts {
 		apply(&popts)
 	}
 
+	if err := broker.ValidTopic(topic); err != nil {
+		return err
+	}
+
 	pubTimeout := popts.PubTimeout
 	if pubTimeout == 0 {
 		pubTimeout = m.pubTimeout
 	}
 
+	if msg.UID == "" {
+		msg.UID = memuid.New().String()
+	}
+
 	m.Lock()
-	q, ok := m.topics[topic]
-	if !ok {
-		q = queue{
-			msg:  make(chan broker.Message, m.size),
-			exit: m.exit,
-		}
-		m.topics[topic] = q
+	if !m.accepting() {
+		m.Unlock()
+		return broker.ErrNotConnected
+	}
+	if err := m.checkSink(topic, opts...); err != nil {
+		m.Unlock()
+		return err
+	}
+	t, stop := m.topic(topic, popts), m.stop
+	m.Unlock()
+
+	return m.publishMsg(ctx, t, msg, popts.Overflow, pubTimeout, stop)
+}
+
+// deadLetter publishes msg on the dead-letter topic.
+// Unlike Pub it publishes while the broker is being closed so messages
+// rejected by subscribers draining the broker are not dropped.
+// If msg can't be published it's recorded as lost.
+func (m *Memory) deadLetter(ctx context.Context, topic string, msg broker.Message) error {
+	if err := broker.ValidTopic(topic); err != nil {
+		m.lose(1)
+		return fmt.Errorf("dead-letter message %s dropped: %w", msg.UID, err)
+	}
+
+	m.Lock()
+	if !m.connected || m.exited() {
+		m.Unlock()
+		m.lose(1)
+		return fmt.Errorf("dead-letter message %s dropped: %w", msg.UID, broker.ErrNotConnected)
+	}
+
+	popts := broker.Options{
+		Sink:         m.sink,
+		Partitions:   m.partitions,
+		PartitionKey: m.key,
+	}
+	t, exit := m.topic(topic, popts), m.exit
+	m.Unlock()
+
+	if err := m.publishMsg(ctx, t, msg, m.overflow, m.pubTimeout, exit); err != nil {
+		m.lose(1)
+		return fmt.Errorf("dead-letter message %s dropped: %w", msg.UID, err)
+	}
+
+	return nil
+}
+
+// exited returns true if the broker goroutines have been told to exit.
+// NOTE: this must be called with the broker lock held.
+func (m *Memory) exited() bool {
+	select {
+	case <-m.exit:
+		return true
+	default:
+		return false
+	}
+}
+
+// BulkPub publishes messages in mx on the given topic in order.
+// If the topic does not exist, it is automatically created.
+// Publish timeout and overflow policy apply to every message in mx. If not all messages
+// could be published BulkPub returns *broker.BulkPubError which reports
+// how many messages were published before the failure.
+// NOTE: BulkPub is a blocking call!
+func (m *Memory) BulkPub(ctx context.Context, topic string, mx []broker.Message, opts ...broker.Option) error {
+	m.RLock()
+	if !m.accepting() {
+		m.RUnlock()
+		return broker.ErrNotConnected
+	}
+	m.RUnlock()
+
+	popts := broker.Options{
+		Sink:         m.sink,
+		Overflow:     m.overflow,
+		Partitions:   m.partitions,
+		PartitionKey: m.key,
+	}
+	for _, apply := range opts {
+		apply(&popts)
+	}
+
+	if err := broker.ValidTopic(topic); err != nil {
+		return err
+	}
+
+	pubTimeout := popts.PubTimeout
+	if pubTimeout == 0 {
+		pubTimeout = m.pubTimeout
+	}
+
+	m.Lock()
+	if !m.accepting() {
+		m.Unlock()
+		return broker.ErrNotConnected
+	}
+	if err := m.checkSink(topic, opts...); err != nil {
+		m.Unlock()
+		return err
 	}
+	t, stop := m.topic(topic, popts), m.stop
 	m.Unlock()
 
-	return m.publishMsg(ctx, q, msg, pubTimeout)
+	timer := time.NewTimer(pubTimeout)
+	defer timer.Stop()
+
+	for i, msg := range mx {
+		if msg.UID == "" {
+			msg.UID = memuid.New().String()
+		}
+
+		if i > 0 {
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(pubTimeout)
+		}
+
+		if err := t.publish(ctx, msg, popts.Overflow, timer.C, stop); err != nil {
+			return &broker.BulkPubError{Published: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Stats returns broker statistics.
+func (m *Memory) Stats(ctx context.Context) (broker.Stats, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if !m.connected {
+		return broker.Stats{}, broker.ErrNotConnected
+	}
+
+	stats := broker.Stats{
+		Topics: make(map[string]broker.TopicStats, len(m.topics)),
+	}
+
+	for name, t := range m.topics {
+		stats.Topics[name] = t.stats()
+	}
+
+	return stats, nil
 }
 
 // Sub subscribes to the given topic.
+// If the topic does not exist, it is automatically created.
+// New topics use the broker sink unless overridden by WithSink option;
+// WithSink option which conflicts with the sink of existing topic fails
+// with broker.ErrSinkConflict.
+// Every subscriber has its own queue: FanIn topics deliver each message
+// to exactly one of their subscribers, FanOut topics deliver each message
+// to all of their subscribers.
+// If topic is a pattern the subscriber receives messages from all existing
+// and future topics matching the pattern as defined by broker.MatchTopic;
+// messages are delivered to it following the sink of the matched topic.
+// Partitioned topics queue messages to partitions by message partition key.
+// Every partition of a FanIn topic is owned by one of its subscribers which
+// receives all messages from the partition in the order they were published;
+// partitions are reassigned whenever topic subscribers change.
+// Rejected messages are redelivered with exponential backoff up to
+// DefaultMaxAttempts times unless configured otherwise; negative
+// MaxAttempts option enables unlimited redelivery.
+// NOTE: redelivered messages are received out of order.
 func (m *Memory) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
 	m.RLock()
-	if !m.connected {
+	if !m.accepting() {
 		m.RUnlock()
 		return nil, broker.ErrNotConnected
 	}
 	m.RUnlock()
 
+	sopts := broker.Options{
+		Sink:         m.sink,
+		Partitions:   m.partitions,
+		PartitionKey: m.key,
+	}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	if sopts.AckTimeout == 0 {
+		sopts.AckTimeout = DefaultAckTimeout
+	}
+
+	if sopts.MaxAttempts == 0 {
+		sopts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if sopts.Backoff == nil {
+		sopts.Backoff = broker.ExponentialBackoff(DefaultBackoff, DefaultTimeout)
+	}
+
+	if err := broker.ValidPattern(topic); err != nil {
+		return nil, err
+	}
+
 	uid := memuid.New()
 
 	m.Lock()
 	defer m.Unlock()
 
-	q, ok := m.topics[topic]
-	if !ok {
-		q = queue{
-			msg:  make(chan broker.Message, m.size),
-			exit: m.exit,
-		}
-		m.topics[topic] = q
+	if !m.accepting() {
+		return nil, broker.ErrNotConnected
 	}
 
 	sub := &Subscriber{
-		id:     uid.String(),
-		topic:  topic,
-		active: true,
-		queue:  q,
-		ctl:    m.ctl,
-		exit:   make(chan struct{}),
+		id:       uid.String(),
+		topic:    topic,
+		active:   true,
+		opts:     sopts,
+		queue:    make(chan envelope, m.size),
+		inflight: make(map[string]*delivery),
+		broker:   m,
+		ctl:      m.ctl,
+		done:     m.exit,
+		exit:     make(chan struct{}),
 	}
 
-	if m.subs[topic][sub.id] == nil {
-		m.subs[topic] = make(map[string]*Subscriber)
+	if broker.IsPattern(topic) {
+		for name, t := range m.topics {
+			if broker.MatchTopic(topic, name) {
+				t.addSub(sub)
+			}
+		}
+		m.wildcards[sub.id] = sub
+		return sub, nil
+	}
+
+	if err := m.checkSink(topic, opts...); err != nil {
+		return nil, err
 	}
-	m.subs[topic][sub.id] = sub
+
+	m.topic(topic, sopts).addSub(sub)
 
 	return sub, nil
 }
 
+// drained returns true if all messages have been received and acknowledged
+// by subscribers. Messages in topics with no subscribers are ignored.
+func (m *Memory) drained() bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, t := range m.topics {
+		if !t.drained() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// drain waits until broker has been drained or until ctx is done.
+// NOTE: broker must be drained on two consecutive checks as messages
+// are briefly invisible when handed over between queues and handlers.
+func (m *Memory) drain(ctx context.Context) {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	checks := 0
+	for checks < 2 {
+		if m.drained() {
+			checks++
+		} else {
+			checks = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// undelivered returns the number of messages left in the broker
+// and stops ack timers of all inflight messages.
+// NOTE: this must be called with the broker lock held.
+func (m *Memory) undelivered() int {
+	n := int(atomic.SwapInt64(&m.lost, 0))
+
+	subs := make(map[string]*Subscriber)
+	for _, t := range m.topics {
+		n += t.depth()
+		ts, _ := t.subscribers()
+		for _, s := range ts {
+			subs[s.id] = s
+		}
+	}
+
+	for _, s := range m.wildcards {
+		subs[s.id] = s
+	}
+
+	for _, s := range subs {
+		n += len(s.queue) + s.stop()
+	}
+
+	return n
+}
+
 // Close closes broker session.
-func (m *Memory) Close() error {
+// Broker stops accepting new messages and subscriptions immediately
+// and waits until subscribers receive and acknowledge all messages
+// or until ctx is done. Once all broker goroutines have stopped, Close
+// returns *broker.DrainError if any of the messages were not delivered.
+// Close called while the broker is being closed waits until the broker
+// is closed and returns the error of the close.
+// If the broker has been closed because its Open context was done,
+// Close returns the error of that close.
+func (m *Memory) Close(ctx context.Context) error {
+	return m.shutdown(ctx, false)
+}
+
+// shutdown closes broker session. If abort is true, the broker is closed
+// because its Open context is done and the error of the close is kept
+// until it's returned by Close.
+func (m *Memory) shutdown(ctx context.Context, abort bool) error {
 	m.Lock()
-	defer m.Unlock()
+	if m.closing {
+		closed := m.closed
+		m.Unlock()
+
+		<-closed
+
+		m.Lock()
+		defer m.Unlock()
+		// NOTE: the error of aborted close has been reported
+		m.abortErr = nil
+
+		return m.closeErr
+	}
 
 	if !m.connected {
-		return nil
+		err := m.abortErr
+		m.abortErr = nil
+		m.Unlock()
+		return err
+	}
+
+	m.closing = true
+	m.closed = make(chan struct{})
+	close(m.stop)
+	m.Unlock()
+
+	err := m.close(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.closeErr = err
+	if abort {
+		m.abortErr = err
 	}
+	m.closing = false
+	close(m.closed)
+
+	return err
+}
+
+// close drains the broker until ctx is done and stops its goroutines.
+func (m *Memory) close(ctx context.Context) error {
+	m.drain(ctx)
 
+	m.Lock()
 	close(m.exit)
+	m.Unlock()
 
-	for topic, subs := range m.subs {
-		for id := range subs {
-			delete(m.subs[topic], id)
-		}
-		delete(m.subs, topic)
-		delete(m.topics, topic)
+	m.wg.Wait()
+
+	m.Lock()
+	defer m.Unlock()
+
+	undelivered := m.undelivered()
+
+	for name := range m.topics {
+		delete(m.topics, name)
+	}
+
+	for id := range m.wildcards {
+		delete(m.wildcards, id)
 	}
 
 	m.connected = false
 
+	if undelivered > 0 {
+		err := ctx.Err()
+		if err == nil {
+			err = broker.ErrUndelivered
+		}
+		return &broker.DrainError{Undelivered: undelivered, Err: err}
+	}
+
 	return nil
 }
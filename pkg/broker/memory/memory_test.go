@@ -3,6 +3,8 @@ package memory
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,6 +20,18 @@ func MustBroker(t *testing.T, opts ...broker.Option) *Memory {
 	return b
 }
 
+// MustClose closes broker b giving subscribers a short time to drain it.
+// Undelivered messages are not considered a failure.
+func MustClose(t *testing.T, b *Memory) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var drainErr *broker.DrainError
+	if err := b.Close(ctx); err != nil && !errors.As(err, &drainErr) {
+		t.Errorf("failed to close broker session: %v", err)
+	}
+}
+
 func TestOpen(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -34,9 +48,7 @@ func TestOpen(t *testing.T) {
 			t.Errorf("expected broker session to be connected")
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 
 	t.Run("DoubleOpen", func(t *testing.T) {
@@ -54,9 +66,7 @@ func TestOpen(t *testing.T) {
 			t.Fatalf("failed to open broker session: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 }
 
@@ -82,9 +92,7 @@ func TestPub(t *testing.T) {
 			t.Fatalf("failed to publish message: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 
 	t.Run("PublishOnExistingTopic", func(t *testing.T) {
@@ -111,9 +119,7 @@ func TestPub(t *testing.T) {
 			t.Fatalf("failed to publish message: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 
 	t.Run("PublishTimeout", func(t *testing.T) {
@@ -136,9 +142,7 @@ func TestPub(t *testing.T) {
 			t.Fatalf("expected error: %v, got: %v", broker.ErrTimeout, err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 
 	t.Run("PublishConcurrentlyOnExistingTopic", func(t *testing.T) {
@@ -172,9 +176,7 @@ func TestPub(t *testing.T) {
 			}
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 
 	t.Run("PublishNotConnected", func(t *testing.T) {
@@ -192,6 +194,211 @@ func TestPub(t *testing.T) {
 	})
 }
 
+func TestBulkPub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+	mx := []broker.Message{
+		{UID: "fooID", Data: []byte(`foo data`)},
+		{UID: "barID", Data: []byte(`bar data`)},
+		{UID: "bazID", Data: []byte(`baz data`)},
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(len(mx)))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.BulkPub(context.Background(), topic, mx); err != nil {
+			t.Fatalf("failed to publish messages: %v", err)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("PartialTimeout", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(len(mx)-1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		pt := 100 * time.Millisecond
+
+		err := b.BulkPub(context.Background(), topic, mx, broker.WithPubTimeout(pt))
+		if !errors.Is(err, broker.ErrTimeout) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		var bulkErr *broker.BulkPubError
+		if !errors.As(err, &bulkErr) {
+			t.Fatalf("expected error type: %T, got: %T", bulkErr, err)
+		}
+
+		if exp := len(mx) - 1; bulkErr.Published != exp {
+			t.Errorf("expected published: %d, got: %d", exp, bulkErr.Published)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("PublishNotConnected", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.BulkPub(context.Background(), topic, mx); !errors.Is(err, broker.ErrNotConnected) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+}
+
+func TestOverflow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+	mx := []broker.Message{
+		{UID: "fooID", Data: []byte(`foo data`)},
+		{UID: "barID", Data: []byte(`bar data`)},
+	}
+
+	testCases := []struct {
+		overflow broker.Overflow
+		err      error
+		uid      string
+	}{
+		{broker.DropOldest, nil, "barID"},
+		{broker.DropNewest, nil, "fooID"},
+		{broker.Reject, broker.ErrQueueFull, "fooID"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.overflow.String(), func(t *testing.T) {
+			b := MustBroker(t, broker.WithCap(1), broker.WithOverflow(tc.overflow))
+
+			if err := b.Open(context.Background()); err != nil {
+				t.Fatalf("failed to open broker session: %v", err)
+			}
+
+			for i, msg := range mx {
+				err := b.Pub(context.Background(), topic, msg)
+				if i == 0 && err != nil {
+					t.Fatalf("failed to publish message: %v", err)
+				}
+				if i > 0 && !errors.Is(err, tc.err) {
+					t.Fatalf("expected error: %v, got: %v", tc.err, err)
+				}
+			}
+
+			sub, err := b.Sub(context.Background(), topic)
+			if err != nil {
+				t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+			}
+
+			h := func(ctx context.Context, m broker.Message) error {
+				if m.UID != tc.uid {
+					t.Errorf("expected message: %s, got: %s", tc.uid, m.UID)
+				}
+				return nil
+			}
+
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Errorf("failed receiving message: %v", err)
+			}
+
+			MustClose(t, b)
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+	msg := broker.Message{UID: "fooID", Data: []byte(`foo data`)}
+
+	t.Run("Stats", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		pt := 10 * time.Millisecond
+		if err := b.Pub(context.Background(), topic, msg, broker.WithPubTimeout(pt)); !errors.Is(err, broker.ErrTimeout) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		stats, err := b.Stats(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get broker stats: %v", err)
+		}
+
+		ts, ok := stats.Topics[topic]
+		if !ok {
+			t.Fatalf("topic %s stats not found", topic)
+		}
+
+		if ts.Depth != 1 || ts.Cap != 1 {
+			t.Errorf("expected depth: 1/1, got: %d/%d", ts.Depth, ts.Cap)
+		}
+
+		if ts.Published != 1 || ts.Timeouts != 1 {
+			t.Errorf("expected published: 1, timeouts: 1, got: %d, %d", ts.Published, ts.Timeouts)
+		}
+
+		sub, err := b.Sub(context.Background(), topic, broker.WithManualAck())
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error { return nil }
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiving message: %v", err)
+		}
+
+		stats, err = b.Stats(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get broker stats: %v", err)
+		}
+
+		id, err := sub.ID(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get subscriber ID: %v", err)
+		}
+
+		ss, ok := stats.Topics[topic].Subscribers[id]
+		if !ok {
+			t.Fatalf("subscriber %s stats not found", id)
+		}
+
+		if ss.Lag != 0 || ss.InFlight != 1 {
+			t.Errorf("expected lag: 0, inflight: 1, got: %d, %d", ss.Lag, ss.InFlight)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("NotConnected", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if _, err := b.Stats(context.Background()); !errors.Is(err, broker.ErrNotConnected) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+}
+
 func TestSub(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -221,9 +428,7 @@ func TestSub(t *testing.T) {
 			t.Errorf("expected topic: %s, tot: %s", topic, tp)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
-		}
+		MustClose(t, b)
 	})
 
 	t.Run("SubscribeToExistingTopic", func(t *testing.T) {
@@ -257,9 +462,267 @@ func TestSub(t *testing.T) {
 			t.Errorf("expected topic: %s, tot: %s", topic, tp)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
+		MustClose(t, b)
+	})
+
+	t.Run("SubscribeToPattern", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		msg := broker.Message{
+			UID:  "fooID",
+			Data: []byte(`foo data`),
+		}
+
+		// NOTE: cluster1 topic exists before subscribing
+		if err := b.Pub(context.Background(), "k8s.cluster1.objects", msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		sub, err := b.Sub(context.Background(), "k8s.*.objects")
+		if err != nil {
+			t.Fatalf("failed to subscribe to pattern: %v", err)
+		}
+
+		// NOTE: cluster2 topic is created after subscribing
+		if err := b.Pub(context.Background(), "k8s.cluster2.objects", msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), "k8s.cluster2.links", msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		count := 0
+		h := func(ctx context.Context, m broker.Message) error {
+			count++
+			return nil
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Fatalf("failed receiving message: %v", err)
+			}
+		}
+
+		rt := 50 * time.Millisecond
+
+		if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(rt)); !errors.Is(err, broker.ErrTimeout) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		if exp := 2; count != exp {
+			t.Errorf("expected messages: %d, got: %d", exp, count)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("UnsubscribeFromPattern", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		msg := broker.Message{
+			UID:  "fooID",
+			Data: []byte(`foo data`),
+		}
+
+		sub, err := b.Sub(context.Background(), "k8s.*.objects")
+		if err != nil {
+			t.Fatalf("failed to subscribe to pattern: %v", err)
+		}
+
+		topic := "k8s.cluster1.objects"
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		// NOTE: wait until the message is delivered to pattern subscriber
+		for len(sub.(*Subscriber).queue) == 0 {
+			time.Sleep(time.Millisecond)
 		}
+
+		if err := sub.Unsubscribe(context.Background()); err != nil {
+			t.Fatalf("failed to unsubscribe: %v", err)
+		}
+
+		sub, err = b.Sub(context.Background(), topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			if m.UID != msg.UID {
+				return fmt.Errorf("expected msg ID: %s, got: %s", msg.UID, m.UID)
+			}
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(time.Second)); err != nil {
+			t.Errorf("failed receiving requeued message: %v", err)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("UnsubscribeDuringPublish", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(4))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+
+		sub1, err := b.Sub(context.Background(), topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		sub2, err := b.Sub(context.Background(), topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		const count = 200
+
+		var mu sync.Mutex
+		received := make(map[string]int)
+
+		h := func(ctx context.Context, m broker.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[m.UID]++
+			return nil
+		}
+
+		done := make(chan struct{})
+		receive := func(sub broker.Subscriber) {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				err := sub.Receive(context.Background(), h, broker.WithSubTimeout(10*time.Millisecond))
+				if err != nil && !errors.Is(err, broker.ErrTimeout) {
+					return
+				}
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, sub := range []broker.Subscriber{sub1, sub2} {
+			wg.Add(1)
+			go func(sub broker.Subscriber) {
+				defer wg.Done()
+				receive(sub)
+			}(sub)
+		}
+
+		go func() {
+			for i := 0; i < count; i++ {
+				msg := broker.Message{UID: fmt.Sprintf("%d", i)}
+				if err := b.Pub(context.Background(), topic, msg); err != nil {
+					t.Errorf("failed to publish message: %v", err)
+					return
+				}
+
+				if i == count/4 {
+					if err := sub1.Unsubscribe(context.Background()); err != nil {
+						t.Errorf("failed to unsubscribe: %v", err)
+					}
+				}
+			}
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			n := len(received)
+			mu.Unlock()
+
+			if n == count || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		close(done)
+		wg.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(received) != count {
+			t.Errorf("expected delivered messages: %d, got: %d", count, len(received))
+		}
+
+		for uid, n := range received {
+			if n != 1 {
+				t.Errorf("expected message %s delivered once, got: %d", uid, n)
+			}
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("SinkConflict", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+
+		if _, err := b.Sub(context.Background(), topic, broker.WithSink(broker.FanOut)); err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if _, err := b.Sub(context.Background(), topic); err != nil {
+			t.Errorf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if _, err := b.Sub(context.Background(), topic, broker.WithSink(broker.FanIn)); !errors.Is(err, broker.ErrSinkConflict) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrSinkConflict, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, broker.Message{}, broker.WithSink(broker.FanIn)); !errors.Is(err, broker.ErrSinkConflict) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrSinkConflict, err)
+		}
+
+		if err := b.BulkPub(context.Background(), topic, []broker.Message{{}}, broker.WithSink(broker.FanIn)); !errors.Is(err, broker.ErrSinkConflict) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrSinkConflict, err)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("InvalidTopic", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if _, err := b.Sub(context.Background(), "k8s.>.objects"); !errors.Is(err, broker.ErrInvalidTopic) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrInvalidTopic, err)
+		}
+
+		if err := b.Pub(context.Background(), "k8s.>", broker.Message{}); !errors.Is(err, broker.ErrInvalidTopic) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrInvalidTopic, err)
+		}
+
+		MustClose(t, b)
 	})
 
 	t.Run("SubscribeNotConnected", func(t *testing.T) {
@@ -285,7 +748,7 @@ func TestClose(t *testing.T) {
 			t.Fatalf("failed to open broker session: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
+		if err := b.Close(context.Background()); err != nil {
 			t.Fatalf("failed closing session: %v", err)
 		}
 	})
@@ -297,12 +760,191 @@ func TestClose(t *testing.T) {
 			t.Fatalf("failed to open broker session: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
+		if err := b.Close(context.Background()); err != nil {
 			t.Fatalf("failed closing session: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
+		if err := b.Close(context.Background()); err != nil {
+			t.Fatalf("failed closing session: %v", err)
+		}
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(10))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		sub, err := b.Sub(context.Background(), topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		mx := []broker.Message{{UID: "fooID"}, {UID: "barID"}}
+		if err := b.BulkPub(context.Background(), topic, mx); err != nil {
+			t.Fatalf("failed to publish messages: %v", err)
+		}
+
+		received := make(chan int)
+		go func() {
+			count := 0
+			h := func(ctx context.Context, m broker.Message) error {
+				count++
+				return nil
+			}
+			for count < len(mx) {
+				if err := sub.Receive(context.Background(), h); err != nil {
+					break
+				}
+			}
+			received <- count
+		}()
+
+		if err := b.Close(context.Background()); err != nil {
 			t.Fatalf("failed closing session: %v", err)
 		}
+
+		if count := <-received; count != len(mx) {
+			t.Errorf("expected received: %d, got: %d", len(mx), count)
+		}
+
+		if err := b.Pub(context.Background(), topic, mx[0]); !errors.Is(err, broker.ErrNotConnected) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+
+	t.Run("ConcurrentClose", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(10))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		if _, err := b.Sub(context.Background(), topic); err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, broker.Message{UID: "fooID"}); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { errs <- b.Close(ctx) }()
+		}
+
+		for i := 0; i < 2; i++ {
+			var drainErr *broker.DrainError
+			if err := <-errs; !errors.As(err, &drainErr) {
+				t.Errorf("expected error type: %T, got: %v", drainErr, err)
+			}
+
+			b.RLock()
+			connected := b.connected
+			b.RUnlock()
+
+			if connected {
+				t.Errorf("expected broker closed once Close returns")
+			}
+		}
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(10))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if err := b.Open(ctx); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		if _, err := b.Sub(context.Background(), topic); err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, broker.Message{UID: "fooID"}); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		cancel()
+
+		// NOTE: wait until the broker has been closed
+		for {
+			b.RLock()
+			closed := !b.connected && !b.closing
+			b.RUnlock()
+			if closed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		var drainErr *broker.DrainError
+		if err := b.Close(context.Background()); !errors.As(err, &drainErr) {
+			t.Errorf("expected error type: %T, got: %v", drainErr, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed closing session: %v", err)
+		}
+	})
+
+	t.Run("Undelivered", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(10))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		if _, err := b.Sub(context.Background(), topic); err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		mx := []broker.Message{{UID: "fooID"}, {UID: "barID"}}
+		if err := b.BulkPub(context.Background(), topic, mx); err != nil {
+			t.Fatalf("failed to publish messages: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := b.Close(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected error: %v, got: %v", context.DeadlineExceeded, err)
+		}
+
+		var drainErr *broker.DrainError
+		if !errors.As(err, &drainErr) {
+			t.Fatalf("expected error type: %T, got: %T", drainErr, err)
+		}
+
+		if drainErr.Undelivered != len(mx) {
+			t.Errorf("expected undelivered: %d, got: %d", len(mx), drainErr.Undelivered)
+		}
+	})
+
+	t.Run("NoSubscribers", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(10))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), "foo", broker.Message{UID: "fooID"}); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := b.Close(context.Background()); !errors.Is(err, broker.ErrUndelivered) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrUndelivered, err)
+		}
 	})
 }
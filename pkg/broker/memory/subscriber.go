@@ -2,21 +2,35 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/milosgajdos/netscrape/pkg/broker"
 )
 
+// delivery is a message awaiting acknowledgement.
+type delivery struct {
+	msg   broker.Message
+	topic *topic
+	timer *time.Timer
+}
+
 // Subscriber is broker subscriber.
 type Subscriber struct {
 	sync.RWMutex
-	id     string
-	topic  string
-	active bool
-	queue  queue
-	ctl    chan<- sub
-	exit   chan struct{}
+	id       string
+	topic    string
+	active   bool
+	opts     broker.Options
+	queue    chan envelope
+	inflight map[string]*delivery
+	// redelivering is the number of messages awaiting redelivery.
+	redelivering int
+	broker       *Memory
+	ctl          chan<- sub
+	done         <-chan struct{}
+	exit         chan struct{}
 }
 
 // ID returns subscriber ID
@@ -29,27 +43,258 @@ func (s *Subscriber) Topic(ctx context.Context, opts ...broker.Option) (string,
 	return s.topic, nil
 }
 
-// Unsubscribe unsubscribes from the topic.
-func (s *Subscriber) Unsubscribe(ctx context.Context, opts ...broker.Option) error {
+// stats returns subscriber statistics.
+func (s *Subscriber) stats() broker.SubscriberStats {
 	s.RLock()
 	defer s.RUnlock()
 
-	if s.active {
-		close(s.exit)
-		s.active = false
-		// TODO(milosgajdos): should this really be async?
-		go func(id, topic string) {
-			select {
-			case s.ctl <- sub{id: id, topic: topic}:
-			case <-s.queue.exit:
+	return broker.SubscriberStats{
+		Lag:      len(s.queue),
+		InFlight: len(s.inflight),
+	}
+}
+
+// Partitions returns topic partitions owned by subscriber.
+// FanOut topic subscribers receive messages from all topic partitions.
+// Subscribers to topic patterns don't own any partitions.
+func (s *Subscriber) Partitions(ctx context.Context) ([]int, error) {
+	s.broker.RLock()
+	t, ok := s.broker.topics[s.topic]
+	s.broker.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	return t.partitions(s.id), nil
+}
+
+// drained returns true if subscriber has no messages
+// waiting to be received, acknowledged or redelivered.
+func (s *Subscriber) drained() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.queue) == 0 && len(s.inflight) == 0 && s.redelivering == 0
+}
+
+// stop stops ack timers of inflight messages and returns their count.
+func (s *Subscriber) stop() int {
+	s.Lock()
+	defer s.Unlock()
+
+	n := len(s.inflight)
+	for uid, d := range s.inflight {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		delete(s.inflight, uid)
+	}
+
+	return n
+}
+
+// unsubscribed returns true if subscriber has unsubscribed.
+func (s *Subscriber) unsubscribed() bool {
+	select {
+	case <-s.exit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Unsubscribe unsubscribes from the topic.
+// Unacknowledged messages and messages awaiting redelivery are returned
+// to the FanIn topics they were published on, or published on the
+// dead-letter topic if they have been delivered max attempts times.
+func (s *Subscriber) Unsubscribe(ctx context.Context, opts ...broker.Option) error {
+	s.Lock()
+	if !s.active {
+		s.Unlock()
+		return nil
+	}
+
+	close(s.exit)
+	s.active = false
+	unacked := make([]*delivery, 0, len(s.inflight))
+	for uid, d := range s.inflight {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		delete(s.inflight, uid)
+		unacked = append(unacked, d)
+	}
+	s.Unlock()
+
+	if len(unacked) > 0 {
+		reclaimed := s.broker.spawn(func() bool {
+			for i, d := range unacked {
+				if !s.reclaim(d.msg, d.topic) {
+					s.broker.lose(len(unacked) - i - 1)
+					return false
+				}
 			}
-		}(s.id, s.topic)
+			return true
+		})
+
+		if !reclaimed {
+			s.broker.lose(len(unacked))
+		}
 	}
 
+	// TODO(milosgajdos): should this really be async?
+	s.broker.spawn(func() bool {
+		select {
+		case s.ctl <- sub{id: s.id, topic: s.topic}:
+		case <-s.done:
+		}
+		return true
+	})
+
 	return nil
 }
 
-// Receive processes received messages with handler
+// track starts tracking delivery of msg from topic t until it's acked or nacked.
+// If manual ack is enabled, msg is nacked unless it's acked within ack timeout.
+func (s *Subscriber) track(msg broker.Message, t *topic) {
+	s.Lock()
+	defer s.Unlock()
+
+	d := &delivery{msg: msg, topic: t}
+	if s.opts.ManualAck {
+		d.timer = time.AfterFunc(s.opts.AckTimeout, func() {
+			// NOTE: the message might have been acked already
+			_ = s.Nack(context.Background(), msg)
+		})
+	}
+
+	s.inflight[msg.UID] = d
+}
+
+// untrack stops tracking delivery of msg and returns it.
+func (s *Subscriber) untrack(msg broker.Message) (*delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d, ok := s.inflight[msg.UID]
+	if !ok || d.msg.Attempt != msg.Attempt {
+		return nil, broker.ErrNotInFlight
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	delete(s.inflight, msg.UID)
+
+	return d, nil
+}
+
+// Ack acknowledges the message has been processed.
+func (s *Subscriber) Ack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	_, err := s.untrack(msg)
+	return err
+}
+
+// Nack rejects the message so it is redelivered after backoff.
+// Once the message has been delivered max attempts times it is published
+// on the dead-letter topic, or dropped if no dead-letter topic is configured.
+// Messages are dead-lettered even while the broker is being closed; if the
+// message can't be dead-lettered it is dropped and Nack returns error.
+func (s *Subscriber) Nack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	d, err := s.untrack(msg)
+	if err != nil {
+		return err
+	}
+
+	if s.opts.MaxAttempts > 0 && d.msg.Attempt >= s.opts.MaxAttempts {
+		if s.opts.DeadLetter == "" {
+			return nil
+		}
+		msg := d.msg
+		msg.Attempt = 0
+		return s.broker.deadLetter(ctx, s.opts.DeadLetter, msg)
+	}
+
+	s.Lock()
+	s.redelivering++
+	s.Unlock()
+
+	delay := s.opts.Backoff(d.msg.Attempt)
+	if !s.broker.spawn(func() bool { return s.redeliver(envelope{msg: d.msg, topic: d.topic}, delay) }) {
+		s.Lock()
+		s.redelivering--
+		s.Unlock()
+		s.broker.lose(1)
+		return broker.ErrNotConnected
+	}
+
+	return nil
+}
+
+// redeliver queues env for redelivery after delay.
+// It returns false if the broker exited before env was queued.
+func (s *Subscriber) redeliver(env envelope, delay time.Duration) bool {
+	defer func() {
+		s.Lock()
+		s.redelivering--
+		s.Unlock()
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-s.done:
+		return false
+	case <-s.exit:
+		return s.reclaim(env.msg, env.topic)
+	case <-timer.C:
+	}
+
+	select {
+	case <-s.done:
+		return false
+	case <-s.exit:
+		return s.reclaim(env.msg, env.topic)
+	case s.queue <- env:
+		return true
+	}
+}
+
+// reclaim returns unacknowledged message msg of unsubscribed subscriber
+// to FanIn topic t, or publishes it on the dead-letter topic if it has been
+// delivered max attempts times. Messages of FanOut topics are dropped as
+// every subscriber gets its own copy.
+// It returns false if the broker exited before msg was returned to t.
+func (s *Subscriber) reclaim(msg broker.Message, t *topic) bool {
+	if s.opts.MaxAttempts > 0 && msg.Attempt >= s.opts.MaxAttempts {
+		if s.opts.DeadLetter != "" {
+			msg.Attempt = 0
+			// NOTE: deadLetter records the message as lost if it fails
+			_ = s.broker.deadLetter(context.Background(), s.opts.DeadLetter, msg)
+		}
+		return true
+	}
+
+	if t.sink != broker.FanIn {
+		return true
+	}
+
+	select {
+	case <-s.done:
+		return false
+	case t.queue(msg) <- msg:
+		return true
+	}
+}
+
+// Receive processes received messages with handler.
+// Messages are acked when h succeeds and nacked when it fails,
+// unless manual ack is enabled, in which case h is responsible
+// for acking the message before ack timeout expires.
+// Receive returns broker.ErrNotConnected once the broker is closed
+// and broker.ErrSubscriptionInactive once the subscriber unsubscribes.
 // NOTE: Receive is a blocking call!
 func (s *Subscriber) Receive(ctx context.Context, h broker.Handler, opts ...broker.Option) error {
 	ropts := broker.Options{}
@@ -73,20 +318,28 @@ func (s *Subscriber) Receive(ctx context.Context, h broker.Handler, opts ...brok
 	case <-ctx.Done():
 		return nil
 	case <-time.After(recvTimeout):
-		// NOTE: drop the message once the timeout expires
-		select {
-		case <-s.queue.msg:
-		default:
-		}
 		return broker.ErrTimeout
-	case <-s.queue.exit:
-		return nil
+	case <-s.done:
+		return broker.ErrNotConnected
 	case <-s.exit:
-		return nil
-	case msg := <-s.queue.msg:
+		return broker.ErrSubscriptionInactive
+	case env := <-s.queue:
+		msg := env.msg
+		msg.Attempt++
+		s.track(msg, env.topic)
+
 		if err := h(ctx, msg); err != nil {
+			if nerr := s.Nack(ctx, msg); nerr != nil && !errors.Is(nerr, broker.ErrNotInFlight) {
+				return nerr
+			}
 			return err
 		}
+
+		if !s.opts.ManualAck {
+			if err := s.Ack(ctx, msg); err != nil && !errors.Is(err, broker.ErrNotInFlight) {
+				return err
+			}
+		}
 	}
 
 	return nil
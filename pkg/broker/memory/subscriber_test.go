@@ -4,11 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/milosgajdos/netscrape/pkg/broker"
 )
 
+func MustSub(t *testing.T, b *Memory, topic string, opts ...broker.Option) broker.Subscriber {
+	sub, err := b.Sub(context.Background(), topic, opts...)
+	if err != nil {
+		t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+	}
+
+	return sub
+}
+
 func TestSubscribe(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -47,9 +58,7 @@ func TestSubscribe(t *testing.T) {
 			t.Fatal("subscriber IDs not unique")
 		}
 
-		if err := b.Close(); err != nil {
-			t.Fatalf("failed closing session: %v", err)
-		}
+		MustClose(t, b)
 	})
 }
 
@@ -80,9 +89,69 @@ func TestUnsubscribe(t *testing.T) {
 			t.Errorf("failed to unsubscribe: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Fatalf("failed closing session: %v", err)
+		MustClose(t, b)
+	})
+
+	t.Run("Unacked", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
 		}
+
+		topics, dlq := []string{"fooTopic", "barTopic"}, "fooDLQ"
+
+		dlqSub := MustSub(t, b, dlq)
+
+		msgs := []broker.Message{{UID: "fooID"}, {UID: "barID"}}
+		attempts := []int{2, 1}
+
+		for i, msg := range msgs {
+			sub := MustSub(t, b, topics[i],
+				broker.WithManualAck(),
+				broker.WithMaxAttempts(attempts[i]),
+				broker.WithDeadLetter(dlq))
+
+			if err := b.Pub(context.Background(), topics[i], msg); err != nil {
+				t.Fatalf("failed to publish message: %v", err)
+			}
+
+			h := func(ctx context.Context, m broker.Message) error { return nil }
+
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Fatalf("failed receiveing message: %v", err)
+			}
+
+			if err := sub.Unsubscribe(context.Background()); err != nil {
+				t.Fatalf("failed to unsubscribe: %v", err)
+			}
+		}
+
+		var received broker.Message
+		h := func(ctx context.Context, m broker.Message) error {
+			received = m
+			return nil
+		}
+
+		sub := MustSub(t, b, topics[0])
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiveing requeued message: %v", err)
+		}
+
+		if received.UID != msgs[0].UID || received.Attempt != 2 {
+			t.Errorf("expected message %s attempt: %d, got: %s, %d", msgs[0].UID, 2, received.UID, received.Attempt)
+		}
+
+		if err := dlqSub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiveing dead-letter message: %v", err)
+		}
+
+		if received.UID != msgs[1].UID {
+			t.Errorf("expected dead-letter message: %s, got: %s", msgs[1].UID, received.UID)
+		}
+
+		MustClose(t, b)
 	})
 
 	t.Run("DoubleUnsubscribe", func(t *testing.T) {
@@ -107,9 +176,7 @@ func TestUnsubscribe(t *testing.T) {
 			t.Errorf("failed to unsubscribe: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Fatalf("failed closing session: %v", err)
-		}
+		MustClose(t, b)
 	})
 }
 
@@ -158,9 +225,103 @@ func TestReceive(t *testing.T) {
 			t.Errorf("failed receiveing message: %v", err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Errorf("failed to close broker session: %v", err)
+		MustClose(t, b)
+	})
+
+	t.Run("FanOutReceive", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1), broker.WithSink(broker.FanOut))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
 		}
+
+		topic := "fooTopic"
+
+		subs := make([]broker.Subscriber, 3)
+		for i := range subs {
+			sub, err := b.Sub(context.Background(), topic)
+			if err != nil {
+				t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+			}
+			subs[i] = sub
+		}
+
+		msg := broker.Message{
+			UID:  "fooID",
+			Data: []byte(`foo data`),
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			if m.UID != msg.UID {
+				return fmt.Errorf("expected msg ID: %s, got: %s", msg.UID, m.UID)
+			}
+			return nil
+		}
+
+		for _, sub := range subs {
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Errorf("failed receiveing message: %v", err)
+			}
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("FanInReceive", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "fooTopic"
+
+		subs := make([]broker.Subscriber, 2)
+		for i := range subs {
+			sub, err := b.Sub(context.Background(), topic, broker.WithSink(broker.FanIn))
+			if err != nil {
+				t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+			}
+			subs[i] = sub
+		}
+
+		uids := []string{"fooID", "barID"}
+
+		for _, uid := range uids {
+			msg := broker.Message{
+				UID:  uid,
+				Data: []byte(`foo data`),
+			}
+
+			if err := b.Pub(context.Background(), topic, msg); err != nil {
+				t.Fatalf("failed to publish message: %v", err)
+			}
+		}
+
+		received := make(map[string]int)
+
+		h := func(ctx context.Context, m broker.Message) error {
+			received[m.UID]++
+			return nil
+		}
+
+		for _, sub := range subs {
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Errorf("failed receiveing message: %v", err)
+			}
+		}
+
+		for _, uid := range uids {
+			if count := received[uid]; count != 1 {
+				t.Errorf("expected message %s to be received once, got: %d", uid, count)
+			}
+		}
+
+		MustClose(t, b)
 	})
 
 	t.Run("InactiveReceive", func(t *testing.T) {
@@ -185,8 +346,389 @@ func TestReceive(t *testing.T) {
 			t.Errorf("expected error: %v, got: %v", broker.ErrSubscriptionInactive, err)
 		}
 
-		if err := b.Close(); err != nil {
-			t.Fatalf("failed closing session: %v", err)
+		MustClose(t, b)
+	})
+}
+
+func TestAck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	msg := broker.Message{
+		UID:  "fooID",
+		Data: []byte(`foo data`),
+	}
+
+	t.Run("RedeliverOnError", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "fooTopic"
+
+		sub, err := b.Sub(context.Background(), topic, broker.WithBackoff(broker.ConstantBackoff(0)))
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		errHandler := errors.New("handler error")
+
+		h := func(ctx context.Context, m broker.Message) error {
+			return errHandler
+		}
+
+		if err := sub.Receive(context.Background(), h); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		attempt := 0
+		h = func(ctx context.Context, m broker.Message) error {
+			attempt = m.Attempt
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiveing message: %v", err)
+		}
+
+		if exp := 2; attempt != exp {
+			t.Errorf("expected attempt: %d, got: %d", exp, attempt)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("ManualAck", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "fooTopic"
+
+		sub, err := b.Sub(context.Background(), topic, broker.WithManualAck())
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		var received broker.Message
+		h := func(ctx context.Context, m broker.Message) error {
+			received = m
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiveing message: %v", err)
+		}
+
+		if err := sub.Ack(context.Background(), received); err != nil {
+			t.Errorf("failed to ack message: %v", err)
+		}
+
+		if err := sub.Ack(context.Background(), received); !errors.Is(err, broker.ErrNotInFlight) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrNotInFlight, err)
 		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("AckTimeout", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "fooTopic"
+
+		sub, err := b.Sub(context.Background(), topic,
+			broker.WithManualAck(),
+			broker.WithAckTimeout(10*time.Millisecond),
+			broker.WithBackoff(broker.ConstantBackoff(0)))
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		attempt := 0
+		h := func(ctx context.Context, m broker.Message) error {
+			attempt = m.Attempt
+			return nil
+		}
+
+		for exp := 1; exp <= 2; exp++ {
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Fatalf("failed receiveing message: %v", err)
+			}
+
+			if attempt != exp {
+				t.Errorf("expected attempt: %d, got: %d", exp, attempt)
+			}
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic, dlq := "fooTopic", "fooDLQ"
+
+		sub, err := b.Sub(context.Background(), topic,
+			broker.WithMaxAttempts(2),
+			broker.WithBackoff(broker.ConstantBackoff(0)),
+			broker.WithDeadLetter(dlq))
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		dlqSub, err := b.Sub(context.Background(), dlq)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", dlq, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		errHandler := errors.New("handler error")
+
+		h := func(ctx context.Context, m broker.Message) error {
+			return errHandler
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := sub.Receive(context.Background(), h); !errors.Is(err, errHandler) {
+				t.Fatalf("expected error: %v, got: %v", errHandler, err)
+			}
+		}
+
+		h = func(ctx context.Context, m broker.Message) error {
+			if m.UID != msg.UID {
+				return fmt.Errorf("expected msg ID: %s, got: %s", msg.UID, m.UID)
+			}
+			return nil
+		}
+
+		if err := dlqSub.Receive(context.Background(), h); err != nil {
+			t.Errorf("failed receiveing dead-letter message: %v", err)
+		}
+
+		MustClose(t, b)
+	})
+
+	t.Run("DeadLetterOnClose", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic, dlq := "fooTopic", "fooDLQ"
+
+		sub, err := b.Sub(context.Background(), topic,
+			broker.WithMaxAttempts(1),
+			broker.WithDeadLetter(dlq))
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		dlqSub, err := b.Sub(context.Background(), dlq)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", dlq, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		closed := make(chan error, 1)
+		go func() { closed <- b.Close(ctx) }()
+
+		// NOTE: wait until the broker stops accepting messages
+		for {
+			b.RLock()
+			closing := b.closing
+			b.RUnlock()
+			if closing {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		errHandler := errors.New("handler error")
+
+		h := func(ctx context.Context, m broker.Message) error {
+			return errHandler
+		}
+
+		if err := sub.Receive(context.Background(), h); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		h = func(ctx context.Context, m broker.Message) error {
+			if m.UID != msg.UID {
+				return fmt.Errorf("expected msg ID: %s, got: %s", msg.UID, m.UID)
+			}
+			return nil
+		}
+
+		if err := dlqSub.Receive(context.Background(), h); err != nil {
+			t.Errorf("failed receiveing dead-letter message: %v", err)
+		}
+
+		if err := <-closed; err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("ReceiveTimeout", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(1))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "fooTopic"
+
+		sub, err := b.Sub(context.Background(), topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			return nil
+		}
+
+		rt := 10 * time.Millisecond
+
+		if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(rt)); !errors.Is(err, broker.ErrTimeout) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Errorf("failed receiveing message: %v", err)
+		}
+
+		MustClose(t, b)
+	})
+}
+
+func TestPartitions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("Ordered", func(t *testing.T) {
+		b := MustBroker(t, broker.WithCap(100), broker.WithPartitions(4))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		keys := []string{"foo", "bar", "baz", "qux", "quux"}
+		count := 10
+
+		var mx []broker.Message
+		for i := 0; i < count; i++ {
+			for _, key := range keys {
+				mx = append(mx, broker.Message{
+					UID:   fmt.Sprintf("%s-%d", key, i),
+					Attrs: map[string]string{broker.PartitionKeyAttr: key},
+				})
+			}
+		}
+
+		subs := []broker.Subscriber{
+			MustSub(t, b, topic),
+			MustSub(t, b, topic),
+		}
+
+		if err := b.BulkPub(context.Background(), topic, mx); err != nil {
+			t.Fatalf("failed to publish messages: %v", err)
+		}
+
+		var mu sync.Mutex
+		owners := make(map[string]string)
+		received := make(map[string][]string)
+
+		var wg sync.WaitGroup
+		for _, sub := range subs {
+			wg.Add(1)
+			go func(sub broker.Subscriber) {
+				defer wg.Done()
+				id, _ := sub.ID(context.Background())
+				h := func(ctx context.Context, m broker.Message) error {
+					key := m.Attrs[broker.PartitionKeyAttr]
+					mu.Lock()
+					defer mu.Unlock()
+					if owner, ok := owners[key]; ok && owner != id {
+						t.Errorf("key %s received by %s and %s", key, owner, id)
+					}
+					owners[key] = id
+					received[key] = append(received[key], m.UID)
+					return nil
+				}
+				for {
+					if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(200*time.Millisecond)); err != nil {
+						return
+					}
+				}
+			}(sub)
+		}
+		wg.Wait()
+
+		for _, key := range keys {
+			if len(received[key]) != count {
+				t.Fatalf("key %s: expected messages: %d, got: %d", key, count, len(received[key]))
+			}
+			for i, uid := range received[key] {
+				if exp := fmt.Sprintf("%s-%d", key, i); uid != exp {
+					t.Errorf("key %s: expected message %s, got: %s", key, exp, uid)
+				}
+			}
+		}
+
+		var owned []int
+		for _, sub := range subs {
+			px, err := sub.(*Subscriber).Partitions(context.Background())
+			if err != nil {
+				t.Fatalf("failed to get partitions: %v", err)
+			}
+			owned = append(owned, px...)
+		}
+
+		if exp := 4; len(owned) != exp {
+			t.Errorf("expected owned partitions: %d, got: %d", exp, len(owned))
+		}
+
+		MustClose(t, b)
 	})
 }
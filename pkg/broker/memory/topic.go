@@ -0,0 +1,449 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+// topic is a broker topic.
+type topic struct {
+	sync.RWMutex
+	name string
+	sink broker.Sink
+	// queues are topic partition queues.
+	// Topics which are not partitioned have a single queue.
+	queues []chan broker.Message
+	// key is the message partition key.
+	key broker.PartitionKey
+	// subs are topic subscribers in the order they subscribed.
+	subs []*Subscriber
+	// notify is closed whenever topic subscribers change.
+	notify chan struct{}
+	// next is the index of the next FanIn subscriber.
+	next int
+	// counters are topic flow-control counters.
+	counters counters
+}
+
+// envelope is a message delivered by topic to subscriber queue.
+type envelope struct {
+	msg   broker.Message
+	topic *topic
+}
+
+// counters are topic flow-control counters.
+type counters struct {
+	sync.Mutex
+	published  uint64
+	dropped    uint64
+	rejected   uint64
+	timeouts   uint64
+	latency    time.Duration
+	maxLatency time.Duration
+}
+
+// newTopic creates a new topic with the given number of partitions
+// each with a queue of the given size and returns it.
+func newTopic(name string, sink broker.Sink, size, partitions int, key broker.PartitionKey) *topic {
+	if partitions < 1 {
+		partitions = 1
+	}
+
+	if key == nil {
+		key = broker.DefaultPartitionKey
+	}
+
+	queues := make([]chan broker.Message, partitions)
+	for i := range queues {
+		queues[i] = make(chan broker.Message, size)
+	}
+
+	return &topic{
+		name:   name,
+		sink:   sink,
+		queues: queues,
+		key:    key,
+		subs:   make([]*Subscriber, 0),
+		notify: make(chan struct{}),
+	}
+}
+
+// partitioned returns true if topic is partitioned.
+func (t *topic) partitioned() bool {
+	return len(t.queues) > 1
+}
+
+// queue returns the queue of msg partition.
+func (t *topic) queue(msg broker.Message) chan broker.Message {
+	return t.queues[broker.Partition(t.key(msg), len(t.queues))]
+}
+
+// depth returns the number of messages in topic queues.
+func (t *topic) depth() int {
+	n := 0
+	for _, q := range t.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// owner returns the index of the subscriber which owns partition p
+// of a topic with n subscribers.
+func owner(p, n int) int {
+	return p % n
+}
+
+// partitions returns partitions owned by the subscriber with the given id.
+// FanOut topic subscribers receive messages from all partitions.
+func (t *topic) partitions(id string) []int {
+	subs, _ := t.subscribers()
+
+	idx := -1
+	for i, s := range subs {
+		if s.id == id {
+			idx = i
+			break
+		}
+	}
+
+	if idx < 0 {
+		return nil
+	}
+
+	var px []int
+	for p := range t.queues {
+		if t.sink == broker.FanOut || owner(p, len(subs)) == idx {
+			px = append(px, p)
+		}
+	}
+
+	return px
+}
+
+// subscribers returns topic subscribers and a channel
+// which is closed when the subscribers change.
+func (t *topic) subscribers() ([]*Subscriber, <-chan struct{}) {
+	t.RLock()
+	defer t.RUnlock()
+
+	subs := make([]*Subscriber, len(t.subs))
+	copy(subs, t.subs)
+
+	return subs, t.notify
+}
+
+// changed notifies dispatcher about subscriber changes.
+// NOTE: this must be called with the topic lock held.
+func (t *topic) changed() {
+	close(t.notify)
+	t.notify = make(chan struct{})
+}
+
+// addSub adds s to topic subscribers.
+func (t *topic) addSub(s *Subscriber) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.subs = append(t.subs, s)
+	t.changed()
+}
+
+// removeSub removes subscriber with the given id from topic
+// and returns it. It returns nil if no such subscriber exists.
+func (t *topic) removeSub(id string) *Subscriber {
+	t.Lock()
+	defer t.Unlock()
+
+	for i, s := range t.subs {
+		if s.id == id {
+			t.subs = append(t.subs[:i], t.subs[i+1:]...)
+			t.changed()
+			return s
+		}
+	}
+
+	return nil
+}
+
+// publish queues msg following overflow policy p.
+// Block policy waits for room in the queue until timeout fires.
+// It returns broker.ErrNotConnected if the broker exits while waiting.
+func (t *topic) publish(ctx context.Context, msg broker.Message, p broker.Overflow, timeout <-chan time.Time, exit <-chan struct{}) error {
+	start := time.Now()
+	q := t.queue(msg)
+
+	if p == broker.Block {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exit:
+			return broker.ErrNotConnected
+		case <-timeout:
+			t.counters.Lock()
+			t.counters.timeouts++
+			t.counters.Unlock()
+			return broker.ErrTimeout
+		case q <- msg:
+			t.published(time.Since(start))
+			return nil
+		}
+	}
+
+	for {
+		select {
+		case q <- msg:
+			t.published(time.Since(start))
+			return nil
+		default:
+		}
+
+		switch p {
+		case broker.Reject:
+			t.counters.Lock()
+			t.counters.rejected++
+			t.counters.Unlock()
+			return broker.ErrQueueFull
+		case broker.DropOldest:
+			select {
+			case <-q:
+				t.counters.Lock()
+				t.counters.dropped++
+				t.counters.Unlock()
+				continue
+			default:
+				// NOTE: there is nothing to drop in an unbuffered queue
+			}
+		}
+
+		t.counters.Lock()
+		t.counters.dropped++
+		t.counters.Unlock()
+
+		return nil
+	}
+}
+
+// published records message published after waiting for d.
+func (t *topic) published(d time.Duration) {
+	t.counters.Lock()
+	defer t.counters.Unlock()
+
+	t.counters.published++
+	t.counters.latency += d
+	if d > t.counters.maxLatency {
+		t.counters.maxLatency = d
+	}
+}
+
+// stats returns topic statistics.
+func (t *topic) stats() broker.TopicStats {
+	subs, _ := t.subscribers()
+
+	t.counters.Lock()
+	defer t.counters.Unlock()
+
+	ts := broker.TopicStats{
+		Depth:         t.depth(),
+		Cap:           cap(t.queues[0]) * len(t.queues),
+		Partitions:    len(t.queues),
+		Published:     t.counters.published,
+		Dropped:       t.counters.dropped,
+		Rejected:      t.counters.rejected,
+		Timeouts:      t.counters.timeouts,
+		MaxPubLatency: t.counters.maxLatency,
+		Subscribers:   make(map[string]broker.SubscriberStats, len(subs)),
+	}
+
+	if t.counters.published > 0 {
+		ts.PubLatency = t.counters.latency / time.Duration(t.counters.published)
+	}
+
+	for _, s := range subs {
+		ts.Subscribers[s.id] = s.stats()
+	}
+
+	return ts
+}
+
+// dispatch delivers messages from the queue of partition p to topic subscribers.
+// Messages stay in the queue until there is at least one subscriber.
+// Messages delivered to subscriber which has unsubscribed in the meantime
+// are reclaimed by reclaim. It returns false if the broker exited before
+// the message taken off the queue was delivered.
+func (t *topic) dispatch(p int, exit <-chan struct{}, reclaim func(*Subscriber)) bool {
+	for {
+		subs, notify := t.subscribers()
+		if len(subs) == 0 {
+			select {
+			case <-exit:
+				return true
+			case <-notify:
+				continue
+			}
+		}
+
+		var msg broker.Message
+		select {
+		case <-exit:
+			return true
+		case <-notify:
+			continue
+		case msg = <-t.queues[p]:
+		}
+
+		if !t.deliver(msg, p, exit, reclaim) {
+			return false
+		}
+	}
+}
+
+// drained returns true if all messages queued by topic have been received
+// and acknowledged by its subscribers or if the topic has no subscribers.
+func (t *topic) drained() bool {
+	subs, _ := t.subscribers()
+	if len(subs) == 0 {
+		return true
+	}
+
+	if t.depth() > 0 {
+		return false
+	}
+
+	for _, s := range subs {
+		if !s.drained() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deliver delivers msg from partition p to topic subscribers following
+// the topic sink. Messages from FanIn topic partitions are delivered to
+// the subscriber which owns the partition. If FanIn subscriber unsubscribed
+// while msg was being delivered to it, its queue is reclaimed by reclaim.
+// It returns false if the broker exited before msg was delivered.
+func (t *topic) deliver(msg broker.Message, p int, exit <-chan struct{}, reclaim func(*Subscriber)) bool {
+	for {
+		subs, notify := t.subscribers()
+		if len(subs) == 0 {
+			select {
+			case <-exit:
+				return false
+			case <-notify:
+				continue
+			}
+		}
+
+		env := envelope{msg: msg, topic: t}
+
+		if t.sink == broker.FanOut {
+			return fanOut(env, subs, exit)
+		}
+
+		var (
+			s     *Subscriber
+			retry bool
+		)
+
+		if t.partitioned() {
+			s, retry = own(env, subs[owner(p, len(subs))], notify, exit)
+		} else {
+			s, retry = t.fanIn(env, subs, notify, exit)
+		}
+
+		if retry {
+			continue
+		}
+
+		// NOTE: s might have unsubscribed after its queue had been
+		// requeued, so anything delivered to it since must be reclaimed
+		if s != nil && s.unsubscribed() {
+			reclaim(s)
+		}
+
+		return s != nil
+	}
+}
+
+// fanOut delivers env to all subs.
+func fanOut(env envelope, subs []*Subscriber, exit <-chan struct{}) bool {
+	for _, s := range subs {
+		select {
+		case <-exit:
+			return false
+		case <-s.exit:
+		case s.queue <- env:
+		}
+	}
+	return true
+}
+
+// own delivers env to subscriber s which owns the message partition
+// and returns s. If s is not ready to accept env own blocks until it is
+// or until the topic subscribers change, in which case it asks to retry.
+func own(env envelope, s *Subscriber, notify, exit <-chan struct{}) (*Subscriber, bool) {
+	select {
+	case <-exit:
+		return nil, false
+	case <-notify:
+		return nil, true
+	case <-s.exit:
+		// NOTE: s has unsubscribed but hasn't been removed from topic yet
+		select {
+		case <-exit:
+			return nil, false
+		case <-notify:
+			return nil, true
+		}
+	case s.queue <- env:
+		return s, false
+	}
+}
+
+// fanIn delivers env to exactly one of subs and returns it.
+// Subscribers are picked in round robin order; if none of them
+// is ready to accept env fanIn blocks until either one of them is
+// or until the topic subscribers change, in which case it asks to retry.
+func (t *topic) fanIn(env envelope, subs []*Subscriber, notify, exit <-chan struct{}) (*Subscriber, bool) {
+	n := len(subs)
+	for i := 0; i < n; i++ {
+		s := subs[(t.next+i)%n]
+		if s.unsubscribed() {
+			continue
+		}
+		select {
+		case s.queue <- env:
+			t.next = (t.next + i + 1) % n
+			return s, false
+		default:
+		}
+	}
+
+	cases := make([]reflect.SelectCase, 0, n+2)
+	cases = append(cases,
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(exit)},
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(notify)},
+	)
+	for _, s := range subs {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectSend,
+			Chan: reflect.ValueOf(s.queue),
+			Send: reflect.ValueOf(env),
+		})
+	}
+
+	switch chosen, _, _ := reflect.Select(cases); chosen {
+	case 0:
+		return nil, false
+	case 1:
+		return nil, true
+	default:
+		t.next = (chosen - 2 + 1) % n
+		return subs[chosen-2], false
+	}
+}
@@ -0,0 +1,73 @@
+package nats
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+
+	gonats "github.com/nats-io/nats.go"
+)
+
+const (
+	// UIDHeader is NATS message header which carries message UID.
+	UIDHeader = "Netscrape-Uid"
+	// TypeHeader is NATS message header which carries message type.
+	TypeHeader = "Netscrape-Type"
+	// AttrsHeader is NATS message header which carries JSON encoded message attributes.
+	AttrsHeader = "Netscrape-Attrs"
+)
+
+// encode encodes msg into NATS message published on the given subject.
+func encode(subject string, msg broker.Message) (*gonats.Msg, error) {
+	m := gonats.NewMsg(subject)
+	m.Data = msg.Data
+	m.Header.Set(UIDHeader, msg.UID)
+	m.Header.Set(TypeHeader, strconv.Itoa(int(msg.Type)))
+
+	if len(msg.Attrs) > 0 {
+		attrs, err := json.Marshal(msg.Attrs)
+		if err != nil {
+			return nil, err
+		}
+		m.Header.Set(AttrsHeader, string(attrs))
+	}
+
+	return m, nil
+}
+
+// decode decodes NATS message m into broker message.
+// Messages published by other NATS clients are decoded
+// as Unknown type and are assigned a new UID.
+func decode(m *gonats.Msg) (broker.Message, error) {
+	msg := broker.Message{
+		UID:  memuid.New().String(),
+		Type: broker.Unknown,
+		Data: m.Data,
+	}
+
+	if m.Header == nil {
+		return msg, nil
+	}
+
+	if uid := m.Header.Get(UIDHeader); uid != "" {
+		msg.UID = uid
+	}
+
+	if typ := m.Header.Get(TypeHeader); typ != "" {
+		t, err := strconv.Atoi(typ)
+		if err != nil {
+			return broker.Message{}, err
+		}
+		msg.Type = broker.Type(t)
+	}
+
+	if attrs := m.Header.Get(AttrsHeader); attrs != "" {
+		if err := json.Unmarshal([]byte(attrs), &msg.Attrs); err != nil {
+			return broker.Message{}, err
+		}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,49 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+
+	gonats "github.com/nats-io/nats.go"
+)
+
+func TestDecode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, typ := range []broker.Type{broker.Entity, broker.Link, broker.Unknown, broker.Event} {
+			m, err := encode("foo", broker.Message{UID: "fooID", Type: typ})
+			if err != nil {
+				t.Fatalf("failed encoding message: %v", err)
+			}
+
+			msg, err := decode(m)
+			if err != nil {
+				t.Fatalf("failed decoding message: %v", err)
+			}
+
+			if msg.Type != typ {
+				t.Errorf("expected type: %s, got: %s", typ, msg.Type)
+			}
+		}
+	})
+
+	t.Run("StoredUnknown", func(t *testing.T) {
+		// NOTE: Unknown type published by older releases
+		m := gonats.NewMsg("foo")
+		m.Header.Set(UIDHeader, "fooID")
+		m.Header.Set(TypeHeader, "4")
+
+		msg, err := decode(m)
+		if err != nil {
+			t.Fatalf("failed decoding message: %v", err)
+		}
+
+		if msg.Type != broker.Unknown {
+			t.Errorf("expected type: %s, got: %s", broker.Unknown, msg.Type)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+
+	gonats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultSize is the default subscriber queue capacity.
+	DefaultSize = 100
+	// DefaultTimeout is default timeout for both publish and subscribe ops.
+	DefaultTimeout = 5 * time.Second
+	// DefaultAckTimeout is default timeout for manual message acks.
+	DefaultAckTimeout = 30 * time.Second
+	// DefaultMaxAttempts is default max number of delivery attempts.
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is default base redelivery backoff.
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultGroup is the queue group of FanIn subscribers with no group.
+	DefaultGroup = "default"
+)
+
+// NATS is a broker which exchanges messages via NATS server.
+// Broker topics map to NATS subjects and FanIn subscribers join NATS
+// queue groups. Message UID, Type and Attrs are carried in NATS headers.
+// NOTE: NATS delivers messages between processes at most once:
+// acks and redelivery apply to messages which reached the subscriber.
+type NATS struct {
+	sync.RWMutex
+	url        string
+	size       int
+	sink       broker.Sink
+	pubTimeout time.Duration
+	conn       *gonats.Conn
+	exit       chan struct{}
+}
+
+// New creates a new NATS broker which connects to NATS server at url and returns it.
+func New(url string, opts ...broker.Option) (*NATS, error) {
+	bopts := broker.Options{}
+	for _, apply := range opts {
+		apply(&bopts)
+	}
+
+	size := bopts.Cap
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	pubTimeout := bopts.PubTimeout
+	if pubTimeout == 0 {
+		pubTimeout = DefaultTimeout
+	}
+
+	return &NATS{
+		url:        url,
+		size:       size,
+		sink:       bopts.Sink,
+		pubTimeout: pubTimeout,
+	}, nil
+}
+
+// Open connects to NATS server.
+func (n *NATS) Open(ctx context.Context, opts ...broker.Option) error {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.conn != nil {
+		return nil
+	}
+
+	conn, err := gonats.Connect(n.url, gonats.Name("netscrape"))
+	if err != nil {
+		return err
+	}
+
+	n.conn = conn
+	n.exit = make(chan struct{})
+
+	return nil
+}
+
+// connection returns NATS connection.
+func (n *NATS) connection() (*gonats.Conn, error) {
+	n.RLock()
+	defer n.RUnlock()
+
+	if n.conn == nil {
+		return nil, broker.ErrNotConnected
+	}
+
+	return n.conn, nil
+}
+
+// Pub publishes msg on the given topic.
+// Messages published without UID are assigned a new one.
+func (n *NATS) Pub(ctx context.Context, topic string, msg broker.Message, opts ...broker.Option) error {
+	err := n.BulkPub(ctx, topic, []broker.Message{msg}, opts...)
+
+	var bulkErr *broker.BulkPubError
+	if errors.As(err, &bulkErr) {
+		return bulkErr.Err
+	}
+
+	return err
+}
+
+// BulkPub publishes messages in mx on the given topic.
+// Messages are buffered by NATS client and flushed to server in one go;
+// if the flush does not complete within publish timeout none of the messages
+// are considered published and *broker.BulkPubError is returned.
+// If a message can't be published, the messages buffered before it are flushed
+// and *broker.BulkPubError reports them as published if the flush succeeds.
+func (n *NATS) BulkPub(ctx context.Context, topic string, mx []broker.Message, opts ...broker.Option) error {
+	conn, err := n.connection()
+	if err != nil {
+		return err
+	}
+
+	if err := broker.ValidTopic(topic); err != nil {
+		return err
+	}
+
+	popts := broker.Options{}
+	for _, apply := range opts {
+		apply(&popts)
+	}
+
+	pubTimeout := popts.PubTimeout
+	if pubTimeout == 0 {
+		pubTimeout = n.pubTimeout
+	}
+
+	for i, msg := range mx {
+		if msg.UID == "" {
+			msg.UID = memuid.New().String()
+		}
+
+		m, err := encode(topic, msg)
+		if err == nil {
+			err = conn.PublishMsg(m)
+		}
+
+		if err != nil {
+			if ferr := flush(ctx, conn, pubTimeout); ferr != nil {
+				return &broker.BulkPubError{Published: 0, Err: ferr}
+			}
+			return &broker.BulkPubError{Published: i, Err: err}
+		}
+	}
+
+	if err := flush(ctx, conn, pubTimeout); err != nil {
+		return &broker.BulkPubError{Published: 0, Err: err}
+	}
+
+	return nil
+}
+
+// flush flushes messages buffered by conn to server within timeout.
+func flush(ctx context.Context, conn *gonats.Conn, timeout time.Duration) error {
+	fctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := conn.FlushWithContext(fctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return broker.ErrTimeout
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Sub subscribes to the given topic.
+// Topic can be a pattern: broker wildcard tokens match NATS wildcards.
+// FanIn subscribers join NATS queue group given by Group option, or
+// DefaultGroup if none is given, so every message is delivered to
+// one group member only. FanOut subscribers receive all messages
+// unless they join a queue group via Group option.
+func (n *NATS) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
+	conn, err := n.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	sopts := broker.Options{
+		Sink: n.sink,
+	}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	if err := broker.ValidPattern(topic); err != nil {
+		return nil, err
+	}
+
+	if sopts.AckTimeout == 0 {
+		sopts.AckTimeout = DefaultAckTimeout
+	}
+
+	if sopts.MaxAttempts == 0 {
+		sopts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if sopts.Backoff == nil {
+		sopts.Backoff = broker.ExponentialBackoff(DefaultBackoff, DefaultTimeout)
+	}
+
+	group := sopts.Group
+	if group == "" && sopts.Sink == broker.FanIn {
+		group = DefaultGroup
+	}
+
+	msgs := make(chan *gonats.Msg, n.size)
+
+	var sub *gonats.Subscription
+	if group != "" {
+		sub, err = conn.ChanQueueSubscribe(topic, group, msgs)
+	} else {
+		sub, err = conn.ChanSubscribe(topic, msgs)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	n.RLock()
+	defer n.RUnlock()
+
+	return &Subscriber{
+		id:       memuid.New().String(),
+		topic:    topic,
+		active:   true,
+		opts:     sopts,
+		sub:      sub,
+		msgs:     msgs,
+		queue:    make(chan broker.Message, n.size),
+		inflight: make(map[string]*delivery),
+		broker:   n,
+		done:     n.exit,
+		exit:     make(chan struct{}),
+	}, nil
+}
+
+// Close closes the connection to NATS server.
+// Messages buffered by NATS client are flushed to server before
+// the connection is closed; the flush is bounded by ctx deadline
+// or by the broker publish timeout if ctx has no deadline.
+func (n *NATS) Close(ctx context.Context) error {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.conn == nil {
+		return nil
+	}
+
+	timeout := n.pubTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	err := flush(ctx, n.conn, timeout)
+
+	close(n.exit)
+	n.conn.Close()
+	n.conn = nil
+
+	return err
+}
@@ -0,0 +1,198 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func MustServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   server.RANDOM_PORT,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatalf("failed creating NATS server: %v", err)
+	}
+
+	go s.Start()
+
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready for connections")
+	}
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+func MustBroker(t *testing.T, opts ...broker.Option) *NATS {
+	b, err := New(MustServer(t).ClientURL(), opts...)
+	if err != nil {
+		t.Fatalf("failed creating broker: %v", err)
+	}
+
+	return b
+}
+
+func TestOpen(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("DoubleOpen", func(t *testing.T) {
+		b := MustBroker(t)
+
+		for i := 0; i < 2; i++ {
+			if err := b.Open(context.Background()); err != nil {
+				t.Fatalf("failed to open broker session: %v", err)
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := b.Close(context.Background()); err != nil {
+				t.Fatalf("failed to close broker session: %v", err)
+			}
+		}
+	})
+
+	t.Run("NoServer", func(t *testing.T) {
+		b, err := New("nats://127.0.0.1:1")
+		if err != nil {
+			t.Fatalf("failed creating broker: %v", err)
+		}
+
+		if err := b.Open(context.Background()); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestPub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+	msg := broker.Message{
+		UID:  "fooID",
+		Data: []byte(`foo data`),
+	}
+
+	t.Run("Publish", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := b.BulkPub(context.Background(), topic, []broker.Message{msg, msg}); err != nil {
+			t.Fatalf("failed to publish messages: %v", err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("BulkPublishError", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		sub := MustSub(t, b, topic)
+
+		// NOTE: the second message exceeds the default server max payload
+		big := broker.Message{UID: "bigID", Data: make([]byte, 2<<20)}
+
+		var bulkErr *broker.BulkPubError
+		if err := b.BulkPub(context.Background(), topic, []broker.Message{msg, big, msg}); !errors.As(err, &bulkErr) {
+			t.Fatalf("expected bulk publish error, got: %v", err)
+		}
+
+		if bulkErr.Published != 1 {
+			t.Errorf("expected published: %d, got: %d", 1, bulkErr.Published)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			if m.UID != msg.UID {
+				t.Errorf("expected msg ID: %s, got: %s", msg.UID, m.UID)
+			}
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Errorf("failed receiving message: %v", err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("InvalidTopic", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), "foo.>", msg); !errors.Is(err, broker.ErrInvalidTopic) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrInvalidTopic, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("PublishNotConnected", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Pub(context.Background(), topic, msg); !errors.Is(err, broker.ErrNotConnected) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+}
+
+func TestSub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("SubscribeNotConnected", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if _, err := b.Sub(context.Background(), "foo"); !errors.Is(err, broker.ErrNotConnected) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+
+	t.Run("InvalidTopic", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if _, err := b.Sub(context.Background(), "foo.>.bar"); !errors.Is(err, broker.ErrInvalidTopic) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrInvalidTopic, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+}
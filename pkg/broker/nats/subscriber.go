@@ -0,0 +1,218 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+
+	gonats "github.com/nats-io/nats.go"
+)
+
+// delivery is a message awaiting acknowledgement.
+type delivery struct {
+	msg   broker.Message
+	timer *time.Timer
+}
+
+// Subscriber is NATS broker subscriber.
+type Subscriber struct {
+	sync.RWMutex
+	id     string
+	topic  string
+	active bool
+	opts   broker.Options
+	sub    *gonats.Subscription
+	msgs   chan *gonats.Msg
+	// queue holds messages awaiting redelivery.
+	queue    chan broker.Message
+	inflight map[string]*delivery
+	broker   *NATS
+	done     <-chan struct{}
+	exit     chan struct{}
+}
+
+// ID returns subscriber ID
+func (s *Subscriber) ID(ctx context.Context) (string, error) {
+	return s.id, nil
+}
+
+// Topic returns subscription topic.
+func (s *Subscriber) Topic(ctx context.Context, opts ...broker.Option) (string, error) {
+	return s.topic, nil
+}
+
+// Unsubscribe unsubscribes from the topic.
+// Messages awaiting redelivery are dropped.
+func (s *Subscriber) Unsubscribe(ctx context.Context, opts ...broker.Option) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	close(s.exit)
+	s.active = false
+
+	for uid, d := range s.inflight {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		delete(s.inflight, uid)
+	}
+
+	if err := s.sub.Unsubscribe(); err != nil && !errors.Is(err, gonats.ErrConnectionClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// track starts tracking delivery of msg until it's acked or nacked.
+// If manual ack is enabled, msg is nacked unless it's acked within ack timeout.
+func (s *Subscriber) track(msg broker.Message) {
+	s.Lock()
+	defer s.Unlock()
+
+	d := &delivery{msg: msg}
+	if s.opts.ManualAck {
+		d.timer = time.AfterFunc(s.opts.AckTimeout, func() {
+			// NOTE: the message might have been acked already
+			_ = s.Nack(context.Background(), msg)
+		})
+	}
+
+	s.inflight[msg.UID] = d
+}
+
+// untrack stops tracking delivery of msg and returns it.
+func (s *Subscriber) untrack(msg broker.Message) (*delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d, ok := s.inflight[msg.UID]
+	if !ok || d.msg.Attempt != msg.Attempt {
+		return nil, broker.ErrNotInFlight
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	delete(s.inflight, msg.UID)
+
+	return d, nil
+}
+
+// Ack acknowledges the message has been processed.
+func (s *Subscriber) Ack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	_, err := s.untrack(msg)
+	return err
+}
+
+// Nack rejects the message so it is redelivered to the subscriber after backoff.
+// Once the message has been delivered max attempts times it is published
+// on the dead-letter topic, or dropped if no dead-letter topic is configured.
+func (s *Subscriber) Nack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	d, err := s.untrack(msg)
+	if err != nil {
+		return err
+	}
+
+	if s.opts.MaxAttempts > 0 && d.msg.Attempt >= s.opts.MaxAttempts {
+		if s.opts.DeadLetter == "" {
+			return nil
+		}
+		msg := d.msg
+		msg.Attempt = 0
+		return s.broker.Pub(ctx, s.opts.DeadLetter, msg)
+	}
+
+	go s.redeliver(d.msg, s.opts.Backoff(d.msg.Attempt))
+
+	return nil
+}
+
+// redeliver queues msg for redelivery after delay.
+func (s *Subscriber) redeliver(msg broker.Message, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-s.done:
+		return
+	case <-s.exit:
+		return
+	case <-timer.C:
+	}
+
+	select {
+	case <-s.done:
+	case <-s.exit:
+	case s.queue <- msg:
+	}
+}
+
+// Receive processes received messages with handler.
+// Messages are acked when h succeeds and nacked when it fails,
+// unless manual ack is enabled, in which case h is responsible
+// for acking the message before ack timeout expires.
+// NOTE: Receive is a blocking call!
+func (s *Subscriber) Receive(ctx context.Context, h broker.Handler, opts ...broker.Option) error {
+	ropts := broker.Options{}
+	for _, apply := range opts {
+		apply(&ropts)
+	}
+
+	recvTimeout := ropts.RecvTimeout
+	if recvTimeout == 0 {
+		recvTimeout = DefaultTimeout
+	}
+
+	s.RLock()
+	if !s.active {
+		s.RUnlock()
+		return broker.ErrSubscriptionInactive
+	}
+	s.RUnlock()
+
+	var msg broker.Message
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-time.After(recvTimeout):
+		return broker.ErrTimeout
+	case <-s.done:
+		return nil
+	case <-s.exit:
+		return nil
+	case msg = <-s.queue:
+	case m := <-s.msgs:
+		var err error
+		msg, err = decode(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	msg.Attempt++
+	s.track(msg)
+
+	if err := h(ctx, msg); err != nil {
+		if nerr := s.Nack(ctx, msg); nerr != nil && !errors.Is(nerr, broker.ErrNotInFlight) {
+			return nerr
+		}
+		return err
+	}
+
+	if !s.opts.ManualAck {
+		if err := s.Ack(ctx, msg); err != nil && !errors.Is(err, broker.ErrNotInFlight) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -22,6 +22,24 @@ type Options struct {
 	PubTimeout time.Duration
 	// RecvTimeout configures receive timeout.
 	RecvTimeout time.Duration
+	// ManualAck disables acking messages when handler succeeds.
+	ManualAck bool
+	// AckTimeout configures how long to wait for manual ack.
+	AckTimeout time.Duration
+	// MaxAttempts configures max number of delivery attempts.
+	MaxAttempts int
+	// Backoff configures redelivery backoff.
+	Backoff Backoff
+	// DeadLetter configures dead-letter topic.
+	DeadLetter string
+	// Group configures consumer group.
+	Group string
+	// Overflow configures full queue policy.
+	Overflow Overflow
+	// Partitions configures number of topic partitions.
+	Partitions int
+	// PartitionKey configures message partition key.
+	PartitionKey PartitionKey
 }
 
 // Option is functional broker option.
@@ -54,3 +72,66 @@ func WithSubTimeout(s time.Duration) Option {
 		o.RecvTimeout = s
 	}
 }
+
+// WithManualAck sets ManualAck option
+func WithManualAck() Option {
+	return func(o *Options) {
+		o.ManualAck = true
+	}
+}
+
+// WithAckTimeout sets AckTimeout option
+func WithAckTimeout(a time.Duration) Option {
+	return func(o *Options) {
+		o.AckTimeout = a
+	}
+}
+
+// WithMaxAttempts sets MaxAttempts option
+func WithMaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = n
+	}
+}
+
+// WithBackoff sets Backoff option
+func WithBackoff(b Backoff) Option {
+	return func(o *Options) {
+		o.Backoff = b
+	}
+}
+
+// WithDeadLetter sets DeadLetter option
+func WithDeadLetter(topic string) Option {
+	return func(o *Options) {
+		o.DeadLetter = topic
+	}
+}
+
+// WithGroup sets Group option
+func WithGroup(g string) Option {
+	return func(o *Options) {
+		o.Group = g
+	}
+}
+
+// WithOverflow sets Overflow option
+func WithOverflow(p Overflow) Option {
+	return func(o *Options) {
+		o.Overflow = p
+	}
+}
+
+// WithPartitions sets Partitions option
+func WithPartitions(n int) Option {
+	return func(o *Options) {
+		o.Partitions = n
+	}
+}
+
+// WithPartitionKey sets PartitionKey option
+func WithPartitionKey(k PartitionKey) Option {
+	return func(o *Options) {
+		o.PartitionKey = k
+	}
+}
@@ -0,0 +1,32 @@
+package broker
+
+// Overflow is the policy applied when publishing to a full topic queue.
+type Overflow int
+
+const (
+	// Block blocks the publisher until there is room in the queue
+	// or until the publish timeout expires.
+	Block Overflow = iota
+	// DropOldest drops the oldest queued message to make room.
+	DropOldest
+	// DropNewest drops the published message.
+	DropNewest
+	// Reject fails the publish with ErrQueueFull immediately.
+	Reject
+)
+
+// String implements fmt.Stringer.
+func (o Overflow) String() string {
+	switch o {
+	case Block:
+		return "Block"
+	case DropOldest:
+		return "DropOldest"
+	case DropNewest:
+		return "DropNewest"
+	case Reject:
+		return "Reject"
+	default:
+		return "Unknown"
+	}
+}
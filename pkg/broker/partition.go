@@ -0,0 +1,33 @@
+package broker
+
+import "hash/fnv"
+
+const (
+	// PartitionKeyAttr is message attribute which stores message partition key.
+	PartitionKeyAttr = "partition-key"
+)
+
+// PartitionKey returns message partition key.
+type PartitionKey func(Message) string
+
+// DefaultPartitionKey returns the value of PartitionKeyAttr
+// message attribute if it's set or message UID otherwise.
+func DefaultPartitionKey(m Message) string {
+	if key, ok := m.Attrs[PartitionKeyAttr]; ok && key != "" {
+		return key
+	}
+	return m.UID
+}
+
+// Partition returns the partition of key in a topic with n partitions.
+// Messages with the same key are always assigned the same partition.
+func Partition(key string, n int) int {
+	if n <= 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(n))
+}
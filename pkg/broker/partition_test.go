@@ -0,0 +1,42 @@
+package broker
+
+import "testing"
+
+func TestPartition(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	keys := []string{"foo", "bar", "baz", "k8s/pods/default/foo"}
+
+	for _, n := range []int{0, 1, 3, 16} {
+		for _, key := range keys {
+			p := Partition(key, n)
+			if n <= 1 && p != 0 {
+				t.Errorf("key %q: expected partition 0 of %d, got: %d", key, n, p)
+			}
+			if n > 1 && (p < 0 || p >= n) {
+				t.Errorf("key %q: partition %d out of range [0, %d)", key, p, n)
+			}
+			if p2 := Partition(key, n); p2 != p {
+				t.Errorf("key %q: expected stable partition %d, got: %d", key, p, p2)
+			}
+		}
+	}
+}
+
+func TestDefaultPartitionKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	m := Message{UID: "fooID"}
+	if key := DefaultPartitionKey(m); key != m.UID {
+		t.Errorf("expected key: %s, got: %s", m.UID, key)
+	}
+
+	m.Attrs = map[string]string{PartitionKeyAttr: "barID"}
+	if key := DefaultPartitionKey(m); key != "barID" {
+		t.Errorf("expected key: %s, got: %s", "barID", key)
+	}
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const (
+	// UIDField is stream entry field which stores message UID.
+	UIDField = "uid"
+	// TypeField is stream entry field which stores message type.
+	TypeField = "type"
+	// DataField is stream entry field which stores message data.
+	DataField = "data"
+	// AttrPrefix prefixes stream entry fields which store message attributes.
+	AttrPrefix = "attr:"
+)
+
+// encode encodes msg into stream entry fields.
+func encode(msg broker.Message) map[string]interface{} {
+	fields := map[string]interface{}{
+		UIDField:  msg.UID,
+		TypeField: strconv.Itoa(int(msg.Type)),
+		DataField: msg.Data,
+	}
+
+	for k, v := range msg.Attrs {
+		fields[AttrPrefix+k] = v
+	}
+
+	return fields
+}
+
+// decode decodes stream entry into broker message.
+// Entries added by other clients are decoded as Unknown type
+// and those without UID field are assigned a new UID.
+func decode(entry goredis.XMessage) (broker.Message, error) {
+	msg := broker.Message{
+		UID:  memuid.New().String(),
+		Type: broker.Unknown,
+	}
+
+	for k, v := range entry.Values {
+		val, _ := v.(string)
+
+		switch {
+		case k == UIDField:
+			if val != "" {
+				msg.UID = val
+			}
+		case k == TypeField:
+			t, err := strconv.Atoi(val)
+			if err != nil {
+				return broker.Message{}, err
+			}
+			msg.Type = broker.Type(t)
+		case k == DataField:
+			msg.Data = []byte(val)
+		case strings.HasPrefix(k, AttrPrefix):
+			if msg.Attrs == nil {
+				msg.Attrs = make(map[string]string)
+			}
+			msg.Attrs[strings.TrimPrefix(k, AttrPrefix)] = val
+		}
+	}
+
+	return msg, nil
+}
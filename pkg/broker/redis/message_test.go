@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+func TestDecode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, typ := range []broker.Type{broker.Entity, broker.Link, broker.Unknown, broker.Event} {
+			values := make(map[string]interface{})
+			for k, v := range encode(broker.Message{UID: "fooID", Type: typ}) {
+				if s, ok := v.(string); ok {
+					values[k] = s
+				}
+			}
+
+			msg, err := decode(goredis.XMessage{Values: values})
+			if err != nil {
+				t.Fatalf("failed decoding message: %v", err)
+			}
+
+			if msg.Type != typ {
+				t.Errorf("expected type: %s, got: %s", typ, msg.Type)
+			}
+		}
+	})
+
+	t.Run("StoredUnknown", func(t *testing.T) {
+		// NOTE: Unknown type stored by older releases
+		msg, err := decode(goredis.XMessage{Values: map[string]interface{}{
+			UIDField:  "fooID",
+			TypeField: "4",
+		}})
+		if err != nil {
+			t.Fatalf("failed decoding message: %v", err)
+		}
+
+		if msg.Type != broker.Unknown {
+			t.Errorf("expected type: %s, got: %s", broker.Unknown, msg.Type)
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const (
+	// DefaultSize is the default subscriber redelivery queue capacity.
+	DefaultSize = 100
+	// DefaultTimeout is default timeout for both publish and subscribe ops.
+	DefaultTimeout = 5 * time.Second
+	// DefaultAckTimeout is default timeout for manual message acks.
+	DefaultAckTimeout = 30 * time.Second
+	// DefaultMaxAttempts is default max number of delivery attempts.
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is default base redelivery backoff.
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultGroup is the consumer group of FanIn subscribers with no group.
+	DefaultGroup = "default"
+)
+
+// pollInterval is the max time subscribers block reading streams
+// before checking for messages awaiting redelivery.
+const pollInterval = 100 * time.Millisecond
+
+// Redis is a broker which exchanges messages via Redis Streams.
+// Broker topics map to stream keys and messages to stream entries.
+// FanIn subscribers read topic streams via consumer groups,
+// FanOut subscribers read them independently.
+type Redis struct {
+	sync.RWMutex
+	addr       string
+	size       int
+	sink       broker.Sink
+	pubTimeout time.Duration
+	client     *goredis.Client
+	exit       chan struct{}
+}
+
+// New creates a new Redis broker which connects to Redis server at addr and returns it.
+func New(addr string, opts ...broker.Option) (*Redis, error) {
+	bopts := broker.Options{}
+	for _, apply := range opts {
+		apply(&bopts)
+	}
+
+	size := bopts.Cap
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	pubTimeout := bopts.PubTimeout
+	if pubTimeout == 0 {
+		pubTimeout = DefaultTimeout
+	}
+
+	return &Redis{
+		addr:       addr,
+		size:       size,
+		sink:       bopts.Sink,
+		pubTimeout: pubTimeout,
+	}, nil
+}
+
+// Open connects to Redis server.
+func (r *Redis) Open(ctx context.Context, opts ...broker.Option) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.client != nil {
+		return nil
+	}
+
+	client := goredis.NewClient(&goredis.Options{Addr: r.addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return err
+	}
+
+	r.client = client
+	r.exit = make(chan struct{})
+
+	return nil
+}
+
+// redisClient returns Redis client.
+func (r *Redis) redisClient() (*goredis.Client, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if r.client == nil {
+		return nil, broker.ErrNotConnected
+	}
+
+	return r.client, nil
+}
+
+// Pub adds msg to the topic stream.
+// Messages published without UID are assigned a new one.
+func (r *Redis) Pub(ctx context.Context, topic string, msg broker.Message, opts ...broker.Option) error {
+	err := r.BulkPub(ctx, topic, []broker.Message{msg}, opts...)
+
+	var bulkErr *broker.BulkPubError
+	if errors.As(err, &bulkErr) {
+		return bulkErr.Err
+	}
+
+	return err
+}
+
+// BulkPub adds messages in mx to the topic stream in a single pipeline.
+// If not all messages could be published BulkPub returns *broker.BulkPubError
+// which reports how many messages were published before the failure.
+func (r *Redis) BulkPub(ctx context.Context, topic string, mx []broker.Message, opts ...broker.Option) error {
+	client, err := r.redisClient()
+	if err != nil {
+		return err
+	}
+
+	if err := broker.ValidTopic(topic); err != nil {
+		return err
+	}
+
+	popts := broker.Options{}
+	for _, apply := range opts {
+		apply(&popts)
+	}
+
+	pubTimeout := popts.PubTimeout
+	if pubTimeout == 0 {
+		pubTimeout = r.pubTimeout
+	}
+
+	pctx, cancel := context.WithTimeout(ctx, pubTimeout)
+	defer cancel()
+
+	pipe := client.Pipeline()
+	for _, msg := range mx {
+		if msg.UID == "" {
+			msg.UID = memuid.New().String()
+		}
+
+		pipe.XAdd(pctx, &goredis.XAddArgs{
+			Stream: topic,
+			Values: encode(msg),
+		})
+	}
+
+	cmds, err := pipe.Exec(pctx)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		err = broker.ErrTimeout
+	}
+
+	published := 0
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			break
+		}
+		published++
+	}
+
+	return &broker.BulkPubError{Published: published, Err: err}
+}
+
+// Sub subscribes to the given topic stream.
+// FanIn subscribers join the consumer group given by Group option,
+// or DefaultGroup if none is given; groups created by Sub start reading
+// at the beginning of the stream. FanOut subscribers read new entries
+// added to the stream after they subscribed, unless they join
+// a consumer group via Group option.
+// Wildcard subscriptions are not supported.
+func (r *Redis) Sub(ctx context.Context, topic string, opts ...broker.Option) (broker.Subscriber, error) {
+	client, err := r.redisClient()
+	if err != nil {
+		return nil, err
+	}
+
+	sopts := broker.Options{
+		Sink: r.sink,
+	}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	if err := broker.ValidPattern(topic); err != nil {
+		return nil, err
+	}
+
+	if broker.IsPattern(topic) {
+		return nil, broker.ErrNotImplemented
+	}
+
+	if sopts.AckTimeout == 0 {
+		sopts.AckTimeout = DefaultAckTimeout
+	}
+
+	if sopts.MaxAttempts == 0 {
+		sopts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if sopts.Backoff == nil {
+		sopts.Backoff = broker.ExponentialBackoff(DefaultBackoff, DefaultTimeout)
+	}
+
+	sub := &Subscriber{
+		id:       memuid.New().String(),
+		topic:    topic,
+		active:   true,
+		opts:     sopts,
+		client:   client,
+		queue:    make(chan entry, r.size),
+		inflight: make(map[string]*delivery),
+		broker:   r,
+		exit:     make(chan struct{}),
+	}
+
+	if sopts.Sink == broker.FanIn || sopts.Group != "" {
+		sub.group = sopts.Group
+		if sub.group == "" {
+			sub.group = DefaultGroup
+		}
+
+		err := client.XGroupCreateMkStream(ctx, topic, sub.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, err
+		}
+	} else {
+		sub.last = "0-0"
+
+		entries, err := client.XRevRangeN(ctx, topic, "+", "-", 1).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) > 0 {
+			sub.last = entries[0].ID
+		}
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	sub.done = r.exit
+
+	return sub, nil
+}
+
+// Close closes the connection to Redis server.
+// Messages are published to Redis streams synchronously so there
+// is nothing to drain and Close returns without waiting for ctx.
+func (r *Redis) Close(ctx context.Context) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.client == nil {
+		return nil
+	}
+
+	close(r.exit)
+	err := r.client.Close()
+	r.client = nil
+
+	return err
+}
@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func MustServer(t *testing.T) *miniredis.Miniredis {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed starting Redis server: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func MustBroker(t *testing.T, opts ...broker.Option) *Redis {
+	b, err := New(MustServer(t).Addr(), opts...)
+	if err != nil {
+		t.Fatalf("failed creating broker: %v", err)
+	}
+
+	return b
+}
+
+func TestOpen(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("DoubleOpen", func(t *testing.T) {
+		b := MustBroker(t)
+
+		for i := 0; i < 2; i++ {
+			if err := b.Open(context.Background()); err != nil {
+				t.Fatalf("failed to open broker session: %v", err)
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := b.Close(context.Background()); err != nil {
+				t.Fatalf("failed to close broker session: %v", err)
+			}
+		}
+	})
+
+	t.Run("NoServer", func(t *testing.T) {
+		b, err := New("127.0.0.1:1")
+		if err != nil {
+			t.Fatalf("failed creating broker: %v", err)
+		}
+
+		if err := b.Open(context.Background()); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestPub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	topic := "foo"
+	msg := broker.Message{
+		UID:   "fooID",
+		Type:  broker.Object,
+		Data:  []byte(`foo data`),
+		Attrs: map[string]string{"source": "k8s"},
+	}
+
+	t.Run("Publish", func(t *testing.T) {
+		s := MustServer(t)
+
+		b, err := New(s.Addr())
+		if err != nil {
+			t.Fatalf("failed creating broker: %v", err)
+		}
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := b.BulkPub(context.Background(), topic, []broker.Message{msg, msg}); err != nil {
+			t.Fatalf("failed to publish messages: %v", err)
+		}
+
+		entries, err := s.Stream(topic)
+		if err != nil {
+			t.Fatalf("failed reading stream %s: %v", topic, err)
+		}
+
+		if exp := 3; len(entries) != exp {
+			t.Errorf("expected stream entries: %d, got: %d", exp, len(entries))
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("InvalidTopic", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if err := b.Pub(context.Background(), "foo.>", msg); !errors.Is(err, broker.ErrInvalidTopic) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrInvalidTopic, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("PublishNotConnected", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Pub(context.Background(), topic, msg); !errors.Is(err, broker.ErrNotConnected) {
+			t.Fatalf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+}
+
+func TestSub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("SubscribeNotConnected", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if _, err := b.Sub(context.Background(), "foo"); !errors.Is(err, broker.ErrNotConnected) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrNotConnected, err)
+		}
+	})
+
+	t.Run("Pattern", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		if _, err := b.Sub(context.Background(), "foo.*"); !errors.Is(err, broker.ErrNotImplemented) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrNotImplemented, err)
+		}
+
+		if _, err := b.Sub(context.Background(), "foo.>.bar"); !errors.Is(err, broker.ErrInvalidTopic) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrInvalidTopic, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+}
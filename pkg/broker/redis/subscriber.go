@@ -0,0 +1,307 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// entry is a message read from topic stream.
+type entry struct {
+	// id is stream entry ID.
+	id  string
+	msg broker.Message
+}
+
+// delivery is a message awaiting acknowledgement.
+type delivery struct {
+	entry
+	timer *time.Timer
+}
+
+// Subscriber is Redis broker subscriber.
+type Subscriber struct {
+	sync.RWMutex
+	id     string
+	topic  string
+	active bool
+	opts   broker.Options
+	client *goredis.Client
+	// group is the consumer group of FanIn subscribers.
+	group string
+	// last is the ID of the last stream entry read by FanOut subscribers.
+	last string
+	// queue holds messages awaiting redelivery.
+	queue    chan entry
+	inflight map[string]*delivery
+	broker   *Redis
+	done     <-chan struct{}
+	exit     chan struct{}
+}
+
+// ID returns subscriber ID
+func (s *Subscriber) ID(ctx context.Context) (string, error) {
+	return s.id, nil
+}
+
+// Topic returns subscription topic.
+func (s *Subscriber) Topic(ctx context.Context, opts ...broker.Option) (string, error) {
+	return s.topic, nil
+}
+
+// Unsubscribe unsubscribes from the topic.
+// Messages awaiting redelivery are dropped; group messages which have
+// not been acked remain pending in the consumer group.
+func (s *Subscriber) Unsubscribe(ctx context.Context, opts ...broker.Option) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	close(s.exit)
+	s.active = false
+
+	for uid, d := range s.inflight {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		delete(s.inflight, uid)
+	}
+
+	return nil
+}
+
+// track starts tracking delivery of e until it's acked or nacked.
+// If manual ack is enabled, the message is nacked unless it's acked within ack timeout.
+func (s *Subscriber) track(e entry) {
+	s.Lock()
+	defer s.Unlock()
+
+	d := &delivery{entry: e}
+	if s.opts.ManualAck {
+		d.timer = time.AfterFunc(s.opts.AckTimeout, func() {
+			// NOTE: the message might have been acked already
+			_ = s.Nack(context.Background(), e.msg)
+		})
+	}
+
+	s.inflight[e.msg.UID] = d
+}
+
+// untrack stops tracking delivery of msg and returns it.
+func (s *Subscriber) untrack(msg broker.Message) (*delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d, ok := s.inflight[msg.UID]
+	if !ok || d.msg.Attempt != msg.Attempt {
+		return nil, broker.ErrNotInFlight
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	delete(s.inflight, msg.UID)
+
+	return d, nil
+}
+
+// xack acknowledges stream entry with the given id in subscriber consumer group.
+func (s *Subscriber) xack(ctx context.Context, id string) error {
+	if s.group == "" {
+		return nil
+	}
+
+	return s.client.XAck(ctx, s.topic, s.group, id).Err()
+}
+
+// Ack acknowledges the message has been processed.
+func (s *Subscriber) Ack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	d, err := s.untrack(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.xack(ctx, d.id)
+}
+
+// Nack rejects the message so it is redelivered to the subscriber after backoff.
+// Once the message has been delivered max attempts times it is published
+// on the dead-letter topic, or dropped if no dead-letter topic is configured.
+func (s *Subscriber) Nack(ctx context.Context, msg broker.Message, opts ...broker.Option) error {
+	d, err := s.untrack(msg)
+	if err != nil {
+		return err
+	}
+
+	if s.opts.MaxAttempts > 0 && d.msg.Attempt >= s.opts.MaxAttempts {
+		if s.opts.DeadLetter != "" {
+			msg := d.msg
+			msg.Attempt = 0
+			if err := s.broker.Pub(ctx, s.opts.DeadLetter, msg); err != nil {
+				return err
+			}
+		}
+		return s.xack(ctx, d.id)
+	}
+
+	go s.redeliver(d.entry, s.opts.Backoff(d.msg.Attempt))
+
+	return nil
+}
+
+// redeliver queues e for redelivery after delay.
+func (s *Subscriber) redeliver(e entry, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-s.done:
+		return
+	case <-s.exit:
+		return
+	case <-timer.C:
+	}
+
+	select {
+	case <-s.done:
+	case <-s.exit:
+	case s.queue <- e:
+	}
+}
+
+// read reads the next topic stream entry.
+// It blocks for at most pollInterval and returns nil if no entry was read.
+func (s *Subscriber) read(ctx context.Context) (*entry, error) {
+	var (
+		streams []goredis.XStream
+		err     error
+	)
+
+	if s.group != "" {
+		streams, err = s.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.id,
+			Streams:  []string{s.topic, ">"},
+			Count:    1,
+			Block:    pollInterval,
+		}).Result()
+	} else {
+		streams, err = s.client.XRead(ctx, &goredis.XReadArgs{
+			Streams: []string{s.topic, s.last},
+			Count:   1,
+			Block:   pollInterval,
+		}).Result()
+	}
+
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		for _, m := range stream.Messages {
+			msg, err := decode(m)
+			if err != nil {
+				return nil, err
+			}
+
+			if s.group == "" {
+				s.last = m.ID
+			}
+
+			return &entry{id: m.ID, msg: msg}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Receive processes received messages with handler.
+// Messages are acked when h succeeds and nacked when it fails,
+// unless manual ack is enabled, in which case h is responsible
+// for acking the message before ack timeout expires.
+// NOTE: Receive is a blocking call!
+func (s *Subscriber) Receive(ctx context.Context, h broker.Handler, opts ...broker.Option) error {
+	ropts := broker.Options{}
+	for _, apply := range opts {
+		apply(&ropts)
+	}
+
+	recvTimeout := ropts.RecvTimeout
+	if recvTimeout == 0 {
+		recvTimeout = DefaultTimeout
+	}
+
+	s.RLock()
+	if !s.active {
+		s.RUnlock()
+		return broker.ErrSubscriptionInactive
+	}
+	s.RUnlock()
+
+	deadline := time.Now().Add(recvTimeout)
+
+	var e *entry
+
+	for e == nil {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		case <-s.exit:
+			return nil
+		case r := <-s.queue:
+			e = &r
+			continue
+		default:
+		}
+
+		if !time.Now().Before(deadline) {
+			return broker.ErrTimeout
+		}
+
+		var err error
+		e, err = s.read(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-s.done:
+				return nil
+			default:
+			}
+			return err
+		}
+	}
+
+	e.msg.Attempt++
+	s.track(*e)
+
+	msg := e.msg
+
+	if err := h(ctx, msg); err != nil {
+		if nerr := s.Nack(ctx, msg); nerr != nil && !errors.Is(nerr, broker.ErrNotInFlight) {
+			return nerr
+		}
+		return err
+	}
+
+	if !s.opts.ManualAck {
+		if err := s.Ack(ctx, msg); err != nil && !errors.Is(err, broker.ErrNotInFlight) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+func MustSub(t *testing.T, b *Redis, topic string, opts ...broker.Option) broker.Subscriber {
+	sub, err := b.Sub(context.Background(), topic, opts...)
+	if err != nil {
+		t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+	}
+
+	return sub
+}
+
+func TestReceive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	msg := broker.Message{
+		UID:   "fooID",
+		Type:  broker.Object,
+		Data:  []byte(`foo data`),
+		Attrs: map[string]string{"source": "k8s"},
+	}
+
+	t.Run("FanOut", func(t *testing.T) {
+		b := MustBroker(t, broker.WithSink(broker.FanOut))
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+
+		// NOTE: FanOut subscribers only read messages published after they subscribed
+		if err := b.Pub(context.Background(), topic, broker.Message{UID: "old"}); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		subs := []broker.Subscriber{
+			MustSub(t, b, topic),
+			MustSub(t, b, topic),
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			m.Attempt = 0
+			if !reflect.DeepEqual(m, msg) {
+				return fmt.Errorf("expected msg: %#v, got: %#v", msg, m)
+			}
+			return nil
+		}
+
+		for _, sub := range subs {
+			if err := sub.Receive(context.Background(), h); err != nil {
+				t.Errorf("failed receiving message: %v", err)
+			}
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("FanIn", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+
+		subs := []broker.Subscriber{
+			MustSub(t, b, topic),
+			MustSub(t, b, topic),
+		}
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		count := 0
+		h := func(ctx context.Context, m broker.Message) error {
+			count++
+			return nil
+		}
+
+		rt := 200 * time.Millisecond
+
+		for _, sub := range subs {
+			if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(rt)); err != nil && !errors.Is(err, broker.ErrTimeout) {
+				t.Errorf("failed receiving message: %v", err)
+			}
+		}
+
+		if exp := 1; count != exp {
+			t.Errorf("expected messages: %d, got: %d", exp, count)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("Inactive", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		sub := MustSub(t, b, "foo")
+
+		for i := 0; i < 2; i++ {
+			if err := sub.Unsubscribe(context.Background()); err != nil {
+				t.Errorf("failed to unsubscribe: %v", err)
+			}
+		}
+
+		if err := sub.Receive(context.Background(), nil); !errors.Is(err, broker.ErrSubscriptionInactive) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrSubscriptionInactive, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		sub := MustSub(t, b, "foo")
+
+		rt := 50 * time.Millisecond
+		if err := sub.Receive(context.Background(), nil, broker.WithSubTimeout(rt)); !errors.Is(err, broker.ErrTimeout) {
+			t.Errorf("expected error: %v, got: %v", broker.ErrTimeout, err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+}
+
+func TestAck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	msg := broker.Message{
+		UID:  "fooID",
+		Data: []byte(`foo data`),
+	}
+
+	errHandler := errors.New("handler error")
+
+	failing := func(ctx context.Context, m broker.Message) error {
+		return errHandler
+	}
+
+	t.Run("Acked", func(t *testing.T) {
+		s := MustServer(t)
+
+		b, err := New(s.Addr())
+		if err != nil {
+			t.Fatalf("failed creating broker: %v", err)
+		}
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		sub := MustSub(t, b, topic)
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error { return nil }
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiving message: %v", err)
+		}
+
+		pending, err := b.client.XPending(context.Background(), topic, DefaultGroup).Result()
+		if err != nil {
+			t.Fatalf("failed reading pending messages: %v", err)
+		}
+
+		if pending.Count != 0 {
+			t.Errorf("expected no pending messages, got: %d", pending.Count)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("RedeliverOnError", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic := "foo"
+		sub := MustSub(t, b, topic, broker.WithBackoff(broker.ConstantBackoff(0)))
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := sub.Receive(context.Background(), failing); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		attempt := 0
+		h := func(ctx context.Context, m broker.Message) error {
+			attempt = m.Attempt
+			return nil
+		}
+
+		if err := sub.Receive(context.Background(), h); err != nil {
+			t.Fatalf("failed receiving message: %v", err)
+		}
+
+		if exp := 2; attempt != exp {
+			t.Errorf("expected attempt: %d, got: %d", exp, attempt)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		b := MustBroker(t)
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+
+		topic, dlq := "foo", "foo.dlq"
+
+		sub := MustSub(t, b, topic,
+			broker.WithMaxAttempts(1),
+			broker.WithDeadLetter(dlq))
+		dlqSub := MustSub(t, b, dlq)
+
+		if err := b.Pub(context.Background(), topic, msg); err != nil {
+			t.Fatalf("failed to publish message: %v", err)
+		}
+
+		if err := sub.Receive(context.Background(), failing); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		h := func(ctx context.Context, m broker.Message) error {
+			if m.UID != msg.UID {
+				return fmt.Errorf("expected msg ID: %s, got: %s", msg.UID, m.UID)
+			}
+			return nil
+		}
+
+		if err := dlqSub.Receive(context.Background(), h); err != nil {
+			t.Errorf("failed receiving dead-letter message: %v", err)
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("failed to close broker session: %v", err)
+		}
+	})
+}
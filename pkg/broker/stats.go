@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"context"
+	"time"
+)
+
+// StatsBroker provides broker flow-control statistics.
+type StatsBroker interface {
+	Broker
+	// Stats returns broker statistics.
+	Stats(context.Context) (Stats, error)
+}
+
+// Stats are broker statistics.
+type Stats struct {
+	// Topics are statistics of broker topics keyed by topic name.
+	Topics map[string]TopicStats
+}
+
+// TopicStats are topic statistics.
+type TopicStats struct {
+	// Depth is the number of messages in the topic queues.
+	Depth int
+	// Cap is the topic queue capacity.
+	Cap int
+	// Partitions is the number of topic partitions.
+	Partitions int
+	// Published is the number of messages accepted by the topic.
+	Published uint64
+	// Dropped is the number of messages dropped by overflow policy.
+	Dropped uint64
+	// Rejected is the number of publishes rejected because the queue was full.
+	Rejected uint64
+	// Timeouts is the number of publishes which timed out.
+	Timeouts uint64
+	// PubLatency is the average time publishers waited for the queue.
+	PubLatency time.Duration
+	// MaxPubLatency is the longest time a publisher waited for the queue.
+	MaxPubLatency time.Duration
+	// Subscribers are statistics of topic subscribers keyed by subscriber ID.
+	Subscribers map[string]SubscriberStats
+}
+
+// SubscriberStats are subscriber statistics.
+type SubscriberStats struct {
+	// Lag is the number of messages delivered to subscriber but not yet received.
+	Lag int
+	// InFlight is the number of received messages awaiting acknowledgement.
+	InFlight int
+}
@@ -0,0 +1,77 @@
+package broker
+
+import "strings"
+
+const (
+	// TopicSep separates topic tokens.
+	TopicSep = "."
+	// AnyToken matches exactly one topic token.
+	AnyToken = "*"
+	// TailToken matches one or more trailing topic tokens.
+	TailToken = ">"
+)
+
+// IsPattern returns true if topic contains wildcard tokens.
+func IsPattern(topic string) bool {
+	for _, tok := range strings.Split(topic, TopicSep) {
+		if tok == AnyToken || tok == TailToken {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidPattern returns ErrInvalidTopic if pattern is not a valid subscription topic.
+// Subscription topics consist of non-empty tokens separated by TopicSep.
+// AnyToken can be used in place of any token, TailToken can only be used as the last token.
+func ValidPattern(pattern string) error {
+	toks := strings.Split(pattern, TopicSep)
+	for i, tok := range toks {
+		if tok == "" {
+			return ErrInvalidTopic
+		}
+		if tok == TailToken && i != len(toks)-1 {
+			return ErrInvalidTopic
+		}
+		if tok != AnyToken && tok != TailToken &&
+			strings.ContainsAny(tok, AnyToken+TailToken) {
+			return ErrInvalidTopic
+		}
+	}
+	return nil
+}
+
+// ValidTopic returns ErrInvalidTopic if topic is not a valid publish topic.
+// Publish topics are subscription topics which contain no wildcard tokens.
+func ValidTopic(topic string) error {
+	if err := ValidPattern(topic); err != nil {
+		return err
+	}
+	if IsPattern(topic) {
+		return ErrInvalidTopic
+	}
+	return nil
+}
+
+// MatchTopic returns true if topic matches pattern.
+// AnyToken in pattern matches exactly one topic token,
+// TailToken matches one or more trailing topic tokens.
+// Patterns without wildcard tokens match only identical topics.
+func MatchTopic(pattern, topic string) bool {
+	pToks := strings.Split(pattern, TopicSep)
+	tToks := strings.Split(topic, TopicSep)
+
+	for i, pTok := range pToks {
+		if pTok == TailToken {
+			return len(tToks) > i
+		}
+		if i >= len(tToks) {
+			return false
+		}
+		if pTok != AnyToken && pTok != tToks[i] {
+			return false
+		}
+	}
+
+	return len(pToks) == len(tToks)
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidTopic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	testCases := []struct {
+		topic   string
+		pattern error
+		publish error
+	}{
+		{"foo", nil, nil},
+		{"k8s.cluster1.objects", nil, nil},
+		{"k8s.*.objects", nil, ErrInvalidTopic},
+		{"k8s.>", nil, ErrInvalidTopic},
+		{"*", nil, ErrInvalidTopic},
+		{"", ErrInvalidTopic, ErrInvalidTopic},
+		{"k8s..objects", ErrInvalidTopic, ErrInvalidTopic},
+		{"k8s.>.objects", ErrInvalidTopic, ErrInvalidTopic},
+		{"k8s.cluster*.objects", ErrInvalidTopic, ErrInvalidTopic},
+	}
+
+	for _, tc := range testCases {
+		if err := ValidPattern(tc.topic); !errors.Is(err, tc.pattern) {
+			t.Errorf("pattern %q: expected error: %v, got: %v", tc.topic, tc.pattern, err)
+		}
+
+		if err := ValidTopic(tc.topic); !errors.Is(err, tc.publish) {
+			t.Errorf("topic %q: expected error: %v, got: %v", tc.topic, tc.publish, err)
+		}
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	testCases := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"foo", "foo.bar", false},
+		{"k8s.*.objects", "k8s.cluster1.objects", true},
+		{"k8s.*.objects", "k8s.cluster1.links", false},
+		{"k8s.*.objects", "k8s.objects", false},
+		{"k8s.*", "k8s.cluster1.objects", false},
+		{"k8s.>", "k8s.cluster1", true},
+		{"k8s.>", "k8s.cluster1.objects", true},
+		{"k8s.>", "k8s", false},
+		{"*.*.objects", "k8s.cluster1.objects", true},
+		{">", "k8s.cluster1.objects", true},
+	}
+
+	for _, tc := range testCases {
+		if match := MatchTopic(tc.pattern, tc.topic); match != tc.match {
+			t.Errorf("pattern %q topic %q: expected match: %v, got: %v", tc.pattern, tc.topic, tc.match, match)
+		}
+	}
+}
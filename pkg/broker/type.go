@@ -5,17 +5,21 @@ package broker
 // encoded in the broker message payload.
 type Type int
 
+// NOTE: brokers store message types as integers so
+// type values must never change once they're released.
 const (
 	// Entity is space.Entity.
-	Entity Type = iota
+	Entity Type = 0
 	// Object is space.Object
-	Object
+	Object Type = 1
 	// Resource is space.Resource.
-	Resource
+	Resource Type = 2
 	// Link is space.Link.
-	Link
+	Link Type = 3
 	// Unknown type.
-	Unknown
+	Unknown Type = 4
+	// Event is netscrape lifecycle event.
+	Event Type = 5
 )
 
 const (
@@ -23,6 +27,7 @@ const (
 	resourceString = "Resource"
 	objectString   = "Object"
 	linkString     = "Link"
+	eventString    = "Event"
 	unknownString  = "Unknown"
 )
 
@@ -37,6 +42,8 @@ func (t Type) String() string {
 		return linkString
 	case Object:
 		return objectString
+	case Event:
+		return eventString
 	default:
 		return unknownString
 	}
@@ -0,0 +1,32 @@
+package broker
+
+import "testing"
+
+func TestType(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	testCases := []struct {
+		typ   Type
+		value int
+		str   string
+	}{
+		{Entity, 0, entityString},
+		{Object, 1, objectString},
+		{Resource, 2, resourceString},
+		{Link, 3, linkString},
+		{Unknown, 4, unknownString},
+		{Event, 5, eventString},
+	}
+
+	for _, tc := range testCases {
+		if int(tc.typ) != tc.value {
+			t.Errorf("type %s: expected value: %d, got: %d", tc.str, tc.value, int(tc.typ))
+		}
+
+		if s := tc.typ.String(); s != tc.str {
+			t.Errorf("expected type: %s, got: %s", tc.str, s)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package plan
+
+import "context"
+
+// Discoverer discovers resources available in a source,
+// e.g. via the source API type catalogue.
+type Discoverer interface {
+	// Discover returns all resources available in source.
+	Discover(context.Context, ...Option) ([]Resource, error)
+}
+
+// DiscoveryFilter filters discovered resources by their groups and kinds.
+// Resources are selected if their group and kind are allowed and not denied.
+// Empty allow lists allow all groups or kinds; "*" matches any group or kind.
+type DiscoveryFilter struct {
+	AllowGroups []string
+	DenyGroups  []string
+	AllowKinds  []string
+	DenyKinds   []string
+}
+
+// contains returns true if vals contains v or "*".
+func contains(vals []string, v string) bool {
+	for _, val := range vals {
+		if val == v || val == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches implements Selector.
+func (f DiscoveryFilter) Matches(r Resource) bool {
+	if len(f.AllowGroups) > 0 && !contains(f.AllowGroups, r.Group()) {
+		return false
+	}
+
+	if len(f.AllowKinds) > 0 && !contains(f.AllowKinds, r.Kind()) {
+		return false
+	}
+
+	return !contains(f.DenyGroups, r.Group()) && !contains(f.DenyKinds, r.Kind())
+}
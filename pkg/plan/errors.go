@@ -5,6 +5,8 @@ import "errors"
 var (
 	// ErrResourceNotFound is returned when a Resource could not be found in Plan.
 	ErrResourceNotFound = errors.New("ErrResourceNotFound")
+	// ErrInvalidSelector is returned when parsing invalid selector.
+	ErrInvalidSelector = errors.New("ErrInvalidSelector")
 	// ErrNotImplemented is returned when requesting a feature that has not been implemented yet.
 	ErrNotImplemented = errors.New("ErrNotImplemented")
 )
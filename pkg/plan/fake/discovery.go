@@ -0,0 +1,56 @@
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+)
+
+// Discoverer is a fake plan.Discoverer which discovers a fixed set of resources.
+type Discoverer struct {
+	mu        sync.Mutex
+	resources []plan.Resource
+	err       error
+	calls     int
+}
+
+// NewDiscoverer creates a new fake discoverer which discovers rx and returns it.
+func NewDiscoverer(rx ...plan.Resource) *Discoverer {
+	return &Discoverer{
+		resources: rx,
+	}
+}
+
+// SetError sets the error returned by Discover.
+func (d *Discoverer) SetError(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.err = err
+}
+
+// Calls returns the number of Discover calls.
+func (d *Discoverer) Calls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.calls
+}
+
+// Discover returns discoverer resources or the error set by SetError.
+func (d *Discoverer) Discover(ctx context.Context, opts ...plan.Option) ([]plan.Resource, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls++
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	rx := make([]plan.Resource, len(d.resources))
+	copy(rx, d.resources)
+
+	return rx, nil
+}
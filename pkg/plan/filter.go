@@ -0,0 +1,86 @@
+package plan
+
+import (
+	"context"
+
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+)
+
+// filtered is a plan view which contains only selected resources.
+type filtered struct {
+	Plan
+	s Selector
+}
+
+// Filter returns a view of p which contains only resources selected by s.
+// Resources added to the view are added to p. Only selected resources
+// can be deleted through the view.
+func Filter(p Plan, s Selector) Plan {
+	return &filtered{Plan: p, s: s}
+}
+
+// Unfilter returns the plan filtered by p and the selector which filters it.
+// If p is not filtered, it returns p and nil selector.
+func Unfilter(p Plan) (Plan, Selector) {
+	if f, ok := p.(*filtered); ok {
+		return f.Plan, f.s
+	}
+	return p, nil
+}
+
+// Get returns the resource with the given uid if it's selected.
+func (f *filtered) Get(ctx context.Context, uid uuid.UID, opts ...Option) (Resource, error) {
+	r, err := f.Plan.Get(ctx, uid, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.s.Matches(r) {
+		return nil, ErrResourceNotFound
+	}
+
+	return r, nil
+}
+
+// Delete removes the resource with the given uid from the filtered plan.
+// It returns ErrResourceNotFound if the resource is not selected.
+func (f *filtered) Delete(ctx context.Context, uid uuid.UID, opts ...Option) error {
+	r, err := f.Plan.Get(ctx, uid, opts...)
+	if err == nil && !f.s.Matches(r) {
+		return ErrResourceNotFound
+	}
+
+	return f.Plan.Delete(ctx, uid, opts...)
+}
+
+// GetAll returns all selected resources.
+func (f *filtered) GetAll(ctx context.Context, opts ...Option) ([]Resource, error) {
+	rx, err := f.Plan.GetAll(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return selected(rx, f.s), nil
+}
+
+// selected returns resources in rx selected by s.
+func selected(rx []Resource, s Selector) []Resource {
+	res := make([]Resource, 0, len(rx))
+	for _, r := range rx {
+		if s.Matches(r) {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// Select returns resources of p selected by s.
+func Select(ctx context.Context, p Plan, s Selector) ([]Resource, error) {
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return selected(rx, s), nil
+}
@@ -1,7 +1,17 @@
 package plan
 
 // Options configure PLan.
-type Options struct{}
+type Options struct {
+	// Selector selects plan resources.
+	Selector Selector
+}
 
 // Option is functional plan option.
 type Option func(*Options)
+
+// WithSelector sets Selector option.
+func WithSelector(s Selector) Option {
+	return func(o *Options) {
+		o.Selector = s
+	}
+}
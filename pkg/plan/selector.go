@@ -0,0 +1,203 @@
+package plan
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Selector selects plan resources.
+type Selector interface {
+	// Matches returns true if r is selected.
+	Matches(r Resource) bool
+}
+
+// SelectorFunc is a function which implements Selector.
+type SelectorFunc func(Resource) bool
+
+// Matches implements Selector.
+func (f SelectorFunc) Matches(r Resource) bool {
+	return f(r)
+}
+
+// All selects all resources.
+var All = SelectorFunc(func(Resource) bool { return true })
+
+// GVK selects resources with the given group, version and kind.
+// Empty value matches any group, version or kind.
+func GVK(group, version, kind string) Selector {
+	return SelectorFunc(func(r Resource) bool {
+		return (group == "" || r.Group() == group) &&
+			(version == "" || r.Version() == version) &&
+			(kind == "" || r.Kind() == kind)
+	})
+}
+
+// Glob selects resources whose group, version and kind match
+// the given shell patterns as defined by path.Match.
+// Empty pattern matches any group, version or kind.
+func Glob(group, version, kind string) (Selector, error) {
+	patterns := []string{group, version, kind}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSelector, p, err)
+		}
+	}
+
+	return SelectorFunc(func(r Resource) bool {
+		for i, v := range []string{r.Group(), r.Version(), r.Kind()} {
+			if patterns[i] == "" {
+				continue
+			}
+			if ok, _ := path.Match(patterns[i], v); !ok {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// Regexp selects resources whose group, version and kind
+// match the given regular expressions.
+// Expressions must match the whole value, e.g. Pod does not match PodTemplate.
+// Empty expression matches any group, version or kind.
+func Regexp(group, version, kind string) (Selector, error) {
+	var rx [3]*regexp.Regexp
+	for i, expr := range []string{group, version, kind} {
+		if expr == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSelector, expr, err)
+		}
+		rx[i] = re
+	}
+
+	return SelectorFunc(func(r Resource) bool {
+		for i, v := range []string{r.Group(), r.Version(), r.Kind()} {
+			if rx[i] != nil && !rx[i].MatchString(v) {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// ParseSelector parses selector given by expression of the form
+// "group/version/kind", e.g. "apps/v1/Deployment" or "*/v1/*".
+// Expression parts are shell patterns as accepted by Glob.
+// Expression of the form "version/kind" selects resources in the core group.
+// The returned selector implements fmt.Stringer which returns expr.
+func ParseSelector(expr string) (Selector, error) {
+	var (
+		s   Selector
+		err error
+	)
+
+	parts := strings.Split(expr, "/")
+	switch len(parts) {
+	case 2:
+		s, err = Glob("", parts[0], parts[1])
+	case 3:
+		s, err = Glob(parts[0], parts[1], parts[2])
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSelector, expr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) == 2 {
+		s = And(core, s)
+	}
+
+	return exprSelector{Selector: s, expr: expr}, nil
+}
+
+// core selects resources in the core group.
+var core = SelectorFunc(func(r Resource) bool { return r.Group() == "" })
+
+// exprSelector is selector parsed from expression.
+type exprSelector struct {
+	Selector
+	expr string
+}
+
+// String returns selector expression.
+func (s exprSelector) String() string {
+	return s.expr
+}
+
+// And selects resources selected by all sx.
+func And(sx ...Selector) Selector {
+	return SelectorFunc(func(r Resource) bool {
+		for _, s := range sx {
+			if !s.Matches(r) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or selects resources selected by any of sx.
+func Or(sx ...Selector) Selector {
+	return SelectorFunc(func(r Resource) bool {
+		for _, s := range sx {
+			if s.Matches(r) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not selects resources not selected by s.
+func Not(s Selector) Selector {
+	return SelectorFunc(func(r Resource) bool {
+		return !s.Matches(r)
+	})
+}
+
+// Rules are include and exclude rules.
+// Resources are selected if they match any of the include rules,
+// or if there are no include rules, and none of the exclude rules.
+type Rules struct {
+	Include []Selector
+	Exclude []Selector
+}
+
+// Matches implements Selector.
+func (r Rules) Matches(res Resource) bool {
+	if len(r.Include) > 0 && !Or(r.Include...).Matches(res) {
+		return false
+	}
+
+	return !Or(r.Exclude...).Matches(res)
+}
+
+// ParseRules parses include and exclude rules given by selector expressions.
+func ParseRules(include, exclude []string) (Rules, error) {
+	var rules Rules
+
+	for _, expr := range include {
+		s, err := ParseSelector(expr)
+		if err != nil {
+			return Rules{}, err
+		}
+		rules.Include = append(rules.Include, s)
+	}
+
+	for _, expr := range exclude {
+		s, err := ParseSelector(expr)
+		if err != nil {
+			return Rules{}, err
+		}
+		rules.Exclude = append(rules.Exclude, s)
+	}
+
+	return rules, nil
+}
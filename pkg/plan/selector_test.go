@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+)
+
+type testResource struct {
+	uid                  uuid.UID
+	group, version, kind string
+}
+
+func (r testResource) UID() uuid.UID   { return r.uid }
+func (r testResource) Group() string   { return r.group }
+func (r testResource) Version() string { return r.version }
+func (r testResource) Kind() string    { return r.kind }
+
+func NewTestResource(group, version, kind string) Resource {
+	return testResource{uid: memuid.New(), group: group, version: version, kind: kind}
+}
+
+func TestSelectors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	deploy := NewTestResource("apps", "v1", "Deployment")
+	sts := NewTestResource("apps", "v1", "StatefulSet")
+	pod := NewTestResource("", "v1", "Pod")
+	beta := NewTestResource("apps", "v1beta1", "Deployment")
+	tmpl := NewTestResource("", "v1", "PodTemplate")
+
+	resources := []Resource{deploy, sts, pod, beta, tmpl}
+
+	mustGlob := func(g, v, k string) Selector {
+		s, err := Glob(g, v, k)
+		if err != nil {
+			t.Fatalf("failed creating selector: %v", err)
+		}
+		return s
+	}
+
+	mustRegexp := func(g, v, k string) Selector {
+		s, err := Regexp(g, v, k)
+		if err != nil {
+			t.Fatalf("failed creating selector: %v", err)
+		}
+		return s
+	}
+
+	mustParse := func(expr string) Selector {
+		s, err := ParseSelector(expr)
+		if err != nil {
+			t.Fatalf("failed parsing selector: %v", err)
+		}
+		return s
+	}
+
+	testCases := []struct {
+		name string
+		s    Selector
+		exp  []Resource
+	}{
+		{"All", All, resources},
+		{"GVK", GVK("apps", "v1", ""), []Resource{deploy, sts}},
+		{"GVKEmpty", GVK("", "v1", ""), []Resource{deploy, sts, pod, tmpl}},
+		{"Glob", mustGlob("*", "v1*", "Deployment"), []Resource{deploy, beta}},
+		{"GlobEmpty", mustGlob("", "v1", ""), []Resource{deploy, sts, pod, tmpl}},
+		{"Regexp", mustRegexp("apps", "v1", ".*Set"), []Resource{sts}},
+		{"RegexpAnchored", mustRegexp("", "", "Pod"), []Resource{pod}},
+		{"RegexpEmpty", mustRegexp("", "v1", ""), []Resource{deploy, sts, pod, tmpl}},
+		{"Parse", mustParse("apps/v1/Deployment"), []Resource{deploy}},
+		{"ParseCore", mustParse("v1/Pod"), []Resource{pod}},
+		{"ParseCoreGlob", mustParse("v1/*"), []Resource{pod, tmpl}},
+		{"And", And(GVK("apps", "", ""), GVK("", "v1", "")), []Resource{deploy, sts}},
+		{"Or", Or(GVK("", "", "Pod"), GVK("", "", "StatefulSet")), []Resource{sts, pod}},
+		{"Not", Not(GVK("apps", "", "")), []Resource{pod, tmpl}},
+		{"Include", Rules{Include: []Selector{mustParse("apps/v1/*")}}, []Resource{deploy, sts}},
+		{"Exclude", Rules{Exclude: []Selector{mustParse("apps/*/Deployment")}}, []Resource{sts, pod, tmpl}},
+		{"IncludeExclude", Rules{
+			Include: []Selector{mustParse("apps/*/*")},
+			Exclude: []Selector{mustParse("*/v1beta1/*")},
+		}, []Resource{deploy, sts}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := selected(resources, tc.s)
+			if len(got) != len(tc.exp) {
+				t.Fatalf("expected resources: %d, got: %d", len(tc.exp), len(got))
+			}
+
+			for i := range got {
+				if got[i].UID() != tc.exp[i].UID() {
+					t.Errorf("expected resource: %s, got: %s", tc.exp[i].UID(), got[i].UID())
+				}
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := ParseSelector("Deployment"); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidSelector, err)
+		}
+
+		if _, err := Glob("[", "*", "*"); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidSelector, err)
+		}
+
+		if _, err := Regexp("(", "", ""); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidSelector, err)
+		}
+
+		if _, err := ParseRules([]string{"apps/v1/*"}, []string{"a/b/c/d"}); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidSelector, err)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package simple
+
+import (
+	"context"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+)
+
+// Discover creates a new plan from resources discovered by d
+// which are selected by s and returns it. If s is nil,
+// all discovered resources are added to the plan.
+// Use plan.DiscoveryFilter to filter resources by groups and kinds.
+func Discover(ctx context.Context, d plan.Discoverer, s plan.Selector, opts ...plan.Option) (*Simple, error) {
+	rx, err := d.Discover(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := NewSimple(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rx {
+		if s == nil || s.Matches(r) {
+			if err := p.Add(ctx, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return p, nil
+}
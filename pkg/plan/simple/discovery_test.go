@@ -0,0 +1,71 @@
+package simple
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/plan/fake"
+)
+
+func TestDiscover(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	d := fake.NewDiscoverer(
+		MustResource(t, "apps", "v1", "Deployment"),
+		MustResource(t, "apps", "v1", "StatefulSet"),
+		MustResource(t, "", "v1", "Pod"),
+		MustResource(t, "", "v1", "Secret"),
+		MustResource(t, "batch", "v1", "Job"),
+	)
+
+	testCases := []struct {
+		name string
+		s    plan.Selector
+		exp  []string
+	}{
+		{"All", nil, []string{"Deployment", "StatefulSet", "Pod", "Secret", "Job"}},
+		{"AllowGroups", plan.DiscoveryFilter{AllowGroups: []string{"apps", ""}}, []string{"Deployment", "StatefulSet", "Pod", "Secret"}},
+		{"DenyGroups", plan.DiscoveryFilter{DenyGroups: []string{"apps"}}, []string{"Pod", "Secret", "Job"}},
+		{"AllowKinds", plan.DiscoveryFilter{AllowKinds: []string{"Pod", "Job"}}, []string{"Pod", "Job"}},
+		{"DenyKinds", plan.DiscoveryFilter{AllowGroups: []string{"*"}, DenyKinds: []string{"Secret"}}, []string{"Deployment", "StatefulSet", "Pod", "Job"}},
+		{"AllowDeny", plan.DiscoveryFilter{AllowGroups: []string{"apps"}, DenyKinds: []string{"StatefulSet"}}, []string{"Deployment"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Discover(context.Background(), d, tc.s)
+			if err != nil {
+				t.Fatalf("failed discovering plan: %v", err)
+			}
+
+			kinds := MustKinds(t, p)
+			if len(kinds) != len(tc.exp) {
+				t.Fatalf("expected kinds: %v, got: %v", tc.exp, kinds)
+			}
+
+			for _, k := range tc.exp {
+				if !kinds[k] {
+					t.Errorf("expected kind %s in plan", k)
+				}
+			}
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		errDiscover := errors.New("discovery error")
+		d := fake.NewDiscoverer()
+		d.SetError(errDiscover)
+
+		if _, err := Discover(context.Background(), d, nil); !errors.Is(err, errDiscover) {
+			t.Errorf("expected error: %v, got: %v", errDiscover, err)
+		}
+
+		if n := d.Calls(); n != 1 {
+			t.Errorf("expected calls: %d, got: %d", 1, n)
+		}
+	})
+}
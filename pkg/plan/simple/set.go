@@ -0,0 +1,110 @@
+package simple
+
+import (
+	"context"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+)
+
+// index returns resources of p indexed by their UID.
+func index(ctx context.Context, p plan.Plan) (map[string]plan.Resource, error) {
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make(map[string]plan.Resource, len(rx))
+	for _, r := range rx {
+		idx[r.UID().String()] = r
+	}
+
+	return idx, nil
+}
+
+// Merge returns a new plan which contains resources of all px.
+// Resources are identified by their UID; if several plans contain
+// resource with the same UID the resource of the last plan is used.
+func Merge(ctx context.Context, px ...plan.Plan) (*Simple, error) {
+	res, err := NewSimple()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range px {
+		idx, err := index(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		for uid, r := range idx {
+			res.index[uid] = r
+		}
+	}
+
+	return res, nil
+}
+
+// Intersect returns a new plan which contains resources of p
+// which are also contained in all of px.
+func Intersect(ctx context.Context, p plan.Plan, px ...plan.Plan) (*Simple, error) {
+	res, err := Merge(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range px {
+		idx, err := index(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		for uid := range res.index {
+			if _, ok := idx[uid]; !ok {
+				delete(res.index, uid)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Subtract returns a new plan which contains resources of p
+// which are not contained in any of px.
+func Subtract(ctx context.Context, p plan.Plan, px ...plan.Plan) (*Simple, error) {
+	res, err := Merge(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range px {
+		idx, err := index(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		for uid := range idx {
+			delete(res.index, uid)
+		}
+	}
+
+	return res, nil
+}
+
+// Select returns a new plan which contains resources of p selected by s.
+func Select(ctx context.Context, p plan.Plan, s plan.Selector) (*Simple, error) {
+	rx, err := plan.Select(ctx, p, s)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := NewSimple()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rx {
+		res.index[r.UID().String()] = r
+	}
+
+	return res, nil
+}
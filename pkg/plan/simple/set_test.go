@@ -0,0 +1,120 @@
+package simple
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/space/entity"
+)
+
+func MustPlan(t *testing.T, rx ...plan.Resource) *Simple {
+	p := MustNewSimple(t)
+	for _, r := range rx {
+		if err := p.Add(context.Background(), r); err != nil {
+			t.Fatalf("failed adding resource %s: %v", r.UID(), err)
+		}
+	}
+	return p
+}
+
+func MustResource(t *testing.T, group, version, kind string) plan.Resource {
+	r, err := entity.NewResource("resType", "resName", group, version, kind, false)
+	if err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+	return r
+}
+
+func MustKinds(t *testing.T, p plan.Plan, opts ...plan.Option) map[string]bool {
+	rx, err := p.GetAll(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("failed getting all resources: %v", err)
+	}
+
+	kinds := make(map[string]bool, len(rx))
+	for _, r := range rx {
+		kinds[r.Kind()] = true
+	}
+	return kinds
+}
+
+func TestSetOps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	a := MustResource(t, "apps", "v1", "A")
+	b := MustResource(t, "apps", "v1", "B")
+	c := MustResource(t, "", "v1", "C")
+
+	p1 := MustPlan(t, a, b)
+	p2 := MustPlan(t, b, c)
+
+	testCases := []struct {
+		name string
+		op   func() (*Simple, error)
+		exp  []string
+	}{
+		{"Merge", func() (*Simple, error) { return Merge(context.Background(), p1, p2) }, []string{"A", "B", "C"}},
+		{"Intersect", func() (*Simple, error) { return Intersect(context.Background(), p1, p2) }, []string{"B"}},
+		{"Subtract", func() (*Simple, error) { return Subtract(context.Background(), p1, p2) }, []string{"A"}},
+		{"Select", func() (*Simple, error) { return Select(context.Background(), p2, plan.GVK("", "", "C")) }, []string{"C"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := tc.op()
+			if err != nil {
+				t.Fatalf("failed set operation: %v", err)
+			}
+
+			kinds := MustKinds(t, p)
+			if len(kinds) != len(tc.exp) {
+				t.Fatalf("expected kinds: %v, got: %v", tc.exp, kinds)
+			}
+
+			for _, k := range tc.exp {
+				if !kinds[k] {
+					t.Errorf("expected kind %s in plan", k)
+				}
+			}
+		})
+	}
+
+	t.Run("Filter", func(t *testing.T) {
+		f := plan.Filter(p1, plan.GVK("", "", "A"))
+
+		if kinds := MustKinds(t, f); len(kinds) != 1 || !kinds["A"] {
+			t.Errorf("expected kinds: %v, got: %v", []string{"A"}, kinds)
+		}
+
+		if _, err := f.Get(context.Background(), b.UID()); !errors.Is(err, plan.ErrResourceNotFound) {
+			t.Errorf("expected error: %v, got: %v", plan.ErrResourceNotFound, err)
+		}
+	})
+
+	t.Run("FilterDelete", func(t *testing.T) {
+		p := MustPlan(t, a, b)
+		f := plan.Filter(p, plan.GVK("", "", "A"))
+
+		if err := f.Delete(context.Background(), b.UID()); !errors.Is(err, plan.ErrResourceNotFound) {
+			t.Errorf("expected error: %v, got: %v", plan.ErrResourceNotFound, err)
+		}
+
+		if err := f.Delete(context.Background(), a.UID()); err != nil {
+			t.Fatalf("failed deleting resource: %v", err)
+		}
+
+		if kinds := MustKinds(t, p); len(kinds) != 1 || !kinds["B"] {
+			t.Errorf("expected kinds: %v, got: %v", []string{"B"}, kinds)
+		}
+	})
+
+	t.Run("WithSelector", func(t *testing.T) {
+		if kinds := MustKinds(t, p1, plan.WithSelector(plan.GVK("", "", "B"))); len(kinds) != 1 || !kinds["B"] {
+			t.Errorf("expected kinds: %v, got: %v", []string{"B"}, kinds)
+		}
+	})
+}
@@ -42,17 +42,22 @@ func (p *Simple) Add(ctx context.Context, r plan.Resource, opts ...plan.Option)
 }
 
 func (p Simple) getAll(ctx context.Context, opts ...plan.Option) ([]plan.Resource, error) {
-	res := make([]plan.Resource, len(p.index))
+	popts := plan.Options{}
+	for _, apply := range opts {
+		apply(&popts)
+	}
 
-	i := 0
+	res := make([]plan.Resource, 0, len(p.index))
 	for _, r := range p.index {
-		res[i] = r
-		i++
+		if popts.Selector == nil || popts.Selector.Matches(r) {
+			res = append(res, r)
+		}
 	}
 	return res, nil
 }
 
-// GetAll returns all resource
+// GetAll returns all resource.
+// If Selector option is given, only selected resources are returned.
 func (p *Simple) GetAll(ctx context.Context, opts ...plan.Option) ([]plan.Resource, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
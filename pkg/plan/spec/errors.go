@@ -0,0 +1,10 @@
+package spec
+
+import "errors"
+
+var (
+	// ErrInvalidSpec is returned when plan spec fails validation.
+	ErrInvalidSpec = errors.New("ErrInvalidSpec")
+	// ErrUnsupportedVersion is returned when loading plan spec of unsupported version.
+	ErrUnsupportedVersion = errors.New("ErrUnsupportedVersion")
+)
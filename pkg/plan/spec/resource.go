@@ -0,0 +1,51 @@
+package spec
+
+import (
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+)
+
+// Resource is plan resource defined by plan spec.
+type Resource struct {
+	uid     uuid.UID
+	name    string
+	group   string
+	version string
+	kind    string
+	deps    []string
+	opts    map[string]string
+}
+
+// UID returns unique ID.
+func (r *Resource) UID() uuid.UID {
+	return r.uid
+}
+
+// Name returns name.
+func (r *Resource) Name() string {
+	return r.name
+}
+
+// Group returns group.
+func (r *Resource) Group() string {
+	return r.group
+}
+
+// Version returns version.
+func (r *Resource) Version() string {
+	return r.version
+}
+
+// Kind returns kind.
+func (r *Resource) Kind() string {
+	return r.kind
+}
+
+// DependsOn returns names of resources r depends on.
+func (r *Resource) DependsOn() []string {
+	return r.deps
+}
+
+// Options returns resource scrape options.
+func (r *Resource) Options() map[string]string {
+	return r.opts
+}
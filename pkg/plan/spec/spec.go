@@ -0,0 +1,402 @@
+package spec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/plan/simple"
+
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+)
+
+// Version is the current plan spec version.
+const Version = "v1"
+
+// ResourceSpec defines plan resource.
+type ResourceSpec struct {
+	// Name uniquely identifies resource in plan.
+	Name string `json:"name"`
+	// UID is resource UID. It defaults to resource name,
+	// so resources keep their UIDs across loads.
+	UID     string `json:"uid,omitempty"`
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// DependsOn are names of resources which must be scraped first.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Options are resource scrape options.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// SelectorSpec defines include and exclude rules.
+// Rules are selector expressions as accepted by plan.ParseSelector.
+type SelectorSpec struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Spec is declarative plan definition.
+type Spec struct {
+	// Version is plan spec version.
+	Version   string         `json:"version"`
+	Resources []ResourceSpec `json:"resources"`
+	// Selectors restrict plan resources.
+	Selectors *SelectorSpec `json:"selectors,omitempty"`
+}
+
+// Decode decodes plan spec from YAML or JSON encoded data and validates it.
+// Data with fields unknown to the spec is rejected.
+func Decode(data []byte) (*Spec, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+
+	s := &Spec{}
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate validates plan spec.
+// Resources must have unique names, version and kind and must depend
+// only on resources defined in the spec with no dependency cycles.
+func (s *Spec) Validate() error {
+	if s.Version != Version {
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, s.Version)
+	}
+
+	names := make(map[string]*ResourceSpec, len(s.Resources))
+	uids := make(map[string]bool, len(s.Resources))
+
+	for i := range s.Resources {
+		r := &s.Resources[i]
+
+		if r.Name == "" {
+			return fmt.Errorf("%w: resource %d: missing name", ErrInvalidSpec, i)
+		}
+
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("%w: resource %s: duplicate name", ErrInvalidSpec, r.Name)
+		}
+		names[r.Name] = r
+
+		uid := r.uid()
+		if uids[uid] {
+			return fmt.Errorf("%w: resource %s: duplicate uid %s", ErrInvalidSpec, r.Name, uid)
+		}
+		uids[uid] = true
+
+		if r.Version == "" || r.Kind == "" {
+			return fmt.Errorf("%w: resource %s: missing version or kind", ErrInvalidSpec, r.Name)
+		}
+	}
+
+	for _, r := range s.Resources {
+		for _, dep := range r.DependsOn {
+			if _, ok := names[dep]; !ok {
+				return fmt.Errorf("%w: resource %s: unknown dependency %s", ErrInvalidSpec, r.Name, dep)
+			}
+		}
+	}
+
+	if err := acyclic(names); err != nil {
+		return err
+	}
+
+	if s.Selectors != nil {
+		if _, err := plan.ParseRules(s.Selectors.Include, s.Selectors.Exclude); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+		}
+	}
+
+	return nil
+}
+
+// uid returns resource UID.
+func (r ResourceSpec) uid() string {
+	if r.UID != "" {
+		return r.UID
+	}
+	return r.Name
+}
+
+// acyclic returns error if resource dependencies contain a cycle.
+func acyclic(names map[string]*ResourceSpec) error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int, len(names))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("%w: dependency cycle %s", ErrInvalidSpec, strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range names[name].DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		return nil
+	}
+
+	// NOTE: names are sorted so the reported cycle is deterministic
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	for _, name := range keys {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Plan creates a new plan from spec and returns it.
+// Plan resources are of type *Resource. If spec defines selectors,
+// the returned plan contains only the selected resources.
+func (s *Spec) Plan(ctx context.Context) (plan.Plan, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	p, err := simple.NewSimple()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rs := range s.Resources {
+		r := &Resource{
+			uid:     memuid.NewFromString(rs.uid()),
+			name:    rs.Name,
+			group:   rs.Group,
+			version: rs.Version,
+			kind:    rs.Kind,
+			deps:    rs.DependsOn,
+			opts:    rs.Options,
+		}
+
+		if err := p.Add(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Selectors == nil {
+		return p, nil
+	}
+
+	rules, err := plan.ParseRules(s.Selectors.Include, s.Selectors.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan.Filter(p, rules), nil
+}
+
+// Load loads plan from YAML or JSON plan spec file at path.
+func Load(ctx context.Context, path string) (plan.Plan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return s.Plan(ctx)
+}
+
+// FromPlan creates plan spec from p and returns it.
+// Resources are sorted by name. Names, dependencies and options
+// are taken from resources which provide them, e.g. *Resource;
+// other resources are named by their UID.
+// If p is filtered by selector rules parsed from selector expressions,
+// e.g. p was loaded from spec, the spec contains all resources of the
+// filtered plan and the rules as its selectors. Otherwise the spec
+// contains only the selected resources and dependencies on
+// resources which are not selected are dropped.
+func FromPlan(ctx context.Context, p plan.Plan) (*Spec, error) {
+	s := &Spec{
+		Version: Version,
+	}
+
+	if base, sel := plan.Unfilter(p); sel != nil {
+		if _, inner := plan.Unfilter(base); inner == nil {
+			if sx, ok := selectorSpec(sel); ok {
+				p = base
+				s.Selectors = sx
+			}
+		}
+	}
+
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Resources = make([]ResourceSpec, 0, len(rx))
+	names := make(map[string]bool, len(rx))
+
+	for _, r := range rx {
+		uid := r.UID().String()
+
+		rs := ResourceSpec{
+			Name:    uid,
+			Group:   r.Group(),
+			Version: r.Version(),
+			Kind:    r.Kind(),
+		}
+
+		if n, ok := r.(interface{ Name() string }); ok && n.Name() != "" {
+			rs.Name = n.Name()
+		}
+
+		if rs.Name != uid {
+			rs.UID = uid
+		}
+
+		if d, ok := r.(interface{ DependsOn() []string }); ok {
+			rs.DependsOn = d.DependsOn()
+		}
+
+		if o, ok := r.(interface{ Options() map[string]string }); ok {
+			rs.Options = o.Options()
+		}
+
+		names[rs.Name] = true
+		s.Resources = append(s.Resources, rs)
+	}
+
+	for i := range s.Resources {
+		rs := &s.Resources[i]
+		if len(rs.DependsOn) == 0 {
+			continue
+		}
+
+		deps := make([]string, 0, len(rs.DependsOn))
+		for _, dep := range rs.DependsOn {
+			if names[dep] {
+				deps = append(deps, dep)
+			}
+		}
+
+		rs.DependsOn = nil
+		if len(deps) > 0 {
+			rs.DependsOn = deps
+		}
+	}
+
+	sort.Slice(s.Resources, func(i, j int) bool {
+		return s.Resources[i].Name < s.Resources[j].Name
+	})
+
+	return s, nil
+}
+
+// selectorSpec returns selector spec of sel.
+// It returns false if sel are not rules of selector expressions.
+func selectorSpec(sel plan.Selector) (*SelectorSpec, bool) {
+	rules, ok := sel.(plan.Rules)
+	if !ok {
+		return nil, false
+	}
+
+	include, ok := exprs(rules.Include)
+	if !ok {
+		return nil, false
+	}
+
+	exclude, ok := exprs(rules.Exclude)
+	if !ok {
+		return nil, false
+	}
+
+	return &SelectorSpec{Include: include, Exclude: exclude}, true
+}
+
+// exprs returns expressions of selectors sx.
+// It returns false if any of the selectors is not parsed from expression.
+func exprs(sx []plan.Selector) ([]string, bool) {
+	var res []string
+	for _, s := range sx {
+		e, ok := s.(fmt.Stringer)
+		if !ok {
+			return nil, false
+		}
+		res = append(res, e.String())
+	}
+
+	return res, true
+}
+
+// Format is plan spec encoding format.
+type Format int
+
+const (
+	// YAML format.
+	YAML Format = iota
+	// JSON format.
+	JSON
+)
+
+// Encode encodes plan spec in the given format.
+func (s *Spec) Encode(f Format) ([]byte, error) {
+	if f == JSON {
+		return json.MarshalIndent(s, "", "  ")
+	}
+	return yaml.Marshal(s)
+}
+
+// Save saves plan p to plan spec file at path.
+// Files with .json extension are encoded in JSON, all other files in YAML.
+func Save(ctx context.Context, path string, p plan.Plan) error {
+	s, err := FromPlan(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	f := YAML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		f = JSON
+	}
+
+	data, err := s.Encode(f)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
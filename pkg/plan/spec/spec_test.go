@@ -0,0 +1,232 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+)
+
+const (
+	planYAML = "testdata/plan.yaml"
+	planJSON = "testdata/plan.json"
+)
+
+func MustResources(t *testing.T, path string) map[string]*Resource {
+	p, err := Load(context.Background(), path)
+	if err != nil {
+		t.Fatalf("failed loading plan %s: %v", path, err)
+	}
+
+	rx, err := p.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("failed getting plan resources: %v", err)
+	}
+
+	res := make(map[string]*Resource, len(rx))
+	for _, r := range rx {
+		sr, ok := r.(*Resource)
+		if !ok {
+			t.Fatalf("expected *Resource, got: %T", r)
+		}
+		res[sr.Name()] = sr
+	}
+
+	return res
+}
+
+func TestLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("YAML", func(t *testing.T) {
+		res := MustResources(t, planYAML)
+
+		if len(res) != 3 {
+			t.Fatalf("expected resources: %d, got: %d", 3, len(res))
+		}
+
+		if _, ok := res["ingresses"]; ok {
+			t.Errorf("expected excluded resource: %s", "ingresses")
+		}
+
+		d := res["deployments"]
+		if d.Group() != "apps" || d.Version() != "v1" || d.Kind() != "Deployment" {
+			t.Errorf("unexpected resource: %s/%s/%s", d.Group(), d.Version(), d.Kind())
+		}
+
+		if d.UID().String() != "deployments" {
+			t.Errorf("expected uid: %s, got: %s", "deployments", d.UID())
+		}
+
+		if !reflect.DeepEqual(d.DependsOn(), []string{"replicasets"}) {
+			t.Errorf("expected dependencies: %v, got: %v", []string{"replicasets"}, d.DependsOn())
+		}
+
+		if ns := d.Options()["namespace"]; ns != "default" {
+			t.Errorf("expected namespace option: %s, got: %s", "default", ns)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		if res := MustResources(t, planJSON); len(res) != 2 {
+			t.Errorf("expected resources: %d, got: %d", 2, len(res))
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		if _, err := Load(context.Background(), "testdata/foo.yaml"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected error: %v, got: %v", os.ErrNotExist, err)
+		}
+	})
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	testCases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"Malformed", "version: [", ErrInvalidSpec},
+		{"Version", "version: v2", ErrUnsupportedVersion},
+		{"MissingName", "version: v1\nresources:\n- {version: v1, kind: Pod}", ErrInvalidSpec},
+		{"MissingKind", "version: v1\nresources:\n- {name: pods, version: v1}", ErrInvalidSpec},
+		{"DuplicateName", "version: v1\nresources:\n- {name: pods, version: v1, kind: Pod}\n- {name: pods, version: v1, kind: Pod}", ErrInvalidSpec},
+		{"DuplicateUID", "version: v1\nresources:\n- {name: pods, version: v1, kind: Pod}\n- {name: foo, uid: pods, version: v1, kind: Pod}", ErrInvalidSpec},
+		{"UnknownDependency", "version: v1\nresources:\n- {name: pods, version: v1, kind: Pod, dependsOn: [foo]}", ErrInvalidSpec},
+		{"Cycle", "version: v1\nresources:\n- {name: a, version: v1, kind: A, dependsOn: [b]}\n- {name: b, version: v1, kind: B, dependsOn: [a]}", ErrInvalidSpec},
+		{"Selector", "version: v1\nselectors:\n  include: [Pod]", ErrInvalidSpec},
+		{"UnknownField", "version: v1\nselectr:\n  include: [v1/Pod]", ErrInvalidSpec},
+		{"UnknownResourceField", "version: v1\nresources:\n- {name: pods, version: v1, kind: Pod, dependOn: [foo]}", ErrInvalidSpec},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Decode([]byte(tc.data)); !errors.Is(err, tc.err) {
+				t.Errorf("expected error: %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := Load(context.Background(), planYAML)
+	if err != nil {
+		t.Fatalf("failed loading plan: %v", err)
+	}
+
+	exp := MustResources(t, planYAML)
+
+	for _, name := range []string{"plan.yaml", "plan.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+
+			if err := Save(context.Background(), path, p); err != nil {
+				t.Fatalf("failed saving plan: %v", err)
+			}
+
+			res := MustResources(t, path)
+			if len(res) != len(exp) {
+				t.Fatalf("expected resources: %d, got: %d", len(exp), len(res))
+			}
+
+			for name, r := range exp {
+				got, ok := res[name]
+				if !ok {
+					t.Fatalf("expected resource: %s", name)
+				}
+
+				if !reflect.DeepEqual(got, r) {
+					t.Errorf("expected resource: %#v, got: %#v", r, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveFiltered(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := Load(context.Background(), planYAML)
+	if err != nil {
+		t.Fatalf("failed loading plan: %v", err)
+	}
+
+	t.Run("Selectors", func(t *testing.T) {
+		s, err := FromPlan(context.Background(), p)
+		if err != nil {
+			t.Fatalf("failed creating spec: %v", err)
+		}
+
+		if s.Selectors == nil || !reflect.DeepEqual(s.Selectors.Exclude, []string{"*/v1beta1/*"}) {
+			t.Errorf("expected exclude selectors: %v, got: %#v", []string{"*/v1beta1/*"}, s.Selectors)
+		}
+
+		if len(s.Resources) != 4 {
+			t.Errorf("expected resources: %d, got: %d", 4, len(s.Resources))
+		}
+	})
+
+	t.Run("Dependencies", func(t *testing.T) {
+		path := filepath.Join(dir, "plan.yaml")
+
+		if err := Save(context.Background(), path, plan.Filter(p, plan.GVK("apps", "", ""))); err != nil {
+			t.Fatalf("failed saving plan: %v", err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed reading plan: %v", err)
+		}
+
+		s, err := Decode(data)
+		if err != nil {
+			t.Fatalf("failed decoding plan: %v", err)
+		}
+
+		if err := s.Validate(); err != nil {
+			t.Fatalf("failed validating plan: %v", err)
+		}
+
+		res := MustResources(t, path)
+		if len(res) != 2 {
+			t.Fatalf("expected resources: %d, got: %d", 2, len(res))
+		}
+
+		if deps := res["deployments"].DependsOn(); !reflect.DeepEqual(deps, []string{"replicasets"}) {
+			t.Errorf("expected deployments dependencies: %v, got: %v", []string{"replicasets"}, deps)
+		}
+
+		if deps := res["replicasets"].DependsOn(); len(deps) != 0 {
+			t.Errorf("expected no replicasets dependencies, got: %v", deps)
+		}
+	})
+}
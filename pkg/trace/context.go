@@ -0,0 +1,33 @@
+package trace
+
+import "context"
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota
+	correlationKey
+)
+
+// ContextWithSpanContext returns a copy of ctx which stores sc.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey, sc)
+}
+
+// SpanContextFromContext returns span context stored in ctx.
+// It returns false if ctx does not store a valid span context.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// ContextWithCorrelationID returns a copy of ctx which stores correlation id.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey, id)
+}
+
+// CorrelationID returns correlation ID stored in ctx or empty string.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey).(string)
+	return id
+}
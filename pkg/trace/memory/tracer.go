@@ -0,0 +1,154 @@
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/trace"
+)
+
+// SpanData is recorded span.
+type SpanData struct {
+	// Name is span name.
+	Name string
+	// Context is span context.
+	Context trace.SpanContext
+	// ParentID is ID of the parent span.
+	ParentID string
+	// Attrs are span attributes.
+	Attrs map[string]string
+	// Errors are errors recorded by span.
+	Errors []error
+	// Start is span start time.
+	Start time.Time
+	// End is span end time.
+	End time.Time
+}
+
+// Tracer is in-memory tracer which exports ended spans to memory.
+type Tracer struct {
+	mu    *sync.Mutex
+	spans []SpanData
+}
+
+// NewTracer creates a new in-memory tracer and returns it.
+func NewTracer() *Tracer {
+	return &Tracer{
+		mu: &sync.Mutex{},
+	}
+}
+
+// newID returns a random hex encoded ID of n bytes.
+func newID(n int) string {
+	b := make([]byte, n)
+	// NOTE: crypto/rand.Read never fails on supported platforms
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Start starts a new span with the given name.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	parent, ok := trace.SpanContextFromContext(ctx)
+
+	sc := trace.SpanContext{
+		TraceID: parent.TraceID,
+		SpanID:  newID(8),
+	}
+
+	if !ok {
+		sc.TraceID = newID(16)
+	}
+
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:     name,
+			Context:  sc,
+			ParentID: parent.SpanID,
+			Attrs:    make(map[string]string),
+			Start:    time.Now(),
+		},
+	}
+
+	return trace.ContextWithSpanContext(ctx, sc), s
+}
+
+// export exports span data.
+func (t *Tracer) export(data SpanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = append(t.spans, data)
+}
+
+// Spans returns all ended spans in the order they ended.
+func (t *Tracer) Spans() []SpanData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]SpanData, len(t.spans))
+	copy(spans, t.spans)
+
+	return spans
+}
+
+// Reset removes all recorded spans.
+func (t *Tracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = nil
+}
+
+// span is in-memory span.
+type span struct {
+	sync.Mutex
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext returns span context.
+func (s *span) SpanContext() trace.SpanContext {
+	return s.data.Context
+}
+
+// SetAttr sets span attribute.
+func (s *span) SetAttr(key, val string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.data.Attrs[key] = val
+}
+
+// RecordError records err.
+func (s *span) RecordError(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+// End ends the span and exports it.
+// Calling End more than once has no effect.
+func (s *span) End() {
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+
+	data := s.data
+	data.Attrs = make(map[string]string, len(s.data.Attrs))
+	for k, v := range s.data.Attrs {
+		data.Attrs[k] = v
+	}
+	s.Unlock()
+
+	s.tracer.export(data)
+}
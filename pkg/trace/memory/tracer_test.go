@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/ingester"
+	"github.com/milosgajdos/netscrape/pkg/broker/ingester/simple"
+	memb "github.com/milosgajdos/netscrape/pkg/broker/memory"
+	"github.com/milosgajdos/netscrape/pkg/trace"
+)
+
+func TestTracer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("ParentChild", func(t *testing.T) {
+		tr := NewTracer()
+
+		ctx, parent := tr.Start(context.Background(), "parent")
+		_, child := tr.Start(ctx, "child")
+
+		child.End()
+		parent.End()
+		parent.End()
+
+		spans := tr.Spans()
+		if exp := 2; len(spans) != exp {
+			t.Fatalf("expected spans: %d, got: %d", exp, len(spans))
+		}
+
+		if spans[0].Context.TraceID != spans[1].Context.TraceID {
+			t.Errorf("expected the same trace ID, got: %s, %s", spans[0].Context.TraceID, spans[1].Context.TraceID)
+		}
+
+		if spans[0].ParentID != spans[1].Context.SpanID {
+			t.Errorf("expected parent ID: %s, got: %s", spans[1].Context.SpanID, spans[0].ParentID)
+		}
+
+		tr.Reset()
+		if n := len(tr.Spans()); n != 0 {
+			t.Errorf("expected no spans, got: %d", n)
+		}
+	})
+
+	t.Run("EndToEnd", func(t *testing.T) {
+		tr := NewTracer()
+
+		b, err := memb.New(broker.WithCap(1))
+		if err != nil {
+			t.Fatalf("failed creating broker: %v", err)
+		}
+
+		if err := b.Open(context.Background()); err != nil {
+			t.Fatalf("failed to open broker session: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			// NOTE: the rejected message is never redelivered
+			_ = b.Close(ctx)
+		}()
+
+		in, err := simple.NewIngester(ingester.WithTracer(tr))
+		if err != nil {
+			t.Fatalf("failed creating ingester: %v", err)
+		}
+
+		topic := "foo"
+		sub, err := b.Sub(context.Background(), topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to topic %s: %v", topic, err)
+		}
+
+		if err := in.Ingest(context.Background(), b, topic, broker.Object, "foo data"); err != nil {
+			t.Fatalf("failed to ingest data: %v", err)
+		}
+
+		errHandler := errors.New("handler error")
+
+		var cid string
+		h := trace.Handler(tr, "digest", func(ctx context.Context, m broker.Message) error {
+			cid = trace.CorrelationID(ctx)
+			return errHandler
+		})
+
+		if err := sub.Receive(context.Background(), h); !errors.Is(err, errHandler) {
+			t.Fatalf("expected error: %v, got: %v", errHandler, err)
+		}
+
+		spans := tr.Spans()
+		if exp := 2; len(spans) != exp {
+			t.Fatalf("expected spans: %d, got: %d", exp, len(spans))
+		}
+
+		ingest, digest := spans[0], spans[1]
+
+		if digest.Context.TraceID != ingest.Context.TraceID {
+			t.Errorf("expected trace ID: %s, got: %s", ingest.Context.TraceID, digest.Context.TraceID)
+		}
+
+		if digest.ParentID != ingest.Context.SpanID {
+			t.Errorf("expected parent ID: %s, got: %s", ingest.Context.SpanID, digest.ParentID)
+		}
+
+		if uid := ingest.Attrs["message.uid"]; cid != uid {
+			t.Errorf("expected correlation ID: %s, got: %s", uid, cid)
+		}
+
+		if len(digest.Errors) != 1 {
+			t.Errorf("expected recorded errors: 1, got: %d", len(digest.Errors))
+		}
+	})
+}
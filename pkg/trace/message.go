@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+// Inject stamps trace and correlation attributes stored in ctx on msg.
+// Attributes which are already set on msg are left untouched.
+// msg attributes are replaced with their stamped copy.
+func Inject(ctx context.Context, msg *broker.Message) {
+	attrs := make(map[string]string)
+
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		attrs[TraceIDAttr] = sc.TraceID
+		attrs[SpanIDAttr] = sc.SpanID
+	}
+
+	if id := CorrelationID(ctx); id != "" {
+		attrs[CorrelationIDAttr] = id
+	}
+
+	if len(attrs) == 0 {
+		return
+	}
+
+	// NOTE: msg attributes might be shared with other messages
+	// so they are copied rather than modified in place
+	for k, v := range msg.Attrs {
+		attrs[k] = v
+	}
+
+	msg.Attrs = attrs
+}
+
+// Extract returns a copy of ctx which stores trace and correlation
+// attributes of msg. Spans started with the returned context
+// are children of the span which sent msg.
+func Extract(ctx context.Context, msg broker.Message) context.Context {
+	sc := SpanContext{
+		TraceID: msg.Attrs[TraceIDAttr],
+		SpanID:  msg.Attrs[SpanIDAttr],
+	}
+
+	if sc.IsValid() {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+
+	if id := msg.Attrs[CorrelationIDAttr]; id != "" {
+		ctx = ContextWithCorrelationID(ctx, id)
+	}
+
+	return ctx
+}
+
+// Handler returns broker handler which handles messages with h
+// in a span with the given name started by tr. The span continues
+// the trace of the handled message and h receives the span context.
+func Handler(tr Tracer, name string, h broker.Handler) broker.Handler {
+	return func(ctx context.Context, msg broker.Message) error {
+		ctx, span := tr.Start(Extract(ctx, msg), name)
+		defer span.End()
+
+		span.SetAttr("message.uid", msg.UID)
+		span.SetAttr("message.type", msg.Type.String())
+
+		if id := CorrelationID(ctx); id != "" {
+			span.SetAttr(CorrelationIDAttr, id)
+		}
+
+		if err := h(ctx, msg); err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		return nil
+	}
+}
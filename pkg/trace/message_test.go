@@ -0,0 +1,127 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+)
+
+func TestInjectExtract(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	sc := SpanContext{TraceID: "traceID", SpanID: "spanID"}
+	cid := "correlationID"
+
+	ctx := ContextWithSpanContext(context.Background(), sc)
+	ctx = ContextWithCorrelationID(ctx, cid)
+
+	t.Run("Inject", func(t *testing.T) {
+		msg := broker.Message{UID: "fooID"}
+		Inject(ctx, &msg)
+
+		exp := map[string]string{
+			TraceIDAttr:       sc.TraceID,
+			SpanIDAttr:        sc.SpanID,
+			CorrelationIDAttr: cid,
+		}
+
+		for k, v := range exp {
+			if msg.Attrs[k] != v {
+				t.Errorf("attribute %s: expected: %s, got: %s", k, v, msg.Attrs[k])
+			}
+		}
+	})
+
+	t.Run("KeepExisting", func(t *testing.T) {
+		msg := broker.Message{
+			UID:   "fooID",
+			Attrs: map[string]string{CorrelationIDAttr: "barID"},
+		}
+		Inject(ctx, &msg)
+
+		if id := msg.Attrs[CorrelationIDAttr]; id != "barID" {
+			t.Errorf("expected correlation ID: %s, got: %s", "barID", id)
+		}
+	})
+
+	t.Run("SharedAttrs", func(t *testing.T) {
+		attrs := map[string]string{"foo": "bar"}
+		msg := broker.Message{UID: "fooID", Attrs: attrs}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(m broker.Message) {
+				defer wg.Done()
+				Inject(ctx, &m)
+			}(msg)
+		}
+		wg.Wait()
+
+		if len(attrs) != 1 {
+			t.Errorf("expected shared attributes untouched, got: %v", attrs)
+		}
+	})
+
+	t.Run("Extract", func(t *testing.T) {
+		msg := broker.Message{UID: "fooID"}
+		Inject(ctx, &msg)
+
+		ectx := Extract(context.Background(), msg)
+
+		esc, ok := SpanContextFromContext(ectx)
+		if !ok {
+			t.Fatal("expected span context in context")
+		}
+
+		if esc != sc {
+			t.Errorf("expected span context: %#v, got: %#v", sc, esc)
+		}
+
+		if id := CorrelationID(ectx); id != cid {
+			t.Errorf("expected correlation ID: %s, got: %s", cid, id)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		msg := broker.Message{UID: "fooID"}
+		Inject(context.Background(), &msg)
+
+		if msg.Attrs != nil {
+			t.Errorf("expected no attributes, got: %v", msg.Attrs)
+		}
+
+		if _, ok := SpanContextFromContext(Extract(context.Background(), msg)); ok {
+			t.Errorf("expected no span context")
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	errHandler := errors.New("handler error")
+
+	msg := broker.Message{
+		UID:   "fooID",
+		Attrs: map[string]string{CorrelationIDAttr: "barID"},
+	}
+
+	h := Handler(Noop{}, "test", func(ctx context.Context, m broker.Message) error {
+		if id := CorrelationID(ctx); id != "barID" {
+			t.Errorf("expected correlation ID: %s, got: %s", "barID", id)
+		}
+		return errHandler
+	})
+
+	if err := h(context.Background(), msg); !errors.Is(err, errHandler) {
+		t.Errorf("expected error: %v, got: %v", errHandler, err)
+	}
+}
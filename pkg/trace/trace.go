@@ -0,0 +1,68 @@
+package trace
+
+import "context"
+
+const (
+	// TraceIDAttr is message attribute which stores trace ID.
+	TraceIDAttr = "trace-id"
+	// SpanIDAttr is message attribute which stores ID of the span which sent the message.
+	SpanIDAttr = "span-id"
+	// CorrelationIDAttr is message attribute which stores correlation ID.
+	CorrelationIDAttr = "correlation-id"
+)
+
+// SpanContext identifies span within a trace.
+// IDs are hex encoded following W3C Trace Context,
+// which makes them compatible with OpenTelemetry.
+type SpanContext struct {
+	// TraceID is trace ID.
+	TraceID string
+	// SpanID is span ID.
+	SpanID string
+}
+
+// IsValid returns true if both trace and span ID are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// Tracer creates spans.
+// OpenTelemetry tracers can be plugged in via a thin adapter.
+type Tracer interface {
+	// Start starts a new span with the given name.
+	// The span is a child of the span stored in ctx, if any.
+	// It returns ctx which stores the new span context.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// SpanContext returns span context.
+	SpanContext() SpanContext
+	// SetAttr sets span attribute.
+	SetAttr(key, val string)
+	// RecordError records err.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// Noop is a tracer which records nothing.
+// It propagates span context stored in ctx.
+type Noop struct{}
+
+// Start implements Tracer.
+func (Noop) Start(ctx context.Context, name string) (context.Context, Span) {
+	sc, _ := SpanContextFromContext(ctx)
+	return ctx, noopSpan{sc: sc}
+}
+
+// noopSpan is a span which records nothing.
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext { return s.sc }
+func (noopSpan) SetAttr(key, val string)    {}
+func (noopSpan) RecordError(err error)      {}
+func (noopSpan) End()                       {}
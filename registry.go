@@ -0,0 +1,396 @@
+package netscrape
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+)
+
+// Capability is a scraper capability.
+type Capability string
+
+const (
+	// CapWatch capability is provided by scrapers which implement Watcher.
+	CapWatch Capability = "watch"
+	// CapDiscovery capability is provided by scrapers which implement plan.Discoverer.
+	CapDiscovery Capability = "discovery"
+)
+
+// FieldType is scraper config field type.
+type FieldType string
+
+const (
+	// FieldString is string field.
+	FieldString FieldType = "string"
+	// FieldInt is int field.
+	FieldInt FieldType = "int"
+	// FieldFloat is float64 field.
+	FieldFloat FieldType = "float"
+	// FieldBool is bool field.
+	FieldBool FieldType = "bool"
+	// FieldDuration is time.Duration field given as string parsed by time.ParseDuration.
+	FieldDuration FieldType = "duration"
+	// FieldStringList is []string field.
+	FieldStringList FieldType = "[]string"
+)
+
+// Field is scraper config field.
+type Field struct {
+	Name        string
+	Type        FieldType
+	Description string
+	Required    bool
+	// Default is the value of the field if it's not set.
+	// It must be of the field Go type.
+	Default interface{}
+}
+
+// Schema is scraper config schema.
+type Schema struct {
+	Fields []Field
+}
+
+// Config is scraper config.
+// Values of validated config are of the Go types of their fields:
+// string, int, float64, bool, time.Duration and []string.
+type Config map[string]interface{}
+
+// Factory creates a new scraper from validated config and returns it.
+type Factory func(Config) (Scraper, error)
+
+// Registration registers scraper.
+type Registration struct {
+	Name        string
+	Description string
+	Schema      Schema
+	Factory     Factory
+	// Capabilities are capabilities of scrapers created by Factory.
+	Capabilities []Capability
+	// Scraper is a value of the type of scrapers created by Factory, e.g.
+	// (*Foo)(nil). It's required if Capabilities are set and it's used to
+	// verify scrapers created by Factory provide the declared capabilities.
+	Scraper Scraper
+}
+
+// ScraperInfo describes registered scraper.
+type ScraperInfo struct {
+	Name         string
+	Description  string
+	Schema       Schema
+	Capabilities []Capability
+}
+
+// Registry is a registry of scrapers.
+type Registry struct {
+	mu       sync.RWMutex
+	scrapers map[string]Registration
+}
+
+// NewRegistry creates a new empty registry and returns it.
+func NewRegistry() *Registry {
+	return &Registry{
+		scrapers: make(map[string]Registration),
+	}
+}
+
+// DefaultRegistry is the default scraper registry.
+var DefaultRegistry = NewRegistry()
+
+// Register registers scraper in DefaultRegistry.
+func Register(reg Registration) error {
+	return DefaultRegistry.Register(reg)
+}
+
+// MustRegister registers scraper in DefaultRegistry.
+// It panics if the scraper can't be registered.
+// It's meant to be called from scraper package init functions.
+func MustRegister(reg Registration) {
+	if err := Register(reg); err != nil {
+		panic(err)
+	}
+}
+
+// Register registers scraper.
+// Scraper names must be unique.
+func (r *Registry) Register(reg Registration) error {
+	if reg.Name == "" || reg.Factory == nil {
+		return fmt.Errorf("%w: scraper %q: missing name or factory", ErrInvalidRegistration, reg.Name)
+	}
+
+	for _, f := range reg.Schema.Fields {
+		if f.Default == nil {
+			continue
+		}
+		if _, err := convert(f, f.Default); err != nil {
+			return fmt.Errorf("%w: scraper %s: field %s: invalid default: %v", ErrInvalidRegistration, reg.Name, f.Name, err)
+		}
+	}
+
+	if len(reg.Capabilities) > 0 && reg.Scraper == nil {
+		return fmt.Errorf("%w: scraper %s: missing scraper type of capabilities", ErrInvalidRegistration, reg.Name)
+	}
+
+	if err := provides(reg.Scraper, reg.Capabilities); err != nil {
+		return fmt.Errorf("%w: scraper %s: %v", ErrInvalidRegistration, reg.Name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.scrapers[reg.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateScraper, reg.Name)
+	}
+
+	r.scrapers[reg.Name] = reg
+
+	return nil
+}
+
+// List returns registered scrapers sorted by name.
+func (r *Registry) List() []ScraperInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]ScraperInfo, 0, len(r.scrapers))
+	for _, reg := range r.scrapers {
+		infos = append(infos, ScraperInfo{
+			Name:         reg.Name,
+			Description:  reg.Description,
+			Schema:       reg.Schema,
+			Capabilities: reg.Capabilities,
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// New creates a new scraper registered with the given name from options.
+// Options are validated against the scraper config schema.
+// It returns ErrInvalidRegistration if the factory returns nil scraper
+// or if the created scraper does not provide the capabilities it's registered with.
+func (r *Registry) New(name string, opts map[string]interface{}) (Scraper, error) {
+	r.mu.RLock()
+	reg, ok := r.scrapers[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrScraperNotFound, name)
+	}
+
+	config, err := reg.Schema.Validate(opts)
+	if err != nil {
+		return nil, fmt.Errorf("scraper %s: %w", name, err)
+	}
+
+	s, err := reg.Factory(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		return nil, fmt.Errorf("%w: scraper %s: factory returned nil scraper", ErrInvalidRegistration, name)
+	}
+
+	if err := provides(s, reg.Capabilities); err != nil {
+		return nil, fmt.Errorf("%w: scraper %s: %v", ErrInvalidRegistration, name, err)
+	}
+
+	return s, nil
+}
+
+// provides returns error if scraper s does not provide all capabilities cx.
+func provides(s Scraper, cx []Capability) error {
+	for _, c := range cx {
+		var ok bool
+		switch c {
+		case CapWatch:
+			_, ok = s.(Watcher)
+		case CapDiscovery:
+			_, ok = s.(plan.Discoverer)
+		default:
+			return fmt.Errorf("unknown capability %s", c)
+		}
+
+		if !ok {
+			return fmt.Errorf("capability %s not implemented by %T", c, s)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates opts against schema and returns scraper config.
+// Unknown options are rejected and missing options are set to their defaults.
+func (s Schema) Validate(opts map[string]interface{}) (Config, error) {
+	fields := make(map[string]Field, len(s.Fields))
+	for _, f := range s.Fields {
+		fields[f.Name] = f
+	}
+
+	for k := range opts {
+		if _, ok := fields[k]; !ok {
+			return nil, fmt.Errorf("%w: unknown option %s", ErrInvalidConfig, k)
+		}
+	}
+
+	config := make(Config, len(s.Fields))
+	for _, f := range s.Fields {
+		v, ok := opts[f.Name]
+		if !ok || v == nil {
+			if f.Required {
+				return nil, fmt.Errorf("%w: missing option %s", ErrInvalidConfig, f.Name)
+			}
+			if f.Default == nil {
+				continue
+			}
+			v = f.Default
+		}
+
+		val, err := convert(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: option %s: %v", ErrInvalidConfig, f.Name, err)
+		}
+		config[f.Name] = val
+	}
+
+	return config, nil
+}
+
+// convert converts v to the Go type of field f.
+// Numbers decoded from config documents are float64.
+func convert(f Field, v interface{}) (interface{}, error) {
+	switch f.Type {
+	case FieldString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case FieldInt:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) {
+				return int(n), nil
+			}
+		}
+	case FieldFloat:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		}
+	case FieldBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case FieldDuration:
+		switch d := v.(type) {
+		case time.Duration:
+			return d, nil
+		case string:
+			return time.ParseDuration(d)
+		}
+	case FieldStringList:
+		switch l := v.(type) {
+		case []string:
+			return l, nil
+		case []interface{}:
+			res := make([]string, len(l))
+			for i, x := range l {
+				s, ok := x.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected %s, got element: %T", f.Type, x)
+				}
+				res[i] = s
+			}
+			return res, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %s", f.Type)
+	}
+
+	return nil, fmt.Errorf("expected %s, got: %T", f.Type, v)
+}
+
+// ScraperConfig configures a scraper in scrapers config document.
+type ScraperConfig struct {
+	// Name is the name of registered scraper.
+	Name string `json:"name"`
+	// Source is the name of the federated source.
+	// It defaults to the scraper name.
+	Source string `json:"source,omitempty"`
+	// Options are scraper config options.
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// ScrapersConfig is scrapers config document.
+type ScrapersConfig struct {
+	Scrapers []ScraperConfig `json:"scrapers"`
+	// Identities are identity rules of federated scrapers.
+	Identities []IdentityConfig `json:"identities,omitempty"`
+}
+
+// IdentityConfig configures identity rule.
+type IdentityConfig struct {
+	Attrs []string `json:"attrs"`
+	// Merge merges matching entities instead of linking them.
+	Merge bool `json:"merge,omitempty"`
+}
+
+// ParseConfig parses YAML or JSON encoded scrapers config document.
+func ParseConfig(data []byte) (*ScrapersConfig, error) {
+	c := &ScrapersConfig{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if len(c.Scrapers) == 0 {
+		return nil, fmt.Errorf("%w: no scrapers", ErrInvalidConfig)
+	}
+
+	return c, nil
+}
+
+// Build builds scraper from config c using scrapers registered in r.
+// If c configures a single scraper it's returned as is, otherwise
+// the scrapers are federated using the configured identity rules.
+func (r *Registry) Build(c *ScrapersConfig) (Scraper, error) {
+	sources := make([]Source, len(c.Scrapers))
+	for i, sc := range c.Scrapers {
+		s, err := r.New(sc.Name, sc.Options)
+		if err != nil {
+			return nil, err
+		}
+
+		name := sc.Source
+		if name == "" {
+			name = sc.Name
+		}
+
+		sources[i] = Source{Name: name, Scraper: s}
+	}
+
+	if len(sources) == 1 && len(c.Identities) == 0 {
+		return sources[0].Scraper, nil
+	}
+
+	rules := make([]IdentityRule, len(c.Identities))
+	for i, ic := range c.Identities {
+		rules[i] = IdentityRule{Attrs: ic.Attrs}
+		if ic.Merge {
+			rules[i].Action = MergeIdentities
+		}
+	}
+
+	return NewFederation(sources, rules...)
+}
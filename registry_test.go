@@ -0,0 +1,317 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func MustRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+
+	reg := Registration{
+		Name: "test",
+		Schema: Schema{
+			Fields: []Field{
+				{Name: "fail", Type: FieldString, Required: true},
+				{Name: "timeout", Type: FieldDuration, Default: "1s"},
+				{Name: "retries", Type: FieldInt},
+				{Name: "kinds", Type: FieldStringList},
+			},
+		},
+		Factory: func(c Config) (Scraper, error) {
+			return &testScraper{fail: c["fail"].(string)}, nil
+		},
+	}
+
+	if err := r.Register(reg); err != nil {
+		t.Fatalf("failed to register scraper: %v", err)
+	}
+
+	reg = Registration{
+		Name:         "watcher",
+		Factory:      func(Config) (Scraper, error) { return &testWatcher{}, nil },
+		Capabilities: []Capability{CapWatch},
+		Scraper:      (*testWatcher)(nil),
+	}
+
+	if err := r.Register(reg); err != nil {
+		t.Fatalf("failed to register scraper: %v", err)
+	}
+
+	return r
+}
+
+func TestRegistry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("List", func(t *testing.T) {
+		r := MustRegistry(t)
+
+		infos := r.List()
+		if len(infos) != 2 {
+			t.Fatalf("expected scrapers: %d, got: %d", 2, len(infos))
+		}
+
+		if infos[0].Name != "test" || infos[1].Name != "watcher" {
+			t.Errorf("unexpected scrapers: %s, %s", infos[0].Name, infos[1].Name)
+		}
+
+		if exp := []Capability{CapWatch}; !reflect.DeepEqual(infos[1].Capabilities, exp) {
+			t.Errorf("expected capabilities: %v, got: %v", exp, infos[1].Capabilities)
+		}
+	})
+
+	t.Run("Register", func(t *testing.T) {
+		r := MustRegistry(t)
+
+		reg := Registration{
+			Name:    "test",
+			Factory: func(Config) (Scraper, error) { return &testScraper{}, nil },
+		}
+
+		if err := r.Register(reg); !errors.Is(err, ErrDuplicateScraper) {
+			t.Errorf("expected error: %v, got: %v", ErrDuplicateScraper, err)
+		}
+
+		if err := r.Register(Registration{Name: "foo"}); !errors.Is(err, ErrInvalidRegistration) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidRegistration, err)
+		}
+
+		reg = Registration{
+			Name:    "foo",
+			Schema:  Schema{Fields: []Field{{Name: "n", Type: FieldInt, Default: "one"}}},
+			Factory: func(Config) (Scraper, error) { return &testScraper{}, nil },
+		}
+
+		if err := r.Register(reg); !errors.Is(err, ErrInvalidRegistration) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidRegistration, err)
+		}
+	})
+
+	t.Run("New", func(t *testing.T) {
+		r := MustRegistry(t)
+
+		s, err := r.New("test", map[string]interface{}{"fail": "Bar"})
+		if err != nil {
+			t.Fatalf("failed to create scraper: %v", err)
+		}
+
+		if ts, ok := s.(*testScraper); !ok || ts.fail != "Bar" {
+			t.Errorf("unexpected scraper: %#v", s)
+		}
+
+		if _, err := r.New("foo", nil); !errors.Is(err, ErrScraperNotFound) {
+			t.Errorf("expected error: %v, got: %v", ErrScraperNotFound, err)
+		}
+
+		invalid := []map[string]interface{}{
+			nil,
+			{"fail": 1.0},
+			{"fail": "Bar", "unknown": true},
+			{"fail": "Bar", "retries": 1.5},
+			{"fail": "Bar", "timeout": "forever"},
+			{"fail": "Bar", "kinds": []interface{}{"Foo", 1.0}},
+		}
+
+		for _, opts := range invalid {
+			if _, err := r.New("test", opts); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("options %v: expected error: %v, got: %v", opts, ErrInvalidConfig, err)
+			}
+		}
+	})
+
+	t.Run("Capabilities", func(t *testing.T) {
+		r := MustRegistry(t)
+
+		invalid := []Registration{
+			{
+				Name:         "foo",
+				Factory:      func(Config) (Scraper, error) { return &testWatcher{}, nil },
+				Capabilities: []Capability{CapWatch},
+			},
+			{
+				Name:         "foo",
+				Factory:      func(Config) (Scraper, error) { return &testScraper{}, nil },
+				Capabilities: []Capability{CapWatch},
+				Scraper:      (*testScraper)(nil),
+			},
+			{
+				Name:         "foo",
+				Factory:      func(Config) (Scraper, error) { return &testWatcher{}, nil },
+				Capabilities: []Capability{CapDiscovery},
+				Scraper:      (*testWatcher)(nil),
+			},
+		}
+
+		for _, reg := range invalid {
+			if err := r.Register(reg); !errors.Is(err, ErrInvalidRegistration) {
+				t.Errorf("capabilities %v of %T: expected error: %v, got: %v", reg.Capabilities, reg.Scraper, ErrInvalidRegistration, err)
+			}
+		}
+
+		reg := Registration{
+			Name:         "foo",
+			Factory:      func(Config) (Scraper, error) { return &testScraper{}, nil },
+			Capabilities: []Capability{CapWatch},
+			Scraper:      (*testWatcher)(nil),
+		}
+
+		if err := r.Register(reg); err != nil {
+			t.Fatalf("failed to register scraper: %v", err)
+		}
+
+		if _, err := r.New("foo", nil); !errors.Is(err, ErrInvalidRegistration) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidRegistration, err)
+		}
+	})
+
+	t.Run("NilScraper", func(t *testing.T) {
+		r := MustRegistry(t)
+
+		reg := Registration{
+			Name:    "foo",
+			Factory: func(Config) (Scraper, error) { return nil, nil },
+		}
+
+		if err := r.Register(reg); err != nil {
+			t.Fatalf("failed to register scraper: %v", err)
+		}
+
+		if _, err := r.New("foo", nil); !errors.Is(err, ErrInvalidRegistration) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidRegistration, err)
+		}
+	})
+}
+
+func TestSchemaValidate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	schema := Schema{
+		Fields: []Field{
+			{Name: "name", Type: FieldString},
+			{Name: "timeout", Type: FieldDuration, Default: "1s"},
+			{Name: "retries", Type: FieldInt},
+			{Name: "rate", Type: FieldFloat},
+			{Name: "watch", Type: FieldBool},
+			{Name: "kinds", Type: FieldStringList},
+		},
+	}
+
+	opts := map[string]interface{}{
+		"name":    "foo",
+		"retries": 3.0,
+		"rate":    2,
+		"watch":   true,
+		"kinds":   []interface{}{"Foo", "Bar"},
+	}
+
+	c, err := schema.Validate(opts)
+	if err != nil {
+		t.Fatalf("failed to validate options: %v", err)
+	}
+
+	exp := Config{
+		"name":    "foo",
+		"timeout": time.Second,
+		"retries": 3,
+		"rate":    2.0,
+		"watch":   true,
+		"kinds":   []string{"Foo", "Bar"},
+	}
+
+	if !reflect.DeepEqual(c, exp) {
+		t.Errorf("expected config: %v, got: %v", exp, c)
+	}
+
+	_, err = schema.Validate(map[string]interface{}{"kinds": []interface{}{"Foo", 1.0}})
+	if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), "float64") {
+		t.Errorf("expected error: %v of element type float64, got: %v", ErrInvalidConfig, err)
+	}
+}
+
+func TestRunnerScraper(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	r, err := NewRunner(WithRegistry(MustRegistry(t)))
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+
+	t.Run("Scrapers", func(t *testing.T) {
+		if infos := r.Scrapers(); len(infos) != 2 {
+			t.Errorf("expected scrapers: %d, got: %d", 2, len(infos))
+		}
+	})
+
+	t.Run("Single", func(t *testing.T) {
+		doc := []byte(`
+scrapers:
+- name: test
+  options:
+    fail: Bar
+    timeout: 5s
+`)
+
+		s, err := r.Scraper(doc)
+		if err != nil {
+			t.Fatalf("failed to build scraper: %v", err)
+		}
+
+		res, err := r.Run(context.Background(), MustPlan(t, "Foo", "Bar"), s)
+		if err != nil {
+			t.Fatalf("failed to run scraper: %v", err)
+		}
+
+		if f := res.Totals.Failed; f != 1 {
+			t.Errorf("expected failed: %d, got: %d", 1, f)
+		}
+	})
+
+	t.Run("Federation", func(t *testing.T) {
+		doc := []byte(`{
+  "scrapers": [
+    {"name": "test", "source": "a", "options": {"fail": "Bar"}},
+    {"name": "test", "source": "b", "options": {"fail": "Foo"}}
+  ],
+  "identities": [{"attrs": ["name"], "merge": true}]
+}`)
+
+		s, err := r.Scraper(doc)
+		if err != nil {
+			t.Fatalf("failed to build scraper: %v", err)
+		}
+
+		if _, ok := s.(*Federation); !ok {
+			t.Errorf("expected federation, got: %T", s)
+		}
+	})
+
+	t.Run("ErrInvalidConfig", func(t *testing.T) {
+		docs := [][]byte{
+			[]byte(`scrapers: []`),
+			[]byte(`scrapers: {`),
+		}
+
+		for _, doc := range docs {
+			if _, err := r.Scraper(doc); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected error: %v, got: %v", ErrInvalidConfig, err)
+			}
+		}
+	})
+
+	t.Run("ErrScraperNotFound", func(t *testing.T) {
+		if _, err := r.Scraper([]byte(`scrapers: [{name: foo}]`)); !errors.Is(err, ErrScraperNotFound) {
+			t.Errorf("expected error: %v, got: %v", ErrScraperNotFound, err)
+		}
+	})
+}
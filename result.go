@@ -0,0 +1,123 @@
+package netscrape
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+)
+
+// ResourceState is the scrape state of plan resource.
+type ResourceState string
+
+const (
+	// Pending is the state of plan resource which has not been scraped.
+	Pending ResourceState = "pending"
+	// Finished is the state of successfully scraped plan resource.
+	Finished ResourceState = "finished"
+	// Failed is the state of plan resource which failed to be scraped.
+	Failed ResourceState = "failed"
+	// Skipped is the state of plan resource skipped
+	// because it was scraped by a previous run.
+	Skipped ResourceState = "skipped"
+)
+
+// ResourceError is an error of scraping plan resource.
+type ResourceError struct {
+	Resource plan.Resource
+	Err      error
+}
+
+// Error implements error interface.
+func (e *ResourceError) Error() string {
+	r := e.Resource
+	return fmt.Sprintf("resource %s/%s/%s (%s): %v", r.Group(), r.Version(), r.Kind(), r.UID(), e.Err)
+}
+
+// Unwrap returns the resource error.
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+// ScrapeError is returned when scraping of some plan resources failed.
+type ScrapeError struct {
+	Errors []*ResourceError
+}
+
+// Error implements error interface.
+func (e *ScrapeError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d resources failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Is returns true if any of the resource errors matches target.
+func (e *ScrapeError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceResult is the result of scraping plan resource.
+type ResourceResult struct {
+	Resource plan.Resource
+	State    ResourceState
+	// Entities is the number of scraped entities.
+	Entities int
+	// Links is the number of scraped links.
+	Links int
+	// Duration is the duration of the resource scrape.
+	Duration time.Duration
+	// Err is set for failed resources.
+	Err *ResourceError
+	// start is the time the resource scrape started.
+	start time.Time
+}
+
+// Result is scrape result.
+type Result struct {
+	// ScrapeID identifies the scrape.
+	ScrapeID string
+	// Start is the time the scrape started.
+	Start time.Time
+	// Duration is the duration of the scrape.
+	Duration time.Duration
+	// Totals are scrape totals.
+	Totals Totals
+	// Resources are results of plan resources in plan order.
+	Resources []ResourceResult
+}
+
+// Failed returns results of plan resources which failed to be scraped.
+func (r *Result) Failed() []ResourceResult {
+	var failed []ResourceResult
+	for _, res := range r.Resources {
+		if res.State == Failed {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Err returns *ScrapeError which aggregates errors of failed
+// plan resources or nil if no plan resource failed.
+func (r *Result) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	errs := make([]*ResourceError, len(failed))
+	for i, res := range failed {
+		errs[i] = res.Err
+	}
+
+	return &ScrapeError{Errors: errs}
+}
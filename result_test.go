@@ -0,0 +1,147 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	t.Run("Partial", func(t *testing.T) {
+		r, err := NewRunner()
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		res, err := r.Run(context.Background(), MustPlan(t, "foo", "bar", "baz"), &testScraper{fail: "bar"})
+		if err != nil {
+			t.Fatalf("failed running scrape: %v", err)
+		}
+
+		if len(res.Resources) != 3 {
+			t.Fatalf("expected resources: %d, got: %d", 3, len(res.Resources))
+		}
+
+		for _, rr := range res.Resources {
+			state, entities := Finished, 1
+			if rr.Resource.Kind() == "bar" {
+				state, entities = Failed, 0
+			}
+
+			if rr.State != state || rr.Entities != entities {
+				t.Errorf("%s: expected state: %s, entities: %d, got: %s, %d", rr.Resource.Kind(), state, entities, rr.State, rr.Entities)
+			}
+		}
+
+		failed := res.Failed()
+		if len(failed) != 1 || failed[0].Resource.Kind() != "bar" {
+			t.Fatalf("expected failed resource: %s, got: %v", "bar", failed)
+		}
+
+		rerr := res.Err()
+
+		var scrapeErr *ScrapeError
+		if !errors.As(rerr, &scrapeErr) || len(scrapeErr.Errors) != 1 {
+			t.Fatalf("expected scrape error, got: %v", rerr)
+		}
+
+		if !errors.Is(rerr, errScrape) {
+			t.Errorf("expected error: %v, got: %v", errScrape, rerr)
+		}
+
+		var resErr *ResourceError
+		if !errors.As(scrapeErr.Errors[0], &resErr) || resErr.Resource.Kind() != "bar" {
+			t.Errorf("expected resource error, got: %v", scrapeErr.Errors[0])
+		}
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		r, err := NewRunner()
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		res, err := r.Run(context.Background(), MustPlan(t, "foo"), &testScraper{})
+		if err != nil {
+			t.Fatalf("failed running scrape: %v", err)
+		}
+
+		if err := res.Err(); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("FailFast", func(t *testing.T) {
+		r, err := NewRunner(WithFailFast())
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		kinds := []string{"foo", "bar", "baz", "qux"}
+		s := &testScraper{fail: "bar"}
+
+		res, err := r.Run(context.Background(), MustPlan(t, kinds...), s)
+
+		var resErr *ResourceError
+		if !errors.As(err, &resErr) || !errors.Is(err, errScrape) || resErr.Resource.Kind() != "bar" {
+			t.Fatalf("expected resource error: %v, got: %v", errScrape, err)
+		}
+
+		if last := s.scraped[len(s.scraped)-1]; last != "bar" {
+			t.Errorf("expected scrape to stop at %s, got: %v", "bar", s.scraped)
+		}
+
+		pending := 0
+		for _, rr := range res.Resources {
+			if rr.State == Pending {
+				pending++
+			}
+		}
+
+		if exp := len(kinds) - len(s.scraped); pending != exp {
+			t.Errorf("expected pending: %d, got: %d", exp, pending)
+		}
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		rx, err := MustPlan(t, "foo").GetAll(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get plan resources: %v", err)
+		}
+		r := rx[0]
+
+		e := NewEvents(nil, "")
+		if err := e.Started(context.Background(), rx); err != nil {
+			t.Fatalf("failed starting scrape: %v", err)
+		}
+
+		if err := e.ResourceFailed(context.Background(), r, errScrape); err != nil {
+			t.Fatalf("failed recording failure: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := e.ResourceFinished(context.Background(), r); err != nil {
+				t.Fatalf("failed recording finish: %v", err)
+			}
+		}
+
+		res := e.Result()
+
+		totals := Totals{Resources: 1, Finished: 1}
+		if res.Totals != totals {
+			t.Errorf("expected totals: %v, got: %v", totals, res.Totals)
+		}
+
+		if rr := res.Resources[0]; rr.State != Finished || rr.Err != nil {
+			t.Errorf("expected state: %s, got: %s, err: %v", Finished, rr.State, rr.Err)
+		}
+
+		if err := res.Err(); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	})
+}
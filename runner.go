@@ -2,13 +2,41 @@ package netscrape
 
 import (
 	"context"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/milosgajdos/netscrape/pkg/plan"
 )
 
+// DefaultHistory is the default max number of runs kept in run history.
+const DefaultHistory = 100
+
+// RunRecord is a record of a single run.
+type RunRecord struct {
+	// ScrapeID identifies the run scrape.
+	// It's empty for skipped runs.
+	ScrapeID string
+	// Start is the time the run started.
+	Start time.Time
+	// Duration is the duration of the run.
+	Duration time.Duration
+	// Totals are the run scrape totals.
+	Totals Totals
+	// Err is the run error.
+	Err error
+}
+
 // Runner runs netscraping.
 type Runner struct {
 	opts Options
+	// busy holds a token while a run is in progress.
+	busy chan struct{}
+	// mu synchronizes access to history.
+	mu      sync.RWMutex
+	history []RunRecord
+	// clock tells time to scheduled runs.
+	clock clock
 }
 
 // NewRunner creates a new Runner and returns it.
@@ -19,16 +47,297 @@ func NewRunner(opts ...Option) (*Runner, error) {
 	}
 
 	return &Runner{
-		opts: ropts,
+		opts:  ropts,
+		busy:  make(chan struct{}, 1),
+		clock: systemClock{},
 	}, nil
 }
 
-// Run runs netscraping using scraper s.
-func (r *Runner) Run(ctx context.Context, p plan.Plan, s Scraper, opts ...Option) error {
-	sopts := Options{}
+// options returns runner options overridden by opts.
+func (r *Runner) options(opts ...Option) Options {
+	ropts := r.opts
 	for _, apply := range opts {
-		apply(&sopts)
+		apply(&ropts)
+	}
+
+	return ropts
+}
+
+// registry returns runner scraper registry.
+func (r *Runner) registry() *Registry {
+	if r.opts.Registry != nil {
+		return r.opts.Registry
+	}
+	return DefaultRegistry
+}
+
+// Scrapers returns scrapers registered in runner registry,
+// or in DefaultRegistry if Registry option is not set.
+func (r *Runner) Scrapers() []ScraperInfo {
+	return r.registry().List()
+}
+
+// Scraper builds scraper from YAML or JSON encoded scrapers config document
+// using runner registry, or DefaultRegistry if Registry option is not set.
+// Documents which configure several scrapers are built into Federation.
+func (r *Runner) Scraper(doc []byte) (Scraper, error) {
+	c, err := ParseConfig(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.registry().Build(c)
+}
+
+// History returns run history ordered from the oldest to the most recent run.
+func (r *Runner) History() []RunRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := make([]RunRecord, len(r.history))
+	copy(history, r.history)
+
+	return history
+}
+
+// record records rec in run history.
+func (r *Runner) record(rec RunRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	size := r.opts.History
+	if size <= 0 {
+		size = DefaultHistory
+	}
+
+	r.history = append(r.history, rec)
+	if len(r.history) > size {
+		r.history = append([]RunRecord{}, r.history[len(r.history)-size:]...)
+	}
+}
+
+// Run runs netscraping using scraper s.
+// If broker is configured, scrape lifecycle events are published
+// on ControlTopic, or on DefaultControlTopic if it's not set.
+// Runs never overlap: Run waits for the run in progress to finish.
+// If Timeout option is set the run is canceled once it times out.
+// Scrapers get Limiter which enforces Limits option both via options
+// and via context.
+// If Checkpoint option is set, the state of every plan resource is recorded
+// in the checkpoint file and resources which were scraped successfully by
+// previous runs are skipped. The checkpoint is removed once all plan
+// resources, including the ones not selected by Selector option,
+// have been scraped successfully.
+// If Selector option is set, only selected plan resources are scraped.
+// Run returns the scrape result which reports the state of every plan resource.
+// Failures of individual plan resources don't fail the run and are reported
+// by the result, unless FailFast option is set, in which case the run is
+// canceled once any plan resource fails and its *ResourceError is returned.
+func (r *Runner) Run(ctx context.Context, p plan.Plan, s Scraper, opts ...Option) (*Result, error) {
+	ropts := r.options(opts...)
+
+	if p == nil {
+		return nil, ErrMissingPlan
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r.busy <- struct{}{}:
+	}
+	defer func() { <-r.busy }()
+
+	return r.run(ctx, p, s, ropts)
+}
+
+// run runs scraper s and records the run in run history.
+func (r *Runner) run(ctx context.Context, p plan.Plan, s Scraper, opts Options) (res *Result, err error) {
+	// NOTE: events are published with parent context so they
+	// are published even when the run is canceled or times out
+	pctx := ctx
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.Timeout > 0 {
+		var tcancel context.CancelFunc
+		ctx, tcancel = context.WithTimeout(ctx, opts.Timeout)
+		defer tcancel()
+	}
+
+	events := NewEvents(opts.Broker, opts.ControlTopic)
+
+	var (
+		mu      sync.Mutex
+		failure *ResourceError
+	)
+
+	if opts.FailFast {
+		events.failed = func(rerr *ResourceError) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failure == nil {
+				failure = rerr
+				cancel()
+			}
+		}
+	}
+
+	// NOTE: checkpoint is removed only once all resources
+	// of the unfiltered plan have been scraped successfully
+	full := p
+
+	if opts.Selector != nil {
+		p = plan.Filter(p, opts.Selector)
+	}
+
+	defer func() {
+		res = events.Result()
+		r.record(RunRecord{
+			ScrapeID: res.ScrapeID,
+			Start:    res.Start,
+			Duration: res.Duration,
+			Totals:   res.Totals,
+			Err:      err,
+		})
+	}()
+
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := events.Started(pctx, rx); err != nil {
+		return nil, err
+	}
+
+	var checkpoint *Checkpoint
+	if opts.Checkpoint != "" {
+		checkpoint, err = LoadCheckpoint(opts.Checkpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range rx {
+			if checkpoint.Done(r.UID()) {
+				events.skip(r)
+			}
+		}
+
+		events.checkpoint = checkpoint
+		p = &resumePlan{Plan: p, checkpoint: checkpoint}
+	}
+
+	defer func() {
+		if err == nil && checkpoint != nil {
+			err = removeDone(pctx, checkpoint, full)
+		}
+
+		if cerr := events.Completed(pctx, err); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	limiter := NewLimiter(opts.Limits)
+	ctx = ContextWithLimiter(ctx, limiter)
+
+	err = s.Scrape(ctx, p,
+		WithBroker(opts.Broker),
+		WithStore(opts.Store),
+		WithEvents(events),
+		WithLimiter(limiter),
+	)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if failure != nil {
+		return nil, failure
+	}
+
+	return nil, err
+}
+
+// removeDone removes checkpoint c if all resources of plan p have been scraped successfully.
+func removeDone(ctx context.Context, c *Checkpoint, p plan.Plan) error {
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return err
 	}
 
-	return s.Scrape(ctx, p, WithBroker(sopts.Broker))
+	for _, r := range rx {
+		if !c.Done(r.UID()) {
+			return nil
+		}
+	}
+
+	return c.Remove()
+}
+
+// Schedule runs scraper s following schedule sched until ctx is done.
+// Every run is delayed by random jitter of up to Jitter option and bounded
+// by Timeout option. The next run is scheduled once the previous one has
+// finished, and runs never overlap: if another run is in progress when
+// the scheduled run is due, it's skipped and recorded with ErrRunInProgress.
+// Run errors are recorded in run history and don't stop the schedule.
+// Stopping the schedule doesn't cancel the run in progress: Schedule
+// returns once the run has finished or timed out.
+func (r *Runner) Schedule(ctx context.Context, p plan.Plan, s Scraper, sched Schedule, opts ...Option) error {
+	ropts := r.options(opts...)
+
+	if p == nil {
+		return ErrMissingPlan
+	}
+
+	if sched == nil {
+		return ErrInvalidSchedule
+	}
+
+	for {
+		next := sched.Next(r.clock.Now())
+		if next.IsZero() {
+			return nil
+		}
+
+		if ropts.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(ropts.Jitter))))
+		}
+
+		due, stop := r.clock.After(next.Sub(r.clock.Now()))
+		select {
+		case <-ctx.Done():
+			stop()
+			return nil
+		case <-due:
+		}
+
+		select {
+		case r.busy <- struct{}{}:
+			_, _ = r.run(detached{ctx}, p, s, ropts)
+			<-r.busy
+		default:
+			r.record(RunRecord{Start: r.clock.Now(), Err: ErrRunInProgress})
+		}
+	}
+}
+
+// detached is context which carries the values of its parent
+// but is neither canceled nor timed out with it.
+type detached struct {
+	context.Context
+}
+
+// Deadline implements context.Context.
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements context.Context.
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+// Err implements context.Context.
+func (detached) Err() error {
+	return nil
 }
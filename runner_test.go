@@ -0,0 +1,413 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/broker"
+	"github.com/milosgajdos/netscrape/pkg/broker/memory"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/plan/simple"
+	"github.com/milosgajdos/netscrape/pkg/space/entity"
+)
+
+var errScrape = errors.New("scrape error")
+
+// testScraper scrapes plan resources failing on resources of kind fail.
+type testScraper struct {
+	fail string
+	// scraped are kinds of scraped resources.
+	scraped []string
+}
+
+func (s *testScraper) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	sopts := Options{}
+	for _, apply := range opts {
+		apply(&sopts)
+	}
+
+	rx, err := p.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rx {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		s.scraped = append(s.scraped, r.Kind())
+
+		if err := sopts.Events.ResourceStarted(ctx, r); err != nil {
+			return err
+		}
+
+		if r.Kind() == s.fail {
+			if err := sopts.Events.ResourceFailed(ctx, r, errScrape); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sopts.Events.ResourceScraped(r, 1, 0)
+
+		if err := sopts.Events.ResourceFinished(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func MustPlan(t *testing.T, kinds ...string) plan.Plan {
+	p, err := simple.NewSimple()
+	if err != nil {
+		t.Fatalf("failed to create plan: %v", err)
+	}
+
+	for _, k := range kinds {
+		r, err := entity.NewResource("resType", "resName", "resGroup", "v1", k, false)
+		if err != nil {
+			t.Fatalf("failed to create resource: %v", err)
+		}
+
+		if err := p.Add(context.Background(), r); err != nil {
+			t.Fatalf("failed to add resource: %v", err)
+		}
+	}
+
+	return p
+}
+
+func MustBroker(t *testing.T) *memory.Memory {
+	b, err := memory.New(broker.WithCap(100))
+	if err != nil {
+		t.Fatalf("failed creating broker: %v", err)
+	}
+
+	if err := b.Open(context.Background()); err != nil {
+		t.Fatalf("failed to open broker session: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = b.Close(ctx)
+	})
+
+	return b
+}
+
+// MustEvents receives n events published on topic via sub.
+func MustEvents(t *testing.T, sub broker.Subscriber, n int) []Event {
+	events := make([]Event, 0, n)
+
+	h := func(ctx context.Context, m broker.Message) error {
+		e, err := DecodeEvent(m)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	}
+
+	for len(events) < n {
+		if err := sub.Receive(context.Background(), h, broker.WithSubTimeout(time.Second)); err != nil {
+			t.Fatalf("failed receiving event: %v", err)
+		}
+	}
+
+	return events
+}
+
+func TestRunEvents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	kinds := []string{"foo", "bar", "baz"}
+
+	b := MustBroker(t)
+
+	sub, err := b.Sub(context.Background(), DefaultControlTopic)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	r, err := NewRunner(WithBroker(b))
+	if err != nil {
+		t.Fatalf("failed creating runner: %v", err)
+	}
+
+	if _, err := r.Run(context.Background(), MustPlan(t, kinds...), &testScraper{fail: "bar"}); err != nil {
+		t.Fatalf("failed running scrape: %v", err)
+	}
+
+	events := MustEvents(t, sub, 2+2*len(kinds))
+
+	if e := events[0]; e.Type != ScrapeStarted {
+		t.Errorf("expected event: %s, got: %s", ScrapeStarted, e.Type)
+	}
+
+	id := events[0].ScrapeID
+	for _, e := range events {
+		if e.ScrapeID != id {
+			t.Errorf("expected scrape ID: %s, got: %s", id, e.ScrapeID)
+		}
+	}
+
+	var failed *Event
+	for i, e := range events[1 : len(events)-1] {
+		if e.Resource == nil {
+			t.Fatalf("expected resource in %s event", e.Type)
+		}
+
+		if e.Type == ResourceFailed {
+			failed = &events[1+i]
+		}
+	}
+
+	if failed == nil || failed.Resource.Kind != "bar" || failed.Error != errScrape.Error() {
+		t.Errorf("expected failed resource %s: %v", "bar", failed)
+	}
+
+	e := events[len(events)-1]
+	if e.Type != ScrapeCompleted {
+		t.Fatalf("expected event: %s, got: %s", ScrapeCompleted, e.Type)
+	}
+
+	totals := Totals{Resources: 3, Finished: 2, Failed: 1, Entities: 2}
+	if e.Totals == nil || *e.Totals != totals {
+		t.Errorf("expected totals: %v, got: %v", totals, e.Totals)
+	}
+}
+
+func TestRunNoBroker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	r, err := NewRunner()
+	if err != nil {
+		t.Fatalf("failed creating runner: %v", err)
+	}
+
+	if _, err := r.Run(context.Background(), MustPlan(t, "foo"), &testScraper{}); err != nil {
+		t.Errorf("failed running scrape: %v", err)
+	}
+
+	if _, err := r.Run(context.Background(), nil, &testScraper{}); !errors.Is(err, ErrMissingPlan) {
+		t.Errorf("expected error: %v, got: %v", ErrMissingPlan, err)
+	}
+}
+
+// blockingScraper blocks scraping until ctx is done or it's released.
+type blockingScraper struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingScraper) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	close(s.started)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.release:
+		return nil
+	}
+}
+
+// fakeClock fires scheduled runs when ticked.
+type fakeClock struct {
+	ticks chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *fakeClock) After(d time.Duration) (<-chan time.Time, func() bool) {
+	return c.ticks, func() bool { return true }
+}
+
+func TestSchedule(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	every, err := Every(10 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed creating schedule: %v", err)
+	}
+
+	t.Run("History", func(t *testing.T) {
+		r, err := NewRunner(WithHistory(3))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		clock := &fakeClock{ticks: make(chan time.Time)}
+		r.clock = clock
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Schedule(ctx, MustPlan(t, "foo", "bar"), &testScraper{fail: "bar"}, every, WithJitter(time.Millisecond))
+		}()
+
+		for i := 0; i < 4; i++ {
+			clock.ticks <- time.Now()
+		}
+		cancel()
+
+		if err := <-done; err != nil {
+			t.Fatalf("failed scheduling runs: %v", err)
+		}
+
+		history := r.History()
+		if len(history) != 3 {
+			t.Fatalf("expected runs: %d, got: %d", 3, len(history))
+		}
+
+		totals := Totals{Resources: 2, Finished: 1, Failed: 1, Entities: 1}
+		for _, rec := range history {
+			if rec.ScrapeID == "" || rec.Err != nil {
+				t.Errorf("expected successful run, got: %#v", rec)
+			}
+
+			if rec.Totals != totals {
+				t.Errorf("expected totals: %v, got: %v", totals, rec.Totals)
+			}
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		r, err := NewRunner()
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		clock := &fakeClock{ticks: make(chan time.Time)}
+		r.clock = clock
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		s := &blockingScraper{started: make(chan struct{}), release: make(chan struct{})}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Schedule(ctx, MustPlan(t, "foo"), s, every)
+		}()
+
+		clock.ticks <- time.Now()
+		<-s.started
+
+		cancel()
+		close(s.release)
+
+		if err := <-done; err != nil {
+			t.Fatalf("failed scheduling runs: %v", err)
+		}
+
+		history := r.History()
+		if len(history) != 1 || history[0].Err != nil {
+			t.Errorf("expected successful run, got: %v", history)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		r, err := NewRunner(WithTimeout(10 * time.Millisecond))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		s := &blockingScraper{started: make(chan struct{}), release: make(chan struct{})}
+
+		if _, err := r.Run(context.Background(), MustPlan(t, "foo"), s); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected error: %v, got: %v", context.DeadlineExceeded, err)
+		}
+
+		history := r.History()
+		if len(history) != 1 || !errors.Is(history[0].Err, context.DeadlineExceeded) {
+			t.Errorf("expected timed out run, got: %v", history)
+		}
+	})
+
+	t.Run("NoOverlap", func(t *testing.T) {
+		r, err := NewRunner()
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		s := &blockingScraper{started: make(chan struct{}), release: make(chan struct{})}
+		p := MustPlan(t, "foo")
+
+		done := make(chan error)
+		go func() {
+			_, err := r.Run(context.Background(), p, s)
+			done <- err
+		}()
+		<-s.started
+
+		clock := &fakeClock{ticks: make(chan time.Time)}
+		r.clock = clock
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		scheduled := make(chan error, 1)
+		go func() {
+			scheduled <- r.Schedule(ctx, p, &testScraper{}, every)
+		}()
+
+		for i := 0; i < 2; i++ {
+			clock.ticks <- time.Now()
+		}
+		cancel()
+
+		if err := <-scheduled; err != nil {
+			t.Fatalf("failed scheduling runs: %v", err)
+		}
+
+		close(s.release)
+		if err := <-done; err != nil {
+			t.Fatalf("failed running scrape: %v", err)
+		}
+
+		history := r.History()
+		if len(history) != 3 {
+			t.Fatalf("expected skipped runs, got: %v", history)
+		}
+
+		for _, rec := range history[:len(history)-1] {
+			if !errors.Is(rec.Err, ErrRunInProgress) {
+				t.Errorf("expected error: %v, got: %v", ErrRunInProgress, rec.Err)
+			}
+		}
+	})
+}
+
+func TestRunSelector(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	r, err := NewRunner()
+	if err != nil {
+		t.Fatalf("failed creating runner: %v", err)
+	}
+
+	s := &testScraper{}
+	if _, err := r.Run(context.Background(), MustPlan(t, "foo", "bar"), s, WithSelector(plan.GVK("", "", "foo"))); err != nil {
+		t.Fatalf("failed running scrape: %v", err)
+	}
+
+	if len(s.scraped) != 1 || s.scraped[0] != "foo" {
+		t.Errorf("expected scraped: %v, got: %v", []string{"foo"}, s.scraped)
+	}
+}
@@ -0,0 +1,201 @@
+package netscrape
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is scrape schedule.
+type Schedule interface {
+	// Next returns the next scheduled time after t.
+	Next(t time.Time) time.Time
+}
+
+// interval is a fixed interval schedule.
+type interval time.Duration
+
+// Every returns schedule which fires every d.
+func Every(d time.Duration) (Schedule, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("%w: non-positive interval %s", ErrInvalidSchedule, d)
+	}
+	return interval(d), nil
+}
+
+// Next implements Schedule.
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// field is a set of values of cron expression field.
+type field uint64
+
+// has returns true if v is in f.
+func (f field) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// cron is cron expression schedule.
+type cron struct {
+	minute, hour, dom, month, dow field
+	// anyDay is true if either day field is unrestricted.
+	anyDay bool
+}
+
+// descriptors are predefined cron schedules.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron returns schedule given by standard 5-field cron expression:
+// minute, hour, day of month, month and day of week.
+// Fields are lists of values, ranges and steps, e.g. "*/15", "1-5", "0,30".
+// Predefined schedules such as @hourly or @daily are also accepted.
+// Times are computed in the location of the time passed to Next.
+func Cron(expr string) (Schedule, error) {
+	if d, ok := descriptors[strings.TrimSpace(expr)]; ok {
+		expr = d
+	}
+
+	fx := strings.Fields(expr)
+	if len(fx) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidSchedule, len(fx))
+	}
+
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+	var fields [5]field
+	for i, f := range fx {
+		v, err := parseField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", ErrInvalidSchedule, f, err)
+		}
+		fields[i] = v
+	}
+
+	// NOTE: both 0 and 7 are Sunday
+	dow := fields[4]
+	if dow.has(7) {
+		dow |= 1
+	}
+
+	return &cron{
+		minute: fields[0],
+		hour:   fields[1],
+		dom:    fields[2],
+		month:  fields[3],
+		dow:    dow,
+		anyDay: fx[2] == "*" || fx[4] == "*",
+	}, nil
+}
+
+// parseField parses cron expression field with values in [min, max].
+func parseField(f string, min, max int) (field, error) {
+	var v field
+
+	for _, item := range strings.Split(f, ",") {
+		lo, hi, step := min, max, 1
+
+		r := item
+		if i := strings.Index(item, "/"); i >= 0 {
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q", item[i+1:])
+			}
+			r, step = item[:i], s
+		}
+
+		if r != "*" {
+			bounds := strings.SplitN(r, "-", 2)
+
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("range %d-%d out of bounds %d-%d", lo, hi, min, max)
+		}
+
+		for i := lo; i <= hi; i += step {
+			v |= 1 << uint(i)
+		}
+	}
+
+	return v, nil
+}
+
+// day returns true if t matches day fields of cron.
+// If both day fields are restricted, t matches either of them.
+func (c *cron) day(t time.Time) bool {
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next implements Schedule.
+// It returns zero time if there is no matching time within five years.
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !c.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// clock tells time to scheduled runs.
+type clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel which receives the current time
+	// once d has elapsed and a function which stops it.
+	After(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// systemClock tells system time.
+type systemClock struct{}
+
+// Now implements clock.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements clock.
+func (systemClock) After(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
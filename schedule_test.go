@@ -0,0 +1,71 @@
+package netscrape
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	s, err := Every(time.Minute)
+	if err != nil {
+		t.Fatalf("failed creating schedule: %v", err)
+	}
+
+	now := time.Now()
+	if next := s.Next(now); !next.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected next: %v, got: %v", now.Add(time.Minute), next)
+	}
+
+	if _, err := Every(0); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected error: %v, got: %v", ErrInvalidSchedule, err)
+	}
+}
+
+func TestCron(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	// Friday
+	now := time.Date(2021, time.January, 1, 10, 30, 15, 0, time.UTC)
+
+	testCases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.January, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.January, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2021, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2021, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2021, time.January, 4, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 1", time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{"30 2 29 2 *", time.Date(2024, time.February, 29, 2, 30, 0, 0, time.UTC)},
+		{"0,20 10 1 1 *", time.Date(2022, time.January, 1, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		s, err := Cron(tc.expr)
+		if err != nil {
+			t.Fatalf("failed parsing %q: %v", tc.expr, err)
+		}
+
+		if next := s.Next(now); !next.Equal(tc.next) {
+			t.Errorf("%q: expected next: %v, got: %v", tc.expr, tc.next, next)
+		}
+	}
+
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"}
+
+	for _, expr := range invalid {
+		if _, err := Cron(expr); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("%q: expected error: %v, got: %v", expr, ErrInvalidSchedule, err)
+		}
+	}
+}
@@ -7,7 +7,11 @@ import (
 )
 
 // Scraper scrapes data.
+// Scrapers which can list source resource types
+// implement plan.Discoverer, too.
 type Scraper interface {
 	// Scrape scrapes data following the given plan.
+	// Scrapers report progress of every plan resource and the number
+	// of entities and links scraped from it via Events option.
 	Scrape(context.Context, plan.Plan, ...Option) error
 }
@@ -0,0 +1,151 @@
+package netscrape
+
+import (
+	"context"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/space"
+	"github.com/milosgajdos/netscrape/pkg/store"
+)
+
+// ChangeType is the type of change.
+type ChangeType int
+
+const (
+	// Added is a change which adds entity or link.
+	Added ChangeType = iota
+	// Updated is a change which updates entity or link.
+	Updated
+	// Deleted is a change which deletes entity or link.
+	Deleted
+)
+
+// String implements fmt.Stringer
+func (c ChangeType) String() string {
+	switch c {
+	case Added:
+		return "Added"
+	case Updated:
+		return "Updated"
+	case Deleted:
+		return "Deleted"
+	default:
+		return "Unknown"
+	}
+}
+
+// Change is a change of scraped entity or link.
+// Exactly one of Entity or Link is set.
+type Change struct {
+	Type   ChangeType
+	Entity space.Entity
+	Link   space.Link
+}
+
+// Watcher is a scraper which streams changes as they happen.
+type Watcher interface {
+	Scraper
+	// Watch watches changes of data following the given plan.
+	// The returned channel is closed when ctx is done or the watch ends.
+	Watch(context.Context, plan.Plan, ...Option) (<-chan Change, error)
+}
+
+// Apply applies change c to store s.
+// Added and updated entities are upserted, deleted entities are removed.
+// Added and updated links link the entities they connect, deleted links unlink them.
+func Apply(ctx context.Context, s store.Store, c Change) error {
+	switch {
+	case c.Entity != nil:
+		if c.Type == Deleted {
+			return s.Delete(ctx, c.Entity.UID())
+		}
+		return s.Add(ctx, c.Entity, store.WithUpsert())
+	case c.Link != nil:
+		if c.Type == Deleted {
+			return s.Unlink(ctx, c.Link.From(), c.Link.To())
+		}
+		return s.Link(ctx, c.Link.From(), c.Link.To(), store.WithUpsert(), store.WithAttrs(c.Link.Attrs()))
+	default:
+		return ErrInvalidChange
+	}
+}
+
+// Watch runs netscraping in watch mode using watcher w.
+// It runs a full scrape first and then applies changes streamed by w
+// to the store until ctx is done or w ends the watch.
+// If Resync option is set, the watch is restarted every Resync
+// interval after another full scrape.
+func (r *Runner) Watch(ctx context.Context, p plan.Plan, w Watcher, opts ...Option) error {
+	wopts := r.opts
+	for _, apply := range opts {
+		apply(&wopts)
+	}
+
+	if wopts.Store == nil {
+		return ErrMissingStore
+	}
+
+	for {
+		if _, err := r.Run(ctx, p, w, opts...); err != nil {
+			return err
+		}
+
+		resync, err := r.watch(ctx, p, w, wopts)
+		if err != nil || !resync {
+			return err
+		}
+	}
+}
+
+// watch applies changes streamed by w to the store.
+// Watcher w is passed the same options as the runner scrapers.
+// It returns true when resync is due.
+func (r *Runner) watch(ctx context.Context, p plan.Plan, w Watcher, opts Options) (bool, error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limiter := opts.Limiter
+	if limiter == nil {
+		limiter = NewLimiter(opts.Limits)
+	}
+	wctx = ContextWithLimiter(wctx, limiter)
+
+	changes, err := w.Watch(wctx, p,
+		WithStore(opts.Store),
+		WithBroker(opts.Broker),
+		WithMarshaler(opts.Marshaler),
+		WithControlTopic(opts.ControlTopic),
+		WithSource(opts.Source),
+		WithLimits(opts.Limits),
+		WithLimiter(limiter),
+		WithSelector(opts.Selector),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	var resync <-chan time.Time
+	if opts.Resync > 0 {
+		t := time.NewTimer(opts.Resync)
+		defer t.Stop()
+		resync = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-resync:
+			return true, nil
+		case c, ok := <-changes:
+			if !ok {
+				return false, nil
+			}
+
+			if err := Apply(ctx, opts.Store, c); err != nil {
+				return false, err
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package netscrape
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/netscrape/pkg/graph"
+	"github.com/milosgajdos/netscrape/pkg/plan"
+	"github.com/milosgajdos/netscrape/pkg/space/entity"
+	"github.com/milosgajdos/netscrape/pkg/space/link"
+	"github.com/milosgajdos/netscrape/pkg/store"
+	"github.com/milosgajdos/netscrape/pkg/uuid"
+	memuid "github.com/milosgajdos/netscrape/pkg/uuid/memory"
+)
+
+// testStore records applied changes.
+type testStore struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (s *testStore) record(c string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, c)
+	return nil
+}
+
+func (s *testStore) Applied() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.changes...)
+}
+
+func (s *testStore) Add(ctx context.Context, e store.Entity, opts ...store.Option) error {
+	return s.record("add")
+}
+
+func (s *testStore) Get(ctx context.Context, uid uuid.UID, opts ...store.Option) (store.Entity, error) {
+	return nil, ErrNotImplemented
+}
+
+func (s *testStore) Delete(ctx context.Context, uid uuid.UID, opts ...store.Option) error {
+	return s.record("delete")
+}
+
+func (s *testStore) Link(ctx context.Context, from, to uuid.UID, opts ...store.Option) error {
+	return s.record("link")
+}
+
+func (s *testStore) Unlink(ctx context.Context, from, to uuid.UID, opts ...store.Option) error {
+	return s.record("unlink")
+}
+
+func (s *testStore) Graph(ctx context.Context, opts ...store.Option) (graph.Graph, error) {
+	return nil, ErrNotImplemented
+}
+
+// testWatcher streams changes and ends the watch
+// once all of them have been streamed if end is true.
+type testWatcher struct {
+	testScraper
+	mu      sync.Mutex
+	scrapes int
+	changes []Change
+	end     bool
+	opts    Options
+}
+
+func (w *testWatcher) Scrape(ctx context.Context, p plan.Plan, opts ...Option) error {
+	w.mu.Lock()
+	w.scrapes++
+	w.mu.Unlock()
+	return w.testScraper.Scrape(ctx, p, opts...)
+}
+
+func (w *testWatcher) Scrapes() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.scrapes
+}
+
+func (w *testWatcher) Options() Options {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.opts
+}
+
+func (w *testWatcher) Watch(ctx context.Context, p plan.Plan, opts ...Option) (<-chan Change, error) {
+	w.mu.Lock()
+	for _, apply := range opts {
+		apply(&w.opts)
+	}
+	w.mu.Unlock()
+
+	ch := make(chan Change)
+
+	go func() {
+		defer close(ch)
+		for _, c := range w.changes {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- c:
+			}
+		}
+		if !w.end {
+			<-ctx.Done()
+		}
+	}()
+
+	return ch, nil
+}
+
+func TestWatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	e, err := entity.New("entType")
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+
+	l, err := link.New(memuid.New(), memuid.New())
+	if err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+
+	changes := []Change{
+		{Type: Added, Entity: e},
+		{Type: Updated, Entity: e},
+		{Type: Added, Link: l},
+		{Type: Deleted, Link: l},
+		{Type: Deleted, Entity: e},
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		s := &testStore{}
+		w := &testWatcher{changes: changes, end: true}
+
+		r, err := NewRunner(WithStore(s))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if err := r.Watch(context.Background(), MustPlan(t, "foo"), w); err != nil {
+			t.Fatalf("failed watching: %v", err)
+		}
+
+		exp := []string{"add", "add", "link", "unlink", "delete"}
+		got := s.Applied()
+		if len(got) != len(exp) {
+			t.Fatalf("expected changes: %v, got: %v", exp, got)
+		}
+		for i := range exp {
+			if got[i] != exp[i] {
+				t.Errorf("expected change: %s, got: %s", exp[i], got[i])
+			}
+		}
+
+		if n := w.Scrapes(); n != 1 {
+			t.Errorf("expected scrapes: %d, got: %d", 1, n)
+		}
+	})
+
+	t.Run("Resync", func(t *testing.T) {
+		s := &testStore{}
+		w := &testWatcher{}
+
+		r, err := NewRunner(WithStore(s), WithResync(10*time.Millisecond))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if err := r.Watch(ctx, MustPlan(t, "foo"), w); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("failed watching: %v", err)
+		}
+
+		if n := w.Scrapes(); n < 2 {
+			t.Errorf("expected at least %d scrapes, got: %d", 2, n)
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		s := &testStore{}
+		w := &testWatcher{end: true}
+
+		r, err := NewRunner(WithStore(s))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		source := "bar"
+		if err := r.Watch(context.Background(), MustPlan(t, "foo"), w, WithSource(source)); err != nil {
+			t.Fatalf("failed watching: %v", err)
+		}
+
+		o := w.Options()
+		if o.Store != s {
+			t.Errorf("expected store: %v, got: %v", s, o.Store)
+		}
+		if o.Source != source {
+			t.Errorf("expected source: %s, got: %s", source, o.Source)
+		}
+		if o.Limiter == nil {
+			t.Errorf("expected limiter")
+		}
+	})
+
+	t.Run("InvalidChange", func(t *testing.T) {
+		w := &testWatcher{changes: []Change{{Type: Added}}}
+
+		r, err := NewRunner(WithStore(&testStore{}))
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if err := r.Watch(context.Background(), MustPlan(t, "foo"), w); !errors.Is(err, ErrInvalidChange) {
+			t.Errorf("expected error: %v, got: %v", ErrInvalidChange, err)
+		}
+	})
+
+	t.Run("MissingStore", func(t *testing.T) {
+		r, err := NewRunner()
+		if err != nil {
+			t.Fatalf("failed creating runner: %v", err)
+		}
+
+		if err := r.Watch(context.Background(), MustPlan(t, "foo"), &testWatcher{}); !errors.Is(err, ErrMissingStore) {
+			t.Errorf("expected error: %v, got: %v", ErrMissingStore, err)
+		}
+	})
+}